@@ -0,0 +1,790 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/services/auth"
+	"github.com/piquel-fr/api/services/email"
+	"github.com/piquel-fr/api/services/users"
+	"github.com/piquel-fr/api/utils/errors"
+	"github.com/piquel-fr/api/utils/middleware"
+)
+
+type AdminHandler struct {
+	userService  users.UserService
+	authService  auth.AuthService
+	emailService email.EmailService
+}
+
+func CreateAdminHandler(userService users.UserService, authService auth.AuthService, emailService email.EmailService) *AdminHandler {
+	return &AdminHandler{userService, authService, emailService}
+}
+
+func (h *AdminHandler) getName() string { return "admin" }
+
+func (h *AdminHandler) getSpec() Spec {
+	spec := newSpecBase(h)
+
+	serviceAccountSchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("username", openapi3.NewStringSchema()).
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("role", openapi3.NewStringSchema()).
+		WithProperty("kind", openapi3.NewStringSchema()).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"id", "username", "name", "role", "kind", "createdAt"})
+
+	createServiceAccountSchema := openapi3.NewObjectSchema().
+		WithProperty("username", openapi3.NewStringSchema()).
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("role", openapi3.NewStringSchema()).
+		WithRequired([]string{"username", "name", "role"})
+
+	serviceCredentialSchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("userId", openapi3.NewInt32Schema()).
+		WithProperty("clientId", openapi3.NewStringSchema()).
+		WithProperty("lastUsedAt", openapi3.NewDateTimeSchema().WithNullable()).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"id", "userId", "clientId", "lastUsedAt", "createdAt"})
+
+	createdServiceCredentialSchema := openapi3.NewObjectSchema().
+		WithProperty("clientSecret", openapi3.NewStringSchema()).
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("userId", openapi3.NewInt32Schema()).
+		WithProperty("clientId", openapi3.NewStringSchema()).
+		WithProperty("lastUsedAt", openapi3.NewDateTimeSchema().WithNullable()).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"clientSecret", "id", "userId", "clientId", "lastUsedAt", "createdAt"})
+
+	createdServiceAccountSchema := openapi3.NewObjectSchema().
+		WithProperty("account", serviceAccountSchema).
+		WithProperty("credential", createdServiceCredentialSchema).
+		WithRequired([]string{"account", "credential"})
+
+	explainParamsSchema := openapi3.NewObjectSchema().
+		WithProperty("user", openapi3.NewStringSchema()).
+		WithProperty("resource", openapi3.NewStringSchema().WithEnum(repository.ResourceUser, repository.ResourceMailAccount)).
+		WithProperty("id", openapi3.NewStringSchema()).
+		WithProperty("actions", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()).WithMinItems(1)).
+		WithRequired([]string{"user", "resource", "id", "actions"})
+
+	traceStepSchema := openapi3.NewObjectSchema().
+		WithProperty("depth", openapi3.NewIntegerSchema()).
+		WithProperty("role", openapi3.NewStringSchema()).
+		WithProperty("action", openapi3.NewStringSchema()).
+		WithProperty("message", openapi3.NewStringSchema()).
+		WithRequired([]string{"depth", "message"})
+
+	traceSchema := openapi3.NewObjectSchema().
+		WithProperty("allowed", openapi3.NewBoolSchema()).
+		WithProperty("error", openapi3.NewStringSchema()).
+		WithProperty("steps", openapi3.NewArraySchema().WithItems(traceStepSchema)).
+		WithRequired([]string{"allowed", "steps"})
+
+	rolePermissionSchema := openapi3.NewObjectSchema().
+		WithProperty("action", openapi3.NewStringSchema()).
+		WithProperty("preset", openapi3.NewStringSchema()).
+		WithProperty("conditions", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()))
+
+	rolePermissionsSchema := openapi3.NewObjectSchema().
+		WithAdditionalProperties(openapi3.NewArraySchema().WithItems(rolePermissionSchema))
+
+	roleParamsSchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewStringSchema()).
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("color", openapi3.NewStringSchema()).
+		WithProperty("parents", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
+		WithProperty("permissions", rolePermissionsSchema).
+		WithRequired([]string{"name", "color", "permissions"})
+
+	customRoleSchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewStringSchema()).
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("color", openapi3.NewStringSchema()).
+		WithProperty("parents", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
+		WithProperty("permissions", rolePermissionsSchema).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithProperty("updatedAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"id", "name", "color", "parents", "permissions", "createdAt", "updatedAt"})
+
+	spec.Components.Schemas = openapi3.Schemas{
+		"ServiceAccount":             &openapi3.SchemaRef{Value: serviceAccountSchema},
+		"CreateServiceAccountParams": &openapi3.SchemaRef{Value: createServiceAccountSchema},
+		"CreatedServiceAccount":      &openapi3.SchemaRef{Value: createdServiceAccountSchema},
+		"ServiceCredential":          &openapi3.SchemaRef{Value: serviceCredentialSchema},
+		"CreatedServiceCredential":   &openapi3.SchemaRef{Value: createdServiceCredentialSchema},
+		"ExplainParams":              &openapi3.SchemaRef{Value: explainParamsSchema},
+		"AuthorizationTrace":         &openapi3.SchemaRef{Value: traceSchema},
+		"TraceStep":                  &openapi3.SchemaRef{Value: traceStepSchema},
+		"RolePermission":             &openapi3.SchemaRef{Value: rolePermissionSchema},
+		"RoleParams":                 &openapi3.SchemaRef{Value: roleParamsSchema},
+		"CustomRole":                 &openapi3.SchemaRef{Value: customRoleSchema},
+	}
+
+	roleParameter := &openapi3.ParameterRef{
+		Value: &openapi3.Parameter{
+			Name:        "role",
+			In:          "path",
+			Required:    true,
+			Description: "The id of the custom role",
+			Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+		},
+	}
+
+	userParameter := &openapi3.ParameterRef{
+		Value: &openapi3.Parameter{
+			Name:        "user",
+			In:          "path",
+			Required:    true,
+			Description: "The username of the service account",
+			Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+		},
+	}
+
+	spec.AddOperation("/service-accounts", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"admin", "service-accounts"},
+		Summary:     "List service accounts",
+		Description: "List the accounts used by other services to access the API",
+		OperationID: "list-service-accounts",
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Service accounts found").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(serviceAccountSchema))),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
+
+	spec.AddOperation("/service-accounts", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"admin", "service-accounts"},
+		Summary:     "Create service account",
+		Description: "Create a service account with a role and its first client credential. The client secret is only returned once, exchange it for access tokens at /auth/token with the client_credentials grant. Service accounts are deleted like any other user",
+		OperationID: "create-service-account",
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/CreateServiceAccountParams", createServiceAccountSchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Service account created").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/CreatedServiceAccount", createdServiceAccountSchema)),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid input or json")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
+
+	spec.AddOperation("/service-accounts/{user}/credentials", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"admin", "service-accounts"},
+		Summary:     "Get service account credentials",
+		Description: "Get the client credentials of the service account",
+		OperationID: "get-service-credentials",
+		Parameters:  openapi3.Parameters{userParameter},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Credentials found").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(serviceCredentialSchema))),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Service account not found")}),
+		),
+	})
+
+	spec.AddOperation("/service-accounts/{user}/credentials", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"admin", "service-accounts"},
+		Summary:     "Create service account credential",
+		Description: "Create another client credential, to rotate the secret without downtime. The client secret is only returned once",
+		OperationID: "create-service-credential",
+		Parameters:  openapi3.Parameters{userParameter},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Credential created").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/CreatedServiceCredential", createdServiceCredentialSchema)),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Service account not found")}),
+		),
+	})
+
+	spec.AddOperation("/service-accounts/{user}/credentials", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"admin", "service-accounts"},
+		Summary:     "Revoke service account credential",
+		Description: "Revoke the client credential with the given 'id'. Access tokens already issued stay valid until they expire",
+		OperationID: "delete-service-credential",
+		Parameters: openapi3.Parameters{
+			userParameter,
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "id",
+					In:          "query",
+					Required:    true,
+					Description: "The credential ID to revoke",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewInt32Schema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Credential revoked successfully")}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid input")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Credential not found")}),
+		),
+	})
+
+	spec.AddOperation("/authorize/explain", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"admin", "policy"},
+		Summary:     "Explain authorization",
+		Description: "Check whether 'user' may do 'actions' on the resource identified by 'id', a username for users or an email for email accounts, and return every step of the evaluation: roles visited through their parents, presets expanded, permissions matched and conditions checked. The user is evaluated as if signed in from a session",
+		OperationID: "explain-authorization",
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/ExplainParams", explainParamsSchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Authorization explained, denied requests included").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/AuthorizationTrace", traceSchema)),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid input or json")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("User or resource not found")}),
+		),
+	})
+
+	spec.AddOperation("/roles", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"admin", "roles"},
+		Summary:     "List custom roles",
+		Description: "List the roles stored in the database. They are merged with the roles of the policy, which are not listed",
+		OperationID: "list-custom-roles",
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Custom roles found").
+					WithJSONSchema(openapi3.NewArraySchema().WithItems(customRoleSchema)),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
+
+	spec.AddOperation("/roles", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"admin", "roles"},
+		Summary:     "Create custom role",
+		Description: "Create a role with the given 'id'. Permissions are grouped by resource and reference an action or a preset of the policy, optionally with named conditions. The role can inherit from the roles of the policy and other custom roles",
+		OperationID: "create-custom-role",
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/RoleParams", roleParamsSchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Role created successfully")}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid role or json")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(409, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Role already exists")}),
+		),
+	})
+
+	spec.AddOperation("/roles/{role}", http.MethodPut, &openapi3.Operation{
+		Tags:        []string{"admin", "roles"},
+		Summary:     "Update custom role",
+		Description: "Replace the role and all its permissions. The 'id' in the body is ignored",
+		OperationID: "update-custom-role",
+		Parameters:  openapi3.Parameters{roleParameter},
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/RoleParams", roleParamsSchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Role updated successfully")}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid role or json")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Role not found")}),
+			openapi3.WithStatus(409, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Role is defined by the policy")}),
+		),
+	})
+
+	spec.AddOperation("/roles/{role}", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"admin", "roles"},
+		Summary:     "Delete custom role",
+		Description: "Delete the role. Roles still given to users or inherited by other roles can't be deleted",
+		OperationID: "delete-custom-role",
+		Parameters:  openapi3.Parameters{roleParameter},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Role deleted successfully")}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Role is inherited by other roles")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Role not found")}),
+			openapi3.WithStatus(409, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Role is given to users or defined by the policy")}),
+		),
+	})
+
+	return spec
+}
+
+func (h *AdminHandler) createHttpHandler() http.Handler {
+	handler := http.NewServeMux()
+
+	handler.HandleFunc("GET /service-accounts", h.handleListServiceAccounts)
+	handler.HandleFunc("POST /service-accounts", h.handleCreateServiceAccount)
+	handler.Handle("OPTIONS /service-accounts", middleware.CreateOptionsHandler("GET", "POST"))
+
+	handler.HandleFunc("GET /service-accounts/{user}/credentials", h.handleGetServiceCredentials)
+	handler.HandleFunc("POST /service-accounts/{user}/credentials", h.handleCreateServiceCredential)
+	handler.HandleFunc("DELETE /service-accounts/{user}/credentials", h.handleDeleteServiceCredential)
+	handler.Handle("OPTIONS /service-accounts/{user}/credentials", middleware.CreateOptionsHandler("GET", "POST", "DELETE"))
+
+	handler.HandleFunc("POST /authorize/explain", h.handleExplainAuthorization)
+	handler.Handle("OPTIONS /authorize/explain", middleware.CreateOptionsHandler("POST"))
+
+	handler.HandleFunc("GET /roles", h.handleListRoles)
+	handler.HandleFunc("POST /roles", h.handleCreateRole)
+	handler.Handle("OPTIONS /roles", middleware.CreateOptionsHandler("GET", "POST"))
+
+	handler.HandleFunc("PUT /roles/{role}", h.handleUpdateRole)
+	handler.HandleFunc("DELETE /roles/{role}", h.handleDeleteRole)
+	handler.Handle("OPTIONS /roles/{role}", middleware.CreateOptionsHandler("PUT", "DELETE"))
+
+	return handler
+}
+
+type createServiceAccountParams struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+}
+
+type createdServiceAccount struct {
+	Account    *repository.User               `json:"account"`
+	Credential *auth.CreatedServiceCredential `json:"credential"`
+}
+
+type explainParams struct {
+	User     string   `json:"user"`
+	Resource string   `json:"resource"`
+	Id       string   `json:"id"` // username of a user or email of an account
+	Actions  []string `json:"actions"`
+}
+
+type roleParams struct {
+	Id string `json:"id"`
+	auth.RoleParams
+}
+
+func (h *AdminHandler) handleListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: &repository.User{Kind: users.KindService},
+		Actions:   []string{auth.ActionManageServiceAccounts},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	accounts, err := h.userService.ListServiceAccounts(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(accounts)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *AdminHandler) handleCreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your creation request with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	params := createServiceAccountParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	// the account does not exist yet, the policy only looks at its role
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: &repository.User{Role: params.Role, Kind: users.KindService},
+		Actions:   []string{auth.ActionManageServiceAccounts},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.userService.RegisterServiceAccount(r.Context(), params.Username, params.Name, params.Role)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	credential, err := h.authService.CreateServiceCredential(r.Context(), account)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	credential.SecretHash = ""
+	data, err := json.Marshal(createdServiceAccount{account, credential})
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *AdminHandler) handleGetServiceCredentials(w http.ResponseWriter, r *http.Request) {
+	requester, account, err := h.getServiceAccount(r)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: account,
+		Actions:   []string{auth.ActionManageServiceAccounts},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	credentials, err := h.authService.GetServiceCredentials(r.Context(), account.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	// hide the secret hash for security reasons
+	for i := range credentials {
+		credentials[i].SecretHash = ""
+	}
+
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *AdminHandler) handleCreateServiceCredential(w http.ResponseWriter, r *http.Request) {
+	requester, account, err := h.getServiceAccount(r)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: account,
+		Actions:   []string{auth.ActionManageServiceAccounts},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	credential, err := h.authService.CreateServiceCredential(r.Context(), account)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	credential.SecretHash = ""
+	data, err := json.Marshal(credential)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *AdminHandler) handleDeleteServiceCredential(w http.ResponseWriter, r *http.Request) {
+	requester, account, err := h.getServiceAccount(r)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: account,
+		Actions:   []string{auth.ActionManageServiceAccounts},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		errors.HandleError(w, r, errors.NewError(fmt.Sprintf("id %s is not valid integer %s", idStr, err.Error()), http.StatusBadRequest))
+		return
+	}
+
+	if err := h.authService.DeleteServiceCredential(r.Context(), account.ID, int32(id)); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// getServiceAccount returns the requester and the service account in the
+// path, users that are not service accounts are not found
+func (h *AdminHandler) getServiceAccount(r *http.Request) (*repository.User, *repository.User, error) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	account, err := h.userService.GetUserByUsername(r.Context(), r.PathValue("user"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if account.Kind != users.KindService {
+		return nil, nil, errors.ErrorNotFound
+	}
+	return requester, account, nil
+}
+
+func (h *AdminHandler) handleExplainAuthorization(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your request with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	params := explainParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if len(params.Actions) == 0 {
+		errors.HandleError(w, r, errors.NewError("at least one action has to be explained", http.StatusBadRequest))
+		return
+	}
+
+	user, err := h.userService.GetUserByUsername(r.Context(), params.User)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionExplain},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var resource config.Resource
+	switch params.Resource {
+	case repository.ResourceUser:
+		resource, err = h.userService.GetUserByUsername(r.Context(), params.Id)
+	case repository.ResourceMailAccount:
+		var account *repository.MailAccount
+		account, err = h.emailService.GetAccountByEmail(r.Context(), params.Id)
+		if err == nil {
+			var info email.AccountInfo
+			info, err = h.emailService.GetAccountShareInfo(r.Context(), account)
+			resource = &info
+		}
+	default:
+		err = errors.NewError(fmt.Sprintf("resource %s can't be explained, use %s or %s", params.Resource, repository.ResourceUser, repository.ResourceMailAccount), http.StatusBadRequest)
+	}
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	trace := h.authService.ExplainAuthorization(&config.AuthRequest{
+		User:      user,
+		Ressource: resource,
+		Actions:   params.Actions,
+	})
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *AdminHandler) handleListRoles(w http.ResponseWriter, r *http.Request) {
+	if err := h.authorizeRole(r, "", auth.ActionView); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	roles, err := h.authService.GetCustomRoles(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(roles)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *AdminHandler) handleCreateRole(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your creation request with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	params := roleParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authorizeRole(r, params.Id, auth.ActionCreate); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.CreateCustomRole(r.Context(), params.Id, params.RoleParams); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *AdminHandler) handleUpdateRole(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your update request with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	params := roleParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	role := r.PathValue("role")
+	if err := h.authorizeRole(r, role, auth.ActionUpdate); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.UpdateCustomRole(r.Context(), role, params.RoleParams); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *AdminHandler) handleDeleteRole(w http.ResponseWriter, r *http.Request) {
+	role := r.PathValue("role")
+	if err := h.authorizeRole(r, role, auth.ActionDelete); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.DeleteCustomRole(r.Context(), role); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// authorizeRole checks that the requester may do action on the custom role
+// with the given id, which is empty for the list of roles
+func (h *AdminHandler) authorizeRole(r *http.Request, id, action string) error {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: &repository.Role{ID: id},
+		Actions:   []string{action},
+		Context:   r.Context(),
+	})
+}
@@ -1,10 +1,10 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
-	"github.com/jackc/pgx/v5"
 	"github.com/piquel-fr/api/config"
 	"github.com/piquel-fr/api/services/auth"
 	"github.com/piquel-fr/api/services/users"
@@ -31,6 +31,36 @@ func (h *AuthHandler) createHttpHandler() http.Handler {
 	handler.HandleFunc("GET /logout", h.handleLogout)
 	handler.Handle("OPTIONS /logout", middleware.CreateOptionsHandler("GET"))
 
+	handler.Handle("POST /webauthn/register/begin", h.authService.AuthMiddleware(http.HandlerFunc(h.handlePasskeyRegisterBegin)))
+	handler.Handle("OPTIONS /webauthn/register/begin", middleware.CreateOptionsHandler("POST"))
+
+	handler.Handle("POST /webauthn/register/finish", h.authService.AuthMiddleware(http.HandlerFunc(h.handlePasskeyRegisterFinish)))
+	handler.Handle("OPTIONS /webauthn/register/finish", middleware.CreateOptionsHandler("POST"))
+
+	handler.HandleFunc("POST /webauthn/login/begin", h.handlePasskeyLoginBegin)
+	handler.Handle("OPTIONS /webauthn/login/begin", middleware.CreateOptionsHandler("POST"))
+
+	handler.HandleFunc("POST /webauthn/login/finish", h.handlePasskeyLoginFinish)
+	handler.Handle("OPTIONS /webauthn/login/finish", middleware.CreateOptionsHandler("POST"))
+
+	handler.HandleFunc("GET /authorize", h.handleAuthorize)
+	handler.Handle("OPTIONS /authorize", middleware.CreateOptionsHandler("GET"))
+
+	handler.HandleFunc("POST /token", h.handleToken)
+	handler.Handle("OPTIONS /token", middleware.CreateOptionsHandler("POST"))
+
+	handler.HandleFunc("POST /introspect", h.handleIntrospect)
+	handler.Handle("OPTIONS /introspect", middleware.CreateOptionsHandler("POST"))
+
+	handler.HandleFunc("POST /revoke", h.handleRevoke)
+	handler.Handle("OPTIONS /revoke", middleware.CreateOptionsHandler("POST"))
+
+	handler.HandleFunc("DELETE /impersonate", h.handleStopImpersonation)
+	handler.Handle("OPTIONS /impersonate", middleware.CreateOptionsHandler("DELETE"))
+
+	handler.HandleFunc("POST /2fa", h.handleTwoFactor)
+	handler.Handle("OPTIONS /2fa", middleware.CreateOptionsHandler("POST"))
+
 	handler.HandleFunc("GET /{provider}", h.handleProviderLogin)
 	handler.Handle("OPTIONS /{provider}", middleware.CreateOptionsHandler("GET"))
 
@@ -47,6 +77,124 @@ func (h *AuthHandler) handleRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleAuthorize is the authorization endpoint of the OAuth server. The
+// request is passed on to the consent page of the frontend, which shows it
+// with GET /oauth/authorize and answers it with POST /oauth/authorize
+func (h *AuthHandler) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	redirectUrl := fmt.Sprintf("%s?%s", h.formatRedirectURL("/oauth/authorize"), r.URL.RawQuery)
+	http.Redirect(w, r, redirectUrl, http.StatusTemporaryRedirect)
+}
+
+// handleToken is the OAuth2 token endpoint. Clients authenticate with HTTP
+// basic auth or with the client_id and client_secret fields
+func (h *AuthHandler) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, r, auth.NewOAuthError("invalid_request", "the request is not form encoded", http.StatusBadRequest))
+		return
+	}
+
+	clientId, clientSecret := getOAuthClient(r)
+	response, err := h.authService.Token(r.Context(), auth.TokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Scope:        r.PostForm.Get("scope"),
+		Code:         r.PostForm.Get("code"),
+		RedirectUri:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+	})
+	if err != nil {
+		writeOAuthError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+func (h *AuthHandler) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, r, auth.NewOAuthError("invalid_request", "the request is not form encoded", http.StatusBadRequest))
+		return
+	}
+
+	clientId, clientSecret := getOAuthClient(r)
+	introspection, err := h.authService.IntrospectToken(r.Context(), clientId, clientSecret, r.PostForm.Get("token"))
+	if err != nil {
+		writeOAuthError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(introspection)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+func (h *AuthHandler) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, r, auth.NewOAuthError("invalid_request", "the request is not form encoded", http.StatusBadRequest))
+		return
+	}
+
+	clientId, clientSecret := getOAuthClient(r)
+	if err := h.authService.RevokeToken(r.Context(), clientId, clientSecret, r.PostForm.Get("token")); err != nil {
+		writeOAuthError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func getOAuthClient(r *http.Request) (string, string) {
+	if clientId, clientSecret, ok := r.BasicAuth(); ok {
+		return clientId, clientSecret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+func writeOAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	var oauthErr *auth.OAuthError
+	if !errors.As(err, &oauthErr) {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(oauthErr)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if oauthErr.Status() == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Basic realm=\"token\"")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(oauthErr.Status())
+	w.Write(data)
+}
+
+func (h *AuthHandler) handleStopImpersonation(w http.ResponseWriter, r *http.Request) {
+	if err := h.authService.StopImpersonation(w, r); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 func (h *AuthHandler) handleLogout(w http.ResponseWriter, r *http.Request) {
 	if err := h.authService.Logout(w, r); err != nil {
 		errors.HandleError(w, r, err)
@@ -65,7 +213,13 @@ func (h *AuthHandler) handleProviderLogin(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	http.Redirect(w, r, provider.AuthCodeURL(r.URL.Query().Get("redirectTo")), http.StatusTemporaryRedirect)
+	flow, err := h.authService.CreateOAuthState(r.Context(), w, providerName, r.URL.Query().Get("redirectTo"), 0)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, provider.AuthCodeURL(flow.State, flow.Nonce, flow.Verifier), http.StatusTemporaryRedirect)
 }
 
 func (h *AuthHandler) handleAuthCallback(w http.ResponseWriter, r *http.Request) {
@@ -76,36 +230,194 @@ func (h *AuthHandler) handleAuthCallback(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	token, err := provider.GetOAuthConfig().Exchange(r.Context(), r.URL.Query().Get("code"))
+	flow, err := h.authService.ConsumeOAuthState(w, r, providerName)
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	oauthUser, err := provider.FetchUser(r.Context(), token)
+	token, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), flow.Verifier)
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	user, err := h.userService.GetUserByEmail(r.Context(), oauthUser.Email)
-	if errors.Is(err, pgx.ErrNoRows) {
-		user, err = h.userService.RegisterUser(r.Context(), oauthUser.Username, oauthUser.Email, oauthUser.Name, oauthUser.Image, auth.RoleDefault)
+	oauthUser, err := provider.FetchUser(r.Context(), token, flow.Nonce)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
 	}
+
+	// the flow was started by a signed in user from /users/{user}/identities
+	if flow.LinkUserId != 0 {
+		if err := h.userService.LinkIdentity(r.Context(), flow.LinkUserId, providerName, oauthUser); err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+
+		redirectUrl := h.formatRedirectURL(flow.RedirectTo)
+		http.Redirect(w, r, redirectUrl, http.StatusTemporaryRedirect)
+		return
+	}
+
+	user, err := h.userService.ResolveOAuthUser(r.Context(), providerName, oauthUser, auth.RoleDefault)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	// users with two factor authentication finish signing in with POST /auth/2fa
+	pending, err := h.authService.RequireTwoFactor(r.Context(), w, user, flow.RedirectTo)
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
+	if pending {
+		http.Redirect(w, r, h.formatRedirectURL("/2fa"), http.StatusTemporaryRedirect)
+		return
+	}
+
 	if err := h.authService.FinishAuth(user, r, w); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	redirectUrl := h.formatRedirectURL(r.URL.Query().Get("state"))
+	redirectUrl := h.formatRedirectURL(flow.RedirectTo)
 	http.Redirect(w, r, redirectUrl, http.StatusTemporaryRedirect)
 }
 
+func (h *AuthHandler) handleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your code with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	code := auth.TwoFactorCode{}
+	if err := json.NewDecoder(r.Body).Decode(&code); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	redirectTo, err := h.authService.CompleteTwoFactor(w, r, code)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(struct {
+		RedirectTo string `json:"redirectTo"`
+	}{h.formatRedirectURL(redirectTo)})
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *AuthHandler) handlePasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: user,
+		Actions:   []string{auth.ActionManagePasskeys},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	creation, err := h.authService.BeginPasskeyRegistration(r.Context(), w, user)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(creation)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *AuthHandler) handlePasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: user,
+		Actions:   []string{auth.ActionManagePasskeys},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit the credential with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	credential, err := h.authService.FinishPasskeyRegistration(w, r, user, r.URL.Query().Get("name"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *AuthHandler) handlePasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	assertion, err := h.authService.BeginPasskeyLogin(r.Context(), w)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(assertion)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *AuthHandler) handlePasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit the assertion with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.FinishPasskeyLogin(w, r); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
 func (h *AuthHandler) formatRedirectURL(redirectTo string) string {
 	return fmt.Sprintf("%s%s", config.Envs.AuthCallbackUrl, utils.FormatLocalPathString(redirectTo))
 }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -42,9 +43,109 @@ func (h *EmailHandler) getSpec() Spec {
 		WithProperty("username", openapi3.NewStringSchema()).
 		WithProperty("password", openapi3.NewStringSchema())
 
+	outboxMessageSchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("account", openapi3.NewInt32Schema()).
+		WithProperty("senderId", openapi3.NewInt32Schema()).
+		WithProperty("recipients", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema().WithFormat("email"))).
+		WithProperty("subject", openapi3.NewStringSchema()).
+		WithProperty("body", openapi3.NewStringSchema()).
+		WithProperty("sign", openapi3.NewBoolSchema()).
+		WithProperty("encrypt", openapi3.NewBoolSchema()).
+		WithProperty("scheme", openapi3.NewStringSchema().WithEnum("pgp", "smime")).
+		WithProperty("status", openapi3.NewStringSchema().WithEnum("scheduled", "sending", "sent", "failed", "cancelled")).
+		WithProperty("attempts", openapi3.NewInt32Schema()).
+		WithProperty("lastError", openapi3.NewStringSchema()).
+		WithProperty("sendAt", openapi3.NewDateTimeSchema()).
+		WithProperty("nextAttemptAt", openapi3.NewDateTimeSchema()).
+		WithProperty("updatedAt", openapi3.NewDateTimeSchema()).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema())
+
+	sendMessageSchema := openapi3.NewObjectSchema().
+		WithProperty("to", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema().WithFormat("email"))).
+		WithProperty("subject", openapi3.NewStringSchema()).
+		WithProperty("body", openapi3.NewStringSchema()).
+		WithProperty("sendAt", openapi3.NewDateTimeSchema()).
+		WithProperty("sign", openapi3.NewBoolSchema()).
+		WithProperty("encrypt", openapi3.NewBoolSchema()).
+		WithProperty("scheme", openapi3.NewStringSchema().WithEnum("pgp", "smime")).
+		WithProperty("publicKeys", openapi3.NewObjectSchema().WithAdditionalProperties(openapi3.NewStringSchema())).
+		WithRequired([]string{"to", "subject", "body"})
+
+	pgpKeySchema := openapi3.NewObjectSchema().
+		WithProperty("fingerprint", openapi3.NewStringSchema()).
+		WithProperty("publicKey", openapi3.NewStringSchema()).
+		WithProperty("identities", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()))
+
+	uploadPgpKeySchema := openapi3.NewObjectSchema().
+		WithProperty("privateKey", openapi3.NewStringSchema()).
+		WithProperty("passphrase", openapi3.NewStringSchema()).
+		WithRequired([]string{"privateKey"})
+
+	invitationAnswerSchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("accept", openapi3.NewBoolSchema()).
+		WithRequired([]string{"id", "accept"})
+
+	uploadPgpTrustedKeySchema := openapi3.NewObjectSchema().
+		WithProperty("publicKey", openapi3.NewStringSchema()).
+		WithRequired([]string{"publicKey"})
+
+	certificateSchema := openapi3.NewObjectSchema().
+		WithProperty("fingerprint", openapi3.NewStringSchema()).
+		WithProperty("subject", openapi3.NewStringSchema()).
+		WithProperty("issuer", openapi3.NewStringSchema()).
+		WithProperty("serialNumber", openapi3.NewStringSchema()).
+		WithProperty("emails", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema().WithFormat("email"))).
+		WithProperty("notBefore", openapi3.NewDateTimeSchema()).
+		WithProperty("notAfter", openapi3.NewDateTimeSchema())
+
+	uploadCertificateSchema := openapi3.NewObjectSchema().
+		WithProperty("certificate", openapi3.NewStringSchema()).
+		WithProperty("privateKey", openapi3.NewStringSchema()).
+		WithRequired([]string{"certificate", "privateKey"})
+
+	signatureSchema := openapi3.NewObjectSchema().
+		WithProperty("protocol", openapi3.NewStringSchema().WithEnum("pgp", "smime")).
+		WithProperty("status", openapi3.NewStringSchema().WithEnum("valid", "invalid", "unknown_key", "untrusted", "mismatch")).
+		WithProperty("signer", openapi3.NewStringSchema()).
+		WithProperty("certificate", certificateSchema)
+
+	messageSchema := openapi3.NewObjectSchema().
+		WithProperty("uid", openapi3.NewInt32Schema()).
+		WithProperty("from", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema().WithFormat("email"))).
+		WithProperty("to", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema().WithFormat("email"))).
+		WithProperty("cc", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema().WithFormat("email"))).
+		WithProperty("subject", openapi3.NewStringSchema()).
+		WithProperty("date", openapi3.NewDateTimeSchema()).
+		WithProperty("text", openapi3.NewStringSchema()).
+		WithProperty("html", openapi3.NewStringSchema()).
+		WithProperty("encrypted", openapi3.NewBoolSchema()).
+		WithProperty("decrypted", openapi3.NewBoolSchema()).
+		WithProperty("signature", signatureSchema.WithNullable())
+
+	invitationSchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("account", openapi3.NewInt32Schema()).
+		WithProperty("email", openapi3.NewStringSchema().WithFormat("email")).
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("invitedBy", openapi3.NewStringSchema()).
+		WithProperty("expiresAt", openapi3.NewDateTimeSchema()).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema())
+
 	spec.Components.Schemas = openapi3.Schemas{
-		"MailAccount":       &openapi3.SchemaRef{Value: accountSchema},
-		"AddAccountPayload": &openapi3.SchemaRef{Value: addAccountSchema},
+		"MailAccount":         &openapi3.SchemaRef{Value: accountSchema},
+		"ShareInvitation":     &openapi3.SchemaRef{Value: invitationSchema},
+		"InvitationAnswer":    &openapi3.SchemaRef{Value: invitationAnswerSchema},
+		"AddAccountPayload":   &openapi3.SchemaRef{Value: addAccountSchema},
+		"OutboxMessage":       &openapi3.SchemaRef{Value: outboxMessageSchema},
+		"SendMessagePayload":  &openapi3.SchemaRef{Value: sendMessageSchema},
+		"PgpKey":              &openapi3.SchemaRef{Value: pgpKeySchema},
+		"UploadPgpKey":        &openapi3.SchemaRef{Value: uploadPgpKeySchema},
+		"UploadPgpTrustedKey": &openapi3.SchemaRef{Value: uploadPgpTrustedKeySchema},
+		"Certificate":         &openapi3.SchemaRef{Value: certificateSchema},
+		"UploadCertificate":   &openapi3.SchemaRef{Value: uploadCertificateSchema},
+		"Message":             &openapi3.SchemaRef{Value: messageSchema},
 	}
 
 	spec.AddOperation("/", http.MethodGet, &openapi3.Operation{
@@ -100,6 +201,7 @@ func (h *EmailHandler) getSpec() Spec {
 		Responses: openapi3.NewResponses(
 			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Account created successfully")}),
 			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/plain"})).WithDescription("Invalid input")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
 		),
 	})
 
@@ -154,7 +256,7 @@ func (h *EmailHandler) getSpec() Spec {
 	spec.AddOperation("/{email}/share", http.MethodPut, &openapi3.Operation{
 		Tags:        []string{"email"},
 		Summary:     "Share account",
-		Description: "Share an email account with another user",
+		Description: "Invite another user to share an email account. The account is only shared once the user accepts the invitation.",
 		OperationID: "share-email-account",
 		Parameters: openapi3.Parameters{
 			&openapi3.ParameterRef{
@@ -176,7 +278,8 @@ func (h *EmailHandler) getSpec() Spec {
 			},
 		},
 		Responses: openapi3.NewResponses(
-			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Account shared successfully")}),
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invitation sent successfully")}),
+			openapi3.WithStatus(409, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/plain"})).WithDescription("Account is already shared with the user")}),
 		),
 	})
 
@@ -184,7 +287,7 @@ func (h *EmailHandler) getSpec() Spec {
 	spec.AddOperation("/{email}/share", http.MethodDelete, &openapi3.Operation{
 		Tags:        []string{"email"},
 		Summary:     "Remove share",
-		Description: "Stop sharing an email account with a specific user",
+		Description: "Stop sharing an email account with a specific user, or revoke their pending invitation",
 		OperationID: "unshare-email-account",
 		Parameters: openapi3.Parameters{
 			&openapi3.ParameterRef{
@@ -210,81 +313,992 @@ func (h *EmailHandler) getSpec() Spec {
 		),
 	})
 
-	return spec
-}
+	spec.AddOperation("/{email}/send", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"email", "outbox"},
+		Summary:     "Send message",
+		Description: "Schedule a message for delivery. Messages are held back for the undo window, or until sendAt if it is later.",
+		OperationID: "send-email-message",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "email",
+					In:          "path",
+					Required:    true,
+					Description: "The email address to send from",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/SendMessagePayload", sendMessageSchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Message scheduled").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/OutboxMessage", outboxMessageSchema)),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/plain"})).WithDescription("Invalid input")}),
+		),
+	})
+
+	spec.AddOperation("/{email}/outbox", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"email", "outbox"},
+		Summary:     "List outbox",
+		Description: "List the scheduled and past outgoing messages of an email account",
+		OperationID: "list-email-outbox",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Outgoing messages").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(outboxMessageSchema))),
+			}),
+		),
+	})
+
+	spec.AddOperation("/{email}/outbox/{id}", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"email", "outbox"},
+		Summary:     "Cancel message",
+		Description: "Cancel a scheduled message. This is only possible before it is due to be sent.",
+		OperationID: "cancel-email-message",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "id",
+					In:          "path",
+					Required:    true,
+					Description: "The ID of the outgoing message",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewInt32Schema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Message cancelled")}),
+			openapi3.WithStatus(409, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/plain"})).WithDescription("Message can no longer be cancelled")}),
+		),
+	})
+
+	spec.AddOperation("/{email}/pgp", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"email", "pgp"},
+		Summary:     "Get PGP key",
+		Description: "Get the public part of the PGP key of an account",
+		OperationID: "get-email-pgp-key",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("PGP key of the account").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/PgpKey", pgpKeySchema)),
+			}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Account has no PGP key")}),
+		),
+	})
+
+	spec.AddOperation("/{email}/pgp", http.MethodPut, &openapi3.Operation{
+		Tags:        []string{"email", "pgp"},
+		Summary:     "Set PGP key",
+		Description: "Attach a PGP key to an account, replacing any previous one. The private key and passphrase are stored encrypted.",
+		OperationID: "set-email-pgp-key",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/UploadPgpKey", uploadPgpKeySchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("PGP key attached").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/PgpKey", pgpKeySchema)),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/plain"})).WithDescription("Invalid key or passphrase")}),
+		),
+	})
+
+	spec.AddOperation("/{email}/pgp", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"email", "pgp"},
+		Summary:     "Remove PGP key",
+		Description: "Remove the PGP key of an account",
+		OperationID: "remove-email-pgp-key",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("PGP key removed")}),
+		),
+	})
+
+	spec.AddOperation("/{email}/pgp/trusted", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"email", "pgp"},
+		Summary:     "List trusted PGP keys",
+		Description: "List the public keys of the correspondents the account trusts",
+		OperationID: "list-email-pgp-trusted-keys",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Trusted PGP keys of the account").
+					WithJSONSchema(openapi3.NewArraySchema().WithItems(pgpKeySchema)),
+			}),
+		),
+	})
+
+	spec.AddOperation("/{email}/pgp/trusted", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"email", "pgp"},
+		Summary:     "Trust PGP key",
+		Description: "Trust the public key of a correspondent. Signatures made with it are reported as valid when they come from one of its identities.",
+		OperationID: "trust-email-pgp-key",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/UploadPgpTrustedKey", uploadPgpTrustedKeySchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("PGP key trusted").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/PgpKey", pgpKeySchema)),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/plain"})).WithDescription("Invalid key")}),
+		),
+	})
+
+	spec.AddOperation("/{email}/pgp/trusted/{fingerprint}", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"email", "pgp"},
+		Summary:     "Untrust PGP key",
+		Description: "Stop trusting the public key of a correspondent",
+		OperationID: "untrust-email-pgp-key",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "fingerprint",
+					In:          "path",
+					Required:    true,
+					Description: "The fingerprint of the key",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("PGP key no longer trusted")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Key is not trusted")}),
+		),
+	})
+
+	spec.AddOperation("/{email}/smime", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"email", "smime"},
+		Summary:     "Get S/MIME certificate",
+		Description: "Get the S/MIME certificate of an account",
+		OperationID: "get-email-smime-certificate",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("S/MIME certificate of the account").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/Certificate", certificateSchema)),
+			}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Account has no S/MIME certificate")}),
+		),
+	})
+
+	spec.AddOperation("/{email}/smime", http.MethodPut, &openapi3.Operation{
+		Tags:        []string{"email", "smime"},
+		Summary:     "Set S/MIME certificate",
+		Description: "Attach an S/MIME certificate and its private key to an account, replacing any previous one. The certificate must be issued for the account and trusted. The private key is stored encrypted.",
+		OperationID: "set-email-smime-certificate",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/UploadCertificate", uploadCertificateSchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("S/MIME certificate attached").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/Certificate", certificateSchema)),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/plain"})).WithDescription("Invalid or untrusted certificate")}),
+		),
+	})
+
+	spec.AddOperation("/{email}/smime", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"email", "smime"},
+		Summary:     "Remove S/MIME certificate",
+		Description: "Remove the S/MIME certificate of an account",
+		OperationID: "remove-email-smime-certificate",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("S/MIME certificate removed")}),
+		),
+	})
+
+	spec.AddOperation("/{email}/mailboxes/{mailbox}/{uid}", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"email", "messages"},
+		Summary:     "Get message",
+		Description: "Get a message from a mailbox. PGP/MIME and S/MIME messages are decrypted with the key of the account when possible and their signature is verified.",
+		OperationID: "get-email-message",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "email",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:     "mailbox",
+					In:       "path",
+					Required: true,
+					Schema:   &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "uid",
+					In:          "path",
+					Required:    true,
+					Description: "The UID of the message in the mailbox",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewInt32Schema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("The message").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/Message", messageSchema)),
+			}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Mailbox or message does not exist")}),
+		),
+	})
+
+	spec.AddOperation("/invitations", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"email", "invitations"},
+		Summary:     "List invitations",
+		Description: "List the pending share invitations of the authenticated user",
+		OperationID: "list-email-invitations",
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Pending invitations").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(invitationSchema))),
+			}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
+
+	spec.AddOperation("/invitations", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"email", "invitations"},
+		Summary:     "Answer invitation",
+		Description: "Accept a share invitation, giving the authenticated user access to the account, or decline it",
+		OperationID: "answer-email-invitation",
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/InvitationAnswer", invitationAnswerSchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invitation accepted or declined")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invitation does not exist or has expired")}),
+		),
+	})
+
+	return spec
+}
+
+func (h *EmailHandler) createHttpHandler() http.Handler {
+	handler := http.NewServeMux()
+
+	// accounts
+	handler.HandleFunc("GET /", h.handleListAccounts)
+	handler.HandleFunc("PUT /", h.handleAddAccount)
+	handler.Handle("OPTIONS /", middleware.CreateOptionsHandler("GET", "PUT"))
+
+	handler.HandleFunc("GET /{email}", h.handleAccountInfo)
+	handler.HandleFunc("DELETE /{email}", h.handleRemoveAccount)
+	handler.Handle("OPTIONS /{email}", middleware.CreateOptionsHandler("GET", "DELETE"))
+
+	// sharing
+	handler.HandleFunc("PUT /{email}/share", h.handleShareAccount)
+	handler.HandleFunc("DELETE /{email}/share", h.handleRemoveAccountShare)
+	handler.Handle("OPTIONS /{email}/share", middleware.CreateOptionsHandler("PUT", "DELETE"))
+
+	// outbox
+	handler.HandleFunc("POST /{email}/send", h.handleSendMessage)
+	handler.Handle("OPTIONS /{email}/send", middleware.CreateOptionsHandler("POST"))
+
+	handler.HandleFunc("GET /{email}/outbox", h.handleListOutbox)
+	handler.Handle("OPTIONS /{email}/outbox", middleware.CreateOptionsHandler("GET"))
+
+	handler.HandleFunc("DELETE /{email}/outbox/{id}", h.handleCancelMessage)
+	handler.Handle("OPTIONS /{email}/outbox/{id}", middleware.CreateOptionsHandler("DELETE"))
+
+	// pgp
+	handler.HandleFunc("GET /{email}/pgp", h.handleGetPgpKey)
+	handler.HandleFunc("PUT /{email}/pgp", h.handleSetPgpKey)
+	handler.HandleFunc("DELETE /{email}/pgp", h.handleRemovePgpKey)
+	handler.Handle("OPTIONS /{email}/pgp", middleware.CreateOptionsHandler("GET", "PUT", "DELETE"))
+
+	handler.HandleFunc("GET /{email}/pgp/trusted", h.handleListTrustedPgpKeys)
+	handler.HandleFunc("POST /{email}/pgp/trusted", h.handleTrustPgpKey)
+	handler.Handle("OPTIONS /{email}/pgp/trusted", middleware.CreateOptionsHandler("GET", "POST"))
+
+	handler.HandleFunc("DELETE /{email}/pgp/trusted/{fingerprint}", h.handleUntrustPgpKey)
+	handler.Handle("OPTIONS /{email}/pgp/trusted/{fingerprint}", middleware.CreateOptionsHandler("DELETE"))
+
+	// smime
+	handler.HandleFunc("GET /{email}/smime", h.handleGetSmimeCert)
+	handler.HandleFunc("PUT /{email}/smime", h.handleSetSmimeCert)
+	handler.HandleFunc("DELETE /{email}/smime", h.handleRemoveSmimeCert)
+	handler.Handle("OPTIONS /{email}/smime", middleware.CreateOptionsHandler("GET", "PUT", "DELETE"))
+
+	// messages
+	handler.HandleFunc("GET /{email}/mailboxes/{mailbox}/{uid}", h.handleGetMessage)
+	handler.Handle("OPTIONS /{email}/mailboxes/{mailbox}/{uid}", middleware.CreateOptionsHandler("GET"))
+
+	// invitations
+	handler.HandleFunc("GET /invitations", h.handleListInvitations)
+	handler.HandleFunc("POST /invitations", h.handleAnswerInvitation)
+	handler.Handle("OPTIONS /invitations", middleware.CreateOptionsHandler("GET", "POST"))
+
+	return handler
+}
+
+func (h *EmailHandler) handleListAccounts(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	if username := r.URL.Query().Get("user"); username != "" {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	} else {
+		user = requester
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Context:   r.Context(),
+		Actions:   []string{auth.ActionListEmailAccounts},
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.URL.Query().Has("count") {
+		count, err := h.emailService.CountAccounts(r.Context(), user.ID)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strconv.Itoa(int(count))))
+		return
+	}
+
+	accounts, err := h.emailService.ListAccounts(r.Context(), user.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	for i := range accounts {
+		accounts[i].Username = ""
+		accounts[i].Password = ""
+	}
+
+	data, err := json.Marshal(accounts)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *EmailHandler) handleAddAccount(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your creation request with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	params := repository.AddEmailAccountParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	params.OwnerId = user.ID
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: &repository.MailAccount{OwnerId: user.ID},
+		Actions:   []string{auth.ActionCreate},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if _, err = h.emailService.AddAccount(r.Context(), params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+}
+
+func (h *EmailHandler) handleAccountInfo(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	accountInfo, err := h.emailService.GetAccountInfo(r.Context(), account)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: &accountInfo,
+		Actions:   []string{auth.ActionView},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	accountInfo.Username = ""
+	accountInfo.Password = ""
+
+	data, err := json.Marshal(accountInfo)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *EmailHandler) handleRemoveAccount(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionDelete},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.emailService.RemoveAccount(r.Context(), account.ID); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+}
+
+func (h *EmailHandler) handleShareAccount(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionShare},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	sharingUser, err := h.userService.GetUserByUsername(r.Context(), r.URL.Query().Get("user"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	params := repository.AddShareInviteParams{
+		UserId:     sharingUser.ID,
+		Account:    account.ID,
+		InvitedBy:  user.ID,
+		Permission: "",
+	}
+
+	if err := h.emailService.InviteShare(r.Context(), params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+}
+
+func (h *EmailHandler) handleRemoveAccountShare(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionShare},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	sharingUser, err := h.userService.GetUserByUsername(r.Context(), r.URL.Query().Get("user"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.emailService.RemoveShare(r.Context(), sharingUser.ID, account.ID); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+}
+
+func (h *EmailHandler) handleSendMessage(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionSendEmail},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your message with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	message := email.OutgoingMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	scheduled, err := h.emailService.ScheduleMessage(r.Context(), account, user.ID, message)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(scheduled)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *EmailHandler) handleListOutbox(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionSendEmail},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	messages, err := h.emailService.ListOutbox(r.Context(), account.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(messages)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *EmailHandler) handleCancelMessage(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionSendEmail},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		errors.HandleError(w, r, errors.NewError(fmt.Sprintf("id %s is not valid integer %s", idStr, err.Error()), http.StatusBadRequest))
+		return
+	}
+
+	if err := h.emailService.CancelMessage(r.Context(), account.ID, int32(id)); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+}
+
+func (h *EmailHandler) handleGetPgpKey(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionSendEmail},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	key, err := h.emailService.GetPgpKey(r.Context(), account.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *EmailHandler) handleSetPgpKey(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionUpdate},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
 
-func (h *EmailHandler) createHttpHandler() http.Handler {
-	handler := http.NewServeMux()
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your key with the required json payload", http.StatusBadRequest)
+		return
+	}
 
-	// accounts
-	handler.HandleFunc("GET /", h.handleListAccounts)
-	handler.HandleFunc("PUT /", h.handleAddAccount)
-	handler.Handle("OPTIONS /", middleware.CreateOptionsHandler("GET", "PUT"))
+	upload := email.PgpKeyUpload{}
+	if err := json.NewDecoder(r.Body).Decode(&upload); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
 
-	handler.HandleFunc("GET /{email}", h.handleAccountInfo)
-	handler.HandleFunc("DELETE /{email}", h.handleRemoveAccount)
-	handler.Handle("OPTIONS /{email}", middleware.CreateOptionsHandler("GET", "DELETE"))
+	key, err := h.emailService.SetPgpKey(r.Context(), account, upload)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
 
-	// sharing
-	handler.HandleFunc("PUT /{email}/share", h.handleShareAccount)
-	handler.HandleFunc("DELETE /{email}/share", h.handleRemoveAccountShare)
-	handler.Handle("OPTIONS /{email}/share", middleware.CreateOptionsHandler("PUT", "DELETE"))
+	data, err := json.Marshal(key)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
 
-	return handler
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
 }
 
-func (h *EmailHandler) handleListAccounts(w http.ResponseWriter, r *http.Request) {
-	requester, err := h.userService.GetUserFromContext(r.Context())
+func (h *EmailHandler) handleRemovePgpKey(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	var user *repository.User
-	if username := r.URL.Query().Get("user"); username != "" {
-		user, err = h.userService.GetUserByUsername(r.Context(), username)
-		if err != nil {
-			errors.HandleError(w, r, err)
-			return
-		}
-	} else {
-		user = requester
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
 	}
 
 	if err := h.authService.Authorize(&config.AuthRequest{
-		User:      requester,
-		Ressource: user,
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionUpdate},
 		Context:   r.Context(),
-		Actions:   []string{auth.ActionListEmailAccounts},
 	}); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	if r.URL.Query().Has("count") {
-		count, err := h.emailService.CountAccounts(r.Context(), user.ID)
-		if err != nil {
-			errors.HandleError(w, r, err)
-			return
-		}
+	if err := h.emailService.RemovePgpKey(r.Context(), account.ID); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+}
 
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write([]byte(strconv.Itoa(int(count))))
+func (h *EmailHandler) handleListTrustedPgpKeys(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
 		return
 	}
 
-	accounts, err := h.emailService.ListAccounts(r.Context(), user.ID)
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	for i := range accounts {
-		accounts[i].Username = ""
-		accounts[i].Password = ""
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionView},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
 	}
 
-	data, err := json.Marshal(accounts)
+	keys, err := h.emailService.ListTrustedPgpKeys(r.Context(), account.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(keys)
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
@@ -294,32 +1308,57 @@ func (h *EmailHandler) handleListAccounts(w http.ResponseWriter, r *http.Request
 	w.Write(data)
 }
 
-func (h *EmailHandler) handleAddAccount(w http.ResponseWriter, r *http.Request) {
+func (h *EmailHandler) handleTrustPgpKey(w http.ResponseWriter, r *http.Request) {
 	user, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionUpdate},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
 	if r.Header.Get("Content-Type") != "application/json" {
-		http.Error(w, "please submit your creation request with the required json payload", http.StatusBadRequest)
+		http.Error(w, "please submit the key with the required json payload", http.StatusBadRequest)
 		return
 	}
 
-	params := repository.AddEmailAccountParams{}
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+	upload := email.PgpTrustedKeyUpload{}
+	if err := json.NewDecoder(r.Body).Decode(&upload); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	params.OwnerId = user.ID
-	if _, err = h.emailService.AddAccount(r.Context(), params); err != nil {
+	key, err := h.emailService.TrustPgpKey(r.Context(), account.ID, upload)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(key)
+	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
 }
 
-func (h *EmailHandler) handleAccountInfo(w http.ResponseWriter, r *http.Request) {
+func (h *EmailHandler) handleUntrustPgpKey(w http.ResponseWriter, r *http.Request) {
 	user, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
@@ -332,7 +1371,30 @@ func (h *EmailHandler) handleAccountInfo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	accountInfo, err := h.emailService.GetAccountInfo(r.Context(), account)
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: account,
+		Actions:   []string{auth.ActionUpdate},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.emailService.UntrustPgpKey(r.Context(), account.ID, r.PathValue("fingerprint")); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+}
+
+func (h *EmailHandler) handleGetSmimeCert(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
@@ -340,18 +1402,21 @@ func (h *EmailHandler) handleAccountInfo(w http.ResponseWriter, r *http.Request)
 
 	if err := h.authService.Authorize(&config.AuthRequest{
 		User:      user,
-		Ressource: &accountInfo,
-		Actions:   []string{auth.ActionView},
+		Ressource: account,
+		Actions:   []string{auth.ActionSendEmail},
 		Context:   r.Context(),
 	}); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	accountInfo.Username = ""
-	accountInfo.Password = ""
+	certificate, err := h.emailService.GetSmimeCert(r.Context(), account.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
 
-	data, err := json.Marshal(accountInfo)
+	data, err := json.Marshal(certificate)
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
@@ -361,7 +1426,7 @@ func (h *EmailHandler) handleAccountInfo(w http.ResponseWriter, r *http.Request)
 	w.Write(data)
 }
 
-func (h *EmailHandler) handleRemoveAccount(w http.ResponseWriter, r *http.Request) {
+func (h *EmailHandler) handleSetSmimeCert(w http.ResponseWriter, r *http.Request) {
 	user, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
@@ -377,20 +1442,41 @@ func (h *EmailHandler) handleRemoveAccount(w http.ResponseWriter, r *http.Reques
 	if err := h.authService.Authorize(&config.AuthRequest{
 		User:      user,
 		Ressource: account,
-		Actions:   []string{auth.ActionDelete},
+		Actions:   []string{auth.ActionUpdate},
 		Context:   r.Context(),
 	}); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	if err := h.emailService.RemoveAccount(r.Context(), account.ID); err != nil {
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your certificate with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	upload := email.SmimeCertificateUpload{}
+	if err := json.NewDecoder(r.Body).Decode(&upload); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	certificate, err := h.emailService.SetSmimeCert(r.Context(), account, upload)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(certificate)
+	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
 }
 
-func (h *EmailHandler) handleShareAccount(w http.ResponseWriter, r *http.Request) {
+func (h *EmailHandler) handleRemoveSmimeCert(w http.ResponseWriter, r *http.Request) {
 	user, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
@@ -406,39 +1492,33 @@ func (h *EmailHandler) handleShareAccount(w http.ResponseWriter, r *http.Request
 	if err := h.authService.Authorize(&config.AuthRequest{
 		User:      user,
 		Ressource: account,
-		Actions:   []string{auth.ActionShare},
+		Actions:   []string{auth.ActionUpdate},
 		Context:   r.Context(),
 	}); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	sharingUser, err := h.userService.GetUserByUsername(r.Context(), r.URL.Query().Get("user"))
-	if err != nil {
+	if err := h.emailService.RemoveSmimeCert(r.Context(), account.ID); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
+}
 
-	params := repository.AddShareParams{
-		UserId:     sharingUser.ID,
-		Account:    account.ID,
-		Permission: "",
-	}
-
-	if err := h.emailService.AddShare(r.Context(), params); err != nil {
+func (h *EmailHandler) handleGetMessage(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
-}
 
-func (h *EmailHandler) handleRemoveAccountShare(w http.ResponseWriter, r *http.Request) {
-	user, err := h.userService.GetUserFromContext(r.Context())
+	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	account, err := h.emailService.GetAccountByEmail(r.Context(), r.PathValue("email"))
+	accountInfo, err := h.emailService.GetAccountShareInfo(r.Context(), account)
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
@@ -446,22 +1526,105 @@ func (h *EmailHandler) handleRemoveAccountShare(w http.ResponseWriter, r *http.R
 
 	if err := h.authService.Authorize(&config.AuthRequest{
 		User:      user,
-		Ressource: account,
-		Actions:   []string{auth.ActionShare},
+		Ressource: &accountInfo,
+		Actions:   []string{auth.ActionView},
 		Context:   r.Context(),
 	}); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	sharingUser, err := h.userService.GetUserByUsername(r.Context(), r.URL.Query().Get("user"))
+	uidStr := r.PathValue("uid")
+	uid, err := strconv.ParseUint(uidStr, 10, 32)
+	if err != nil {
+		errors.HandleError(w, r, errors.NewError(fmt.Sprintf("uid %s is not valid integer %s", uidStr, err.Error()), http.StatusBadRequest))
+		return
+	}
+
+	message, err := h.emailService.FetchMessage(r.Context(), account, r.PathValue("mailbox"), uint32(uid))
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	if err := h.emailService.RemoveShare(r.Context(), sharingUser.ID, account.ID); err != nil {
+	data, err := json.Marshal(message)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *EmailHandler) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	user, err := h.authorizeInvitations(r, auth.ActionViewEmailInvitations)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	invitations, err := h.emailService.ListInvitations(r.Context(), user.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(invitations)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *EmailHandler) handleAnswerInvitation(w http.ResponseWriter, r *http.Request) {
+	user, err := h.authorizeInvitations(r, auth.ActionAnswerEmailInvitations)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your answer with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	answer := email.InvitationAnswer{}
+	if err := json.NewDecoder(r.Body).Decode(&answer); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if answer.Accept {
+		err = h.emailService.AcceptInvitation(r.Context(), user.ID, answer.ID)
+	} else {
+		err = h.emailService.DeclineInvitation(r.Context(), user.ID, answer.ID)
+	}
+
+	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 }
+
+// authorizeInvitations returns the requester if they may take action on their
+// own invitations
+func (h *EmailHandler) authorizeInvitations(r *http.Request, action string) (*repository.User, error) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: user,
+		Actions:   []string{action},
+		Context:   r.Context(),
+	}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
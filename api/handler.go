@@ -12,6 +12,7 @@ import (
 	"github.com/piquel-fr/api/services/auth"
 	"github.com/piquel-fr/api/services/email"
 	"github.com/piquel-fr/api/services/users"
+	"github.com/piquel-fr/api/utils/errors"
 	"github.com/piquel-fr/api/utils/middleware"
 )
 
@@ -31,15 +32,20 @@ func CreateRouter(userService users.UserService, authService auth.AuthService, e
 	router.HandleFunc("/{$}", rootHandler)
 	router.Handle("/auth/", http.StripPrefix("/auth", CreateAuthHandler(userService, authService).createHttpHandler()))
 
-	configHandler, err := configHandler()
+	router.HandleFunc("/config.json", configHandler)
+	router.HandleFunc("GET /.well-known/jwks.json", jwksHandler(authService))
+
+	metadataHandler, err := oauthMetadataHandler()
 	if err != nil {
 		return nil, err
 	}
-	router.HandleFunc("/config.json", configHandler)
+	router.HandleFunc("GET /.well-known/oauth-authorization-server", metadataHandler)
 
 	handlers := []Handler{
 		CreateUserHandler(userService, authService),
 		CreateEmailHandler(userService, authService, emailService),
+		CreateAdminHandler(userService, authService, emailService),
+		CreateOAuthHandler(userService, authService),
 	}
 
 	for _, handler := range handlers {
@@ -77,14 +83,54 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Welcome to the Piquel API! Visit the <a href=\"https://piquel.fr/docs\">API</a> for more information."))
 }
 
-func configHandler() (http.HandlerFunc, error) {
+// configHandler is marshalled on every request as the policy can be reloaded
+func configHandler(w http.ResponseWriter, r *http.Request) {
 	data, err := json.Marshal(config.GetPublicConfig())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// jwksHandler publishes the public keys access tokens are signed with, so
+// that other services can verify them without calling the API
+func jwksHandler(authService auth.AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(authService.GetJWKS())
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write(data)
+	}
+}
+
+// oauthMetadataHandler describes the OAuth server to clients, see RFC 8414
+func oauthMetadataHandler() (http.HandlerFunc, error) {
+	data, err := json.Marshal(map[string]any{
+		"issuer":                                config.Envs.Url,
+		"authorization_endpoint":                config.Envs.Url + "/auth/authorize",
+		"token_endpoint":                        config.Envs.Url + "/auth/token",
+		"introspection_endpoint":                config.Envs.Url + "/auth/introspect",
+		"revocation_endpoint":                   config.Envs.Url + "/auth/revoke",
+		"jwks_uri":                              config.Envs.Url + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{auth.GrantAuthorizationCode, auth.GrantRefreshToken, auth.GrantClientCredentials},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Content-Type", "application/json")
+		w.Header().Set("Content-Type", "application/json")
 		w.Write(data)
 	}, nil
 }
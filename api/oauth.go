@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/services/auth"
+	"github.com/piquel-fr/api/services/users"
+	"github.com/piquel-fr/api/utils/errors"
+	"github.com/piquel-fr/api/utils/middleware"
+)
+
+// OAuthHandler serves the consent screen of the OAuth server, the rest of the
+// flow is unauthenticated and lives under /auth
+type OAuthHandler struct {
+	userService users.UserService
+	authService auth.AuthService
+}
+
+func CreateOAuthHandler(userService users.UserService, authService auth.AuthService) *OAuthHandler {
+	return &OAuthHandler{userService, authService}
+}
+
+func (h *OAuthHandler) getName() string { return "oauth" }
+
+func (h *OAuthHandler) getSpec() Spec {
+	spec := newSpecBase(h)
+
+	consentSchema := openapi3.NewObjectSchema().
+		WithProperty("clientId", openapi3.NewStringSchema()).
+		WithProperty("clientName", openapi3.NewStringSchema()).
+		WithProperty("redirectUri", openapi3.NewStringSchema()).
+		WithProperty("scopes", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
+		WithRequired([]string{"clientId", "clientName", "redirectUri", "scopes"})
+
+	consentAnswerSchema := openapi3.NewObjectSchema().
+		WithProperty("response_type", openapi3.NewStringSchema()).
+		WithProperty("client_id", openapi3.NewStringSchema()).
+		WithProperty("redirect_uri", openapi3.NewStringSchema()).
+		WithProperty("scope", openapi3.NewStringSchema()).
+		WithProperty("state", openapi3.NewStringSchema()).
+		WithProperty("code_challenge", openapi3.NewStringSchema()).
+		WithProperty("code_challenge_method", openapi3.NewStringSchema()).
+		WithProperty("approved", openapi3.NewBoolSchema()).
+		WithRequired([]string{"response_type", "client_id", "redirect_uri", "scope", "code_challenge", "code_challenge_method", "approved"})
+
+	redirectSchema := openapi3.NewObjectSchema().
+		WithProperty("redirectTo", openapi3.NewStringSchema()).
+		WithRequired([]string{"redirectTo"})
+
+	spec.Components.Schemas = openapi3.Schemas{
+		"OAuthConsent":       &openapi3.SchemaRef{Value: consentSchema},
+		"OAuthConsentAnswer": &openapi3.SchemaRef{Value: consentAnswerSchema},
+		"OAuthRedirect":      &openapi3.SchemaRef{Value: redirectSchema},
+	}
+
+	parameters := openapi3.Parameters{}
+	for _, name := range []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method"} {
+		parameters = append(parameters, &openapi3.ParameterRef{
+			Value: &openapi3.Parameter{
+				Name:        name,
+				In:          "query",
+				Required:    name != "state",
+				Description: "Passed on from the authorization request of the app",
+				Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+			},
+		})
+	}
+
+	spec.AddOperation("/authorize", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"oauth"},
+		Summary:     "Get consent",
+		Description: "Validate the authorization request an app sent to /auth/authorize, and describe what the user is asked to allow",
+		OperationID: "get-oauth-consent",
+		Parameters:  parameters,
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Authorization request is valid").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/OAuthConsent", consentSchema)),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid authorization request")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
+
+	spec.AddOperation("/authorize", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"oauth"},
+		Summary:     "Answer consent",
+		Description: "Approve or deny the authorization request. The user is then sent back to the app with the returned URL, carrying an authorization code or an error. Only possible from a browser session",
+		OperationID: "answer-oauth-consent",
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/OAuthConsentAnswer", consentAnswerSchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Consent answered").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/OAuthRedirect", redirectSchema)),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid client or redirect URI")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
+
+	return spec
+}
+
+func (h *OAuthHandler) createHttpHandler() http.Handler {
+	handler := http.NewServeMux()
+
+	handler.HandleFunc("GET /authorize", h.handleGetConsent)
+	handler.HandleFunc("POST /authorize", h.handleAnswerConsent)
+	handler.Handle("OPTIONS /authorize", middleware.CreateOptionsHandler("GET", "POST"))
+
+	return handler
+}
+
+type consentAnswer struct {
+	auth.AuthorizationRequest
+	Approved bool `json:"approved"`
+}
+
+func (h *OAuthHandler) handleGetConsent(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: user,
+		Actions:   []string{auth.ActionAuthorizeOAuthClients},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	consent, err := h.authService.GetOAuthConsent(r.Context(), user, auth.AuthorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientId:            query.Get("client_id"),
+		RedirectUri:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	})
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(consent)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *OAuthHandler) handleAnswerConsent(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: user,
+		Actions:   []string{auth.ActionAuthorizeOAuthClients},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your answer with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	answer := consentAnswer{}
+	if err := json.NewDecoder(r.Body).Decode(&answer); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	redirectTo, err := h.authService.AnswerOAuthConsent(r.Context(), user, answer.AuthorizationRequest, answer.Approved)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(struct {
+		RedirectTo string `json:"redirectTo"`
+	}{redirectTo})
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -36,8 +36,15 @@ func (h *UserHandler) getSpec() Spec {
 		WithProperty("image", openapi3.NewStringSchema()).
 		WithProperty("email", openapi3.NewStringSchema().WithFormat("email")).
 		WithProperty("role", openapi3.NewStringSchema()).
+		WithProperty("roleVersion", openapi3.NewInt32Schema()).
+		WithProperty("kind", openapi3.NewStringSchema()).
 		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
-		WithRequired([]string{"id", "username", "name", "image", "role", "createdAt"})
+		WithRequired([]string{"id", "username", "name", "image", "role", "roleVersion", "kind", "createdAt"})
+
+	selfSchema := openapi3.NewAllOfSchema(userSchema, openapi3.NewObjectSchema().
+		WithProperty("impersonated", openapi3.NewBoolSchema()).
+		WithProperty("impersonatedBy", openapi3.NewStringSchema()).
+		WithRequired([]string{"impersonated"}))
 
 	updateUserSchema := openapi3.NewObjectSchema().
 		WithProperty("username", openapi3.NewStringSchema()).
@@ -56,27 +63,155 @@ func (h *UserHandler) getSpec() Spec {
 	userSessionSchema := openapi3.NewObjectSchema().
 		WithProperty("id", openapi3.NewInt32Schema()).
 		WithProperty("userId", openapi3.NewInt32Schema()).
+		WithProperty("actorId", openapi3.NewInt32Schema().WithNullable()).
 		WithProperty("userAgent", openapi3.NewStringSchema()).
 		WithProperty("ipAdress", openapi3.NewStringSchema()).
+		WithProperty("browser", openapi3.NewStringSchema()).
+		WithProperty("os", openapi3.NewStringSchema()).
+		WithProperty("device", openapi3.NewStringSchema().WithEnum("desktop", "mobile", "tablet", "bot", "unknown")).
+		WithProperty("newDevice", openapi3.NewBoolSchema()).
+		WithProperty("lastIpAdress", openapi3.NewStringSchema()).
+		WithProperty("lastSeenAt", openapi3.NewDateTimeSchema()).
+		WithProperty("expiresAt", openapi3.NewDateTimeSchema()).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"id", "userId", "userAgent", "ipAdress", "browser", "os", "device", "newDevice", "lastIpAdress", "lastSeenAt", "expiresAt", "createdAt"})
+
+	userIdentitySchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("userId", openapi3.NewInt32Schema()).
+		WithProperty("provider", openapi3.NewStringSchema()).
+		WithProperty("subject", openapi3.NewStringSchema()).
+		WithProperty("email", openapi3.NewStringSchema().WithFormat("email")).
+		WithProperty("verified", openapi3.NewBoolSchema()).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"id", "userId", "provider", "subject", "email", "verified", "createdAt"})
+
+	linkIdentitySchema := openapi3.NewObjectSchema().
+		WithProperty("url", openapi3.NewStringSchema()).
+		WithRequired([]string{"url"})
+
+	userTokenSchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("userId", openapi3.NewInt32Schema()).
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("scopes", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
+		WithProperty("expiresAt", openapi3.NewDateTimeSchema()).
+		WithProperty("lastUsedAt", openapi3.NewDateTimeSchema().WithNullable()).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"id", "userId", "name", "scopes", "expiresAt", "lastUsedAt", "createdAt"})
+
+	createdTokenSchema := openapi3.NewObjectSchema().
+		WithProperty("token", openapi3.NewStringSchema()).
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("userId", openapi3.NewInt32Schema()).
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("scopes", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
+		WithProperty("expiresAt", openapi3.NewDateTimeSchema()).
+		WithProperty("lastUsedAt", openapi3.NewDateTimeSchema().WithNullable()).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"token", "id", "userId", "name", "scopes", "expiresAt", "lastUsedAt", "createdAt"})
+
+	createTokenSchema := openapi3.NewObjectSchema().
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("scopes", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
 		WithProperty("expiresAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"name", "scopes", "expiresAt"})
+
+	oauthClientSchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewStringSchema()).
+		WithProperty("ownerId", openapi3.NewInt32Schema()).
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("redirectUris", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"id", "ownerId", "name", "redirectUris", "createdAt"})
+
+	createdOAuthClientSchema := openapi3.NewObjectSchema().
+		WithProperty("clientSecret", openapi3.NewStringSchema()).
+		WithProperty("id", openapi3.NewStringSchema()).
+		WithProperty("ownerId", openapi3.NewInt32Schema()).
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("redirectUris", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"id", "ownerId", "name", "redirectUris", "createdAt"})
+
+	createOAuthClientSchema := openapi3.NewObjectSchema().
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("redirectUris", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
+		WithProperty("confidential", openapi3.NewBoolSchema()).
+		WithRequired([]string{"name", "redirectUris", "confidential"})
+
+	authorizationSchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("clientId", openapi3.NewStringSchema()).
+		WithProperty("clientName", openapi3.NewStringSchema()).
+		WithProperty("scopes", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
+		WithProperty("lastUsedAt", openapi3.NewDateTimeSchema().WithNullable()).
+		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
+		WithRequired([]string{"id", "clientId", "clientName", "scopes", "lastUsedAt", "createdAt"})
+
+	twoFactorSchema := openapi3.NewObjectSchema().
+		WithProperty("enabled", openapi3.NewBoolSchema()).
+		WithProperty("recoveryCodesLeft", openapi3.NewInt32Schema()).
+		WithRequired([]string{"enabled", "recoveryCodesLeft"})
+
+	twoFactorCodeSchema := openapi3.NewObjectSchema().
+		WithProperty("code", openapi3.NewStringSchema()).
+		WithProperty("recoveryCode", openapi3.NewStringSchema())
+
+	twoFactorEnrollmentSchema := openapi3.NewObjectSchema().
+		WithProperty("secret", openapi3.NewStringSchema()).
+		WithProperty("uri", openapi3.NewStringSchema()).
+		WithProperty("qrCode", openapi3.NewStringSchema()).
+		WithRequired([]string{"secret", "uri", "qrCode"})
+
+	twoFactorVerifySchema := openapi3.NewObjectSchema().
+		WithProperty("code", openapi3.NewStringSchema()).
+		WithRequired([]string{"code"})
+
+	passkeySchema := openapi3.NewObjectSchema().
+		WithProperty("id", openapi3.NewInt32Schema()).
+		WithProperty("userId", openapi3.NewInt32Schema()).
+		WithProperty("name", openapi3.NewStringSchema()).
+		WithProperty("credentialId", openapi3.NewBytesSchema()).
+		WithProperty("publicKey", openapi3.NewBytesSchema()).
+		WithProperty("attestationType", openapi3.NewStringSchema()).
+		WithProperty("transports", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema())).
+		WithProperty("aaguid", openapi3.NewBytesSchema()).
+		WithProperty("signCount", openapi3.NewInt64Schema()).
+		WithProperty("backupEligible", openapi3.NewBoolSchema()).
+		WithProperty("backupState", openapi3.NewBoolSchema()).
 		WithProperty("createdAt", openapi3.NewDateTimeSchema()).
-		WithRequired([]string{"id", "userId", "userAgent", "ipAdress", "expiresAt", "createdAt"})
+		WithRequired([]string{"id", "userId", "name", "credentialId", "publicKey", "attestationType", "transports", "aaguid", "signCount", "backupEligible", "backupState", "createdAt"})
 
 	spec.Components.Schemas = openapi3.Schemas{
-		"User":                  &openapi3.SchemaRef{Value: userSchema},
-		"UpdateUserParams":      &openapi3.SchemaRef{Value: updateUserSchema},
-		"UpdateUserAdminParams": &openapi3.SchemaRef{Value: updateUserAdminSchema},
-		"UserSession":           &openapi3.SchemaRef{Value: userSessionSchema},
+		"User":                    &openapi3.SchemaRef{Value: userSchema},
+		"SelfUser":                &openapi3.SchemaRef{Value: selfSchema},
+		"UpdateUserParams":        &openapi3.SchemaRef{Value: updateUserSchema},
+		"UpdateUserAdminParams":   &openapi3.SchemaRef{Value: updateUserAdminSchema},
+		"UserSession":             &openapi3.SchemaRef{Value: userSessionSchema},
+		"UserIdentity":            &openapi3.SchemaRef{Value: userIdentitySchema},
+		"LinkIdentityResponse":    &openapi3.SchemaRef{Value: linkIdentitySchema},
+		"UserToken":               &openapi3.SchemaRef{Value: userTokenSchema},
+		"CreatedUserToken":        &openapi3.SchemaRef{Value: createdTokenSchema},
+		"CreateUserTokenParams":   &openapi3.SchemaRef{Value: createTokenSchema},
+		"OAuthClient":             &openapi3.SchemaRef{Value: oauthClientSchema},
+		"CreatedOAuthClient":      &openapi3.SchemaRef{Value: createdOAuthClientSchema},
+		"CreateOAuthClientParams": &openapi3.SchemaRef{Value: createOAuthClientSchema},
+		"Authorization":           &openapi3.SchemaRef{Value: authorizationSchema},
+		"TwoFactorStatus":         &openapi3.SchemaRef{Value: twoFactorSchema},
+		"TwoFactorEnrollment":     &openapi3.SchemaRef{Value: twoFactorEnrollmentSchema},
+		"TwoFactorVerifyParams":   &openapi3.SchemaRef{Value: twoFactorVerifySchema},
+		"Passkey":                 &openapi3.SchemaRef{Value: passkeySchema},
 	}
 
 	spec.AddOperation("/self", http.MethodGet, &openapi3.Operation{
 		Tags:        []string{"users"},
 		Summary:     "Get self user object",
-		Description: "Get the user that is associated with the auth",
+		Description: "Get the user that is associated with the auth, flagged if an admin is impersonating them",
 		OperationID: "get-self",
 		Responses: openapi3.NewResponses(
 			openapi3.WithStatus(200, &openapi3.ResponseRef{
-				Value: openapi3.NewResponse().WithDescription("User profile found").WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/User", userSchema)),
+				Value: openapi3.NewResponse().WithDescription("User profile found").WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/SelfUser", selfSchema)),
 			}),
 		),
 	})
@@ -245,201 +380,1601 @@ func (h *UserHandler) getSpec() Spec {
 		),
 	})
 
-	return spec
-}
+	spec.AddOperation("/{user}/identities", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"users", "identities"},
+		Summary:     "Get user identities",
+		Description: "Get the OAuth identities linked to the specified user",
+		OperationID: "get-user-identities",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("User identities found").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(userIdentitySchema))),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
 
-func (h *UserHandler) createHttpHandler() http.Handler {
-	handler := http.NewServeMux()
+	spec.AddOperation("/{user}/identities", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"users", "identities"},
+		Summary:     "Unlink user identity",
+		Description: "Unlink the identity with the given 'id' from the user. The last identity of a user can't be unlinked",
+		OperationID: "delete-user-identity",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "id",
+					In:          "query",
+					Required:    true,
+					Description: "The identity ID to unlink",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewInt32Schema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Identity unlinked successfully")}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid input")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Identity not found")}),
+			openapi3.WithStatus(409, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("The identity is the last one of the user")}),
+		),
+	})
 
-	handler.HandleFunc("GET /self", h.handleGetSelf)
-	handler.Handle("OPTIONS /self", middleware.CreateOptionsHandler("GET"))
+	spec.AddOperation("/{user}/identities/{provider}", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"users", "identities"},
+		Summary:     "Link user identity",
+		Description: "Start linking an identity from the provider to the user. The client has to be sent to the returned URL, the identity is linked once the provider redirects back to the callback",
+		OperationID: "link-user-identity",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "provider",
+					In:          "path",
+					Required:    true,
+					Description: "The OAuth provider",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "redirectTo",
+					In:          "query",
+					Required:    false,
+					Description: "Where to redirect once the identity is linked",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Link flow started").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/LinkIdentityResponse", linkIdentitySchema)),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Provider does not exist")}),
+		),
+	})
 
-	handler.HandleFunc("GET /{user}", h.handleGetUser)
-	handler.HandleFunc("PUT /{user}", h.handlePutUser)
-	handler.HandleFunc("DELETE /{user}", h.handleDeleteUser)
-	handler.Handle("OPTIONS /{user}", middleware.CreateOptionsHandler("GET", "PUT", "DELETE"))
+	spec.AddOperation("/{user}/tokens", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"users", "tokens"},
+		Summary:     "Get user tokens",
+		Description: "Get the personal access tokens of the specified user",
+		OperationID: "get-user-tokens",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("User tokens found").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(userTokenSchema))),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
 
-	handler.HandleFunc("PUT /{user}/admin", h.handlePutUserAdmin)
-	handler.Handle("OPTIONS /{user}/admin", middleware.CreateOptionsHandler("PUT"))
+	spec.AddOperation("/{user}/tokens", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"users", "tokens"},
+		Summary:     "Create user token",
+		Description: "Create a personal access token for the user. The token is only returned once, and is limited to its scopes (resource:action) within the permissions of the user",
+		OperationID: "create-user-token",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/CreateUserTokenParams", createTokenSchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Token created").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/CreatedUserToken", createdTokenSchema)),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid input or json")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden or scope not allowed")}),
+		),
+	})
 
-	handler.HandleFunc("GET /{user}/sessions", h.handleGetUserSessions)
-	handler.HandleFunc("DELETE /{user}/sessions", h.handleDeleteUserSessions)
-	handler.Handle("OPTIONS /{user}/sessions", middleware.CreateOptionsHandler("GET", "DELETE"))
+	spec.AddOperation("/{user}/tokens", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"users", "tokens"},
+		Summary:     "Revoke user token",
+		Description: "Revoke the personal access token with the given 'id'",
+		OperationID: "delete-user-token",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "id",
+					In:          "query",
+					Required:    true,
+					Description: "The token ID to revoke",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewInt32Schema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Token revoked successfully")}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid input")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Token not found")}),
+		),
+	})
 
-	return handler
-}
+	spec.AddOperation("/{user}/apps", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"users", "apps"},
+		Summary:     "Get user apps",
+		Description: "Get the OAuth apps registered by the specified user",
+		OperationID: "get-user-apps",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("User apps found").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(oauthClientSchema))),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
 
-func (h *UserHandler) handleGetSelf(w http.ResponseWriter, r *http.Request) {
-	user, err := h.userService.GetUserFromContext(r.Context())
-	if err != nil {
-		errors.HandleError(w, r, err)
-		return
-	}
+	spec.AddOperation("/{user}/apps", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"users", "apps"},
+		Summary:     "Register app",
+		Description: "Register an OAuth app that can act on behalf of users who authorize it. Confidential apps get a client secret, which is only returned once. Every app has to use PKCE",
+		OperationID: "create-user-app",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/CreateOAuthClientParams", createOAuthClientSchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("App registered").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/CreatedOAuthClient", createdOAuthClientSchema)),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid input or json")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
 
-	w.Header().Set("Content-Type", "application/json")
+	spec.AddOperation("/{user}/apps", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"users", "apps"},
+		Summary:     "Delete app",
+		Description: "Delete the OAuth app with the given 'id', every grant given to it is revoked",
+		OperationID: "delete-user-app",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "id",
+					In:          "query",
+					Required:    true,
+					Description: "The client ID of the app",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("App deleted successfully")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("App not found")}),
+		),
+	})
+
+	spec.AddOperation("/{user}/authorizations", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"users", "apps"},
+		Summary:     "Get user authorizations",
+		Description: "Get the apps the specified user authorized to act on their behalf",
+		OperationID: "get-user-authorizations",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("User authorizations found").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(authorizationSchema))),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
+
+	spec.AddOperation("/{user}/authorizations", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"users", "apps"},
+		Summary:     "Revoke authorization",
+		Description: "Revoke the authorization with the given 'id', the tokens of the app stop working immediately",
+		OperationID: "delete-user-authorization",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "id",
+					In:          "query",
+					Required:    true,
+					Description: "The authorization ID to revoke",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewInt32Schema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Authorization revoked successfully")}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid input")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Authorization not found")}),
+		),
+	})
+
+	spec.AddOperation("/{user}/2fa", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"users", "2fa"},
+		Summary:     "Get two factor status",
+		Description: "Get whether two factor authentication is enabled for the user",
+		OperationID: "get-user-2fa",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Two factor status found").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/TwoFactorStatus", twoFactorSchema)),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
+
+	spec.AddOperation("/{user}/2fa", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"users", "2fa"},
+		Summary:     "Enroll two factor authentication",
+		Description: "Generate a new TOTP secret for the user. Two factor authentication is enabled once a first code is verified",
+		OperationID: "enroll-user-2fa",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Secret generated").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/TwoFactorEnrollment", twoFactorEnrollmentSchema)),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(409, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Two factor authentication is already enabled")}),
+		),
+	})
+
+	spec.AddOperation("/{user}/2fa", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"users", "2fa"},
+		Summary:     "Disable two factor authentication",
+		Description: "Disable two factor authentication and remove the recovery codes of the user. Users disabling their own need a code from their authenticator app or a recovery code",
+		OperationID: "disable-user-2fa",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Description: "Required when disabling your own two factor authentication",
+				Content:     openapi3.NewContentWithJSONSchema(twoFactorCodeSchema),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Two factor authentication disabled")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized or invalid code")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(429, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Too many invalid codes")}),
+		),
+	})
+
+	spec.AddOperation("/{user}/2fa/verify", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"users", "2fa"},
+		Summary:     "Verify two factor authentication",
+		Description: "Verify a first code to enable two factor authentication. The recovery codes are returned, they are never shown again",
+		OperationID: "verify-user-2fa",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		RequestBody: &openapi3.RequestBodyRef{
+			Value: &openapi3.RequestBody{
+				Required: true,
+				Content: openapi3.NewContentWithJSONSchemaRef(
+					openapi3.NewSchemaRef("#/components/schemas/TwoFactorVerifyParams", twoFactorVerifySchema),
+				),
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("Two factor authentication enabled, recovery codes returned").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()))),
+			}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid input or json")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized or invalid code")}),
+			openapi3.WithStatus(409, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Two factor authentication is already enabled")}),
+		),
+	})
+
+	spec.AddOperation("/{user}/passkeys", http.MethodGet, &openapi3.Operation{
+		Tags:        []string{"users", "passkeys"},
+		Summary:     "Get user passkeys",
+		Description: "Get the passkeys registered by the user. Passkeys are registered through /auth/webauthn/register",
+		OperationID: "get-user-passkeys",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{
+				Value: openapi3.NewResponse().
+					WithDescription("User passkeys found").
+					WithJSONSchemaRef(openapi3.NewSchemaRef("", openapi3.NewArraySchema().WithItems(passkeySchema))),
+			}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+		),
+	})
+
+	spec.AddOperation("/{user}/passkeys", http.MethodDelete, &openapi3.Operation{
+		Tags:        []string{"users", "passkeys"},
+		Summary:     "Delete user passkey",
+		Description: "Delete the passkey with the given 'id'",
+		OperationID: "delete-user-passkey",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "id",
+					In:          "query",
+					Required:    true,
+					Description: "The passkey ID to delete",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewInt32Schema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Passkey deleted successfully")}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Invalid input")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Passkey not found")}),
+		),
+	})
+
+	spec.AddOperation("/{user}/impersonate", http.MethodPost, &openapi3.Operation{
+		Tags:        []string{"users", "admin"},
+		Summary:     "Impersonate user",
+		Description: "Replace the session of the admin with a one hour session for the user. Mutating requests are recorded in the audit log and sensitive actions are forbidden. The impersonation is stopped with DELETE /auth/impersonate",
+		OperationID: "impersonate-user",
+		Parameters: openapi3.Parameters{
+			&openapi3.ParameterRef{
+				Value: &openapi3.Parameter{
+					Name:        "user",
+					In:          "path",
+					Required:    true,
+					Description: "The username",
+					Schema:      &openapi3.SchemaRef{Value: openapi3.NewStringSchema()},
+				},
+			},
+		},
+		Responses: openapi3.NewResponses(
+			openapi3.WithStatus(200, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Impersonation started, the session cookies are set")}),
+			openapi3.WithStatus(400, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Cannot impersonate yourself")}),
+			openapi3.WithStatus(401, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Unauthorized")}),
+			openapi3.WithStatus(403, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("Forbidden")}),
+			openapi3.WithStatus(404, &openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("User not found")}),
+		),
+	})
+
+	return spec
+}
+
+func (h *UserHandler) createHttpHandler() http.Handler {
+	handler := http.NewServeMux()
+
+	handler.HandleFunc("GET /self", h.handleGetSelf)
+	handler.Handle("OPTIONS /self", middleware.CreateOptionsHandler("GET"))
+
+	handler.HandleFunc("GET /{user}", h.handleGetUser)
+	handler.HandleFunc("PUT /{user}", h.handlePutUser)
+	handler.HandleFunc("DELETE /{user}", h.handleDeleteUser)
+	handler.Handle("OPTIONS /{user}", middleware.CreateOptionsHandler("GET", "PUT", "DELETE"))
+
+	handler.HandleFunc("PUT /{user}/admin", h.handlePutUserAdmin)
+	handler.Handle("OPTIONS /{user}/admin", middleware.CreateOptionsHandler("PUT"))
+
+	handler.HandleFunc("GET /{user}/sessions", h.handleGetUserSessions)
+	handler.HandleFunc("DELETE /{user}/sessions", h.handleDeleteUserSessions)
+	handler.Handle("OPTIONS /{user}/sessions", middleware.CreateOptionsHandler("GET", "DELETE"))
+
+	handler.HandleFunc("GET /{user}/identities", h.handleGetUserIdentities)
+	handler.HandleFunc("DELETE /{user}/identities", h.handleDeleteUserIdentity)
+	handler.Handle("OPTIONS /{user}/identities", middleware.CreateOptionsHandler("GET", "DELETE"))
+
+	handler.HandleFunc("POST /{user}/identities/{provider}", h.handleLinkUserIdentity)
+	handler.Handle("OPTIONS /{user}/identities/{provider}", middleware.CreateOptionsHandler("POST"))
+
+	handler.HandleFunc("GET /{user}/tokens", h.handleGetUserTokens)
+	handler.HandleFunc("POST /{user}/tokens", h.handleCreateUserToken)
+	handler.HandleFunc("DELETE /{user}/tokens", h.handleDeleteUserToken)
+	handler.Handle("OPTIONS /{user}/tokens", middleware.CreateOptionsHandler("GET", "POST", "DELETE"))
+
+	handler.HandleFunc("GET /{user}/apps", h.handleGetUserApps)
+	handler.HandleFunc("POST /{user}/apps", h.handleCreateUserApp)
+	handler.HandleFunc("DELETE /{user}/apps", h.handleDeleteUserApp)
+	handler.Handle("OPTIONS /{user}/apps", middleware.CreateOptionsHandler("GET", "POST", "DELETE"))
+
+	handler.HandleFunc("GET /{user}/authorizations", h.handleGetUserAuthorizations)
+	handler.HandleFunc("DELETE /{user}/authorizations", h.handleDeleteUserAuthorization)
+	handler.Handle("OPTIONS /{user}/authorizations", middleware.CreateOptionsHandler("GET", "DELETE"))
+
+	handler.HandleFunc("GET /{user}/2fa", h.handleGetTwoFactor)
+	handler.HandleFunc("POST /{user}/2fa", h.handleEnrollTwoFactor)
+	handler.HandleFunc("DELETE /{user}/2fa", h.handleDisableTwoFactor)
+	handler.Handle("OPTIONS /{user}/2fa", middleware.CreateOptionsHandler("GET", "POST", "DELETE"))
+
+	handler.HandleFunc("POST /{user}/2fa/verify", h.handleVerifyTwoFactor)
+	handler.Handle("OPTIONS /{user}/2fa/verify", middleware.CreateOptionsHandler("POST"))
+
+	handler.HandleFunc("GET /{user}/passkeys", h.handleGetPasskeys)
+	handler.HandleFunc("DELETE /{user}/passkeys", h.handleDeletePasskey)
+	handler.Handle("OPTIONS /{user}/passkeys", middleware.CreateOptionsHandler("GET", "DELETE"))
+
+	handler.HandleFunc("POST /{user}/impersonate", h.handleImpersonateUser)
+	handler.Handle("OPTIONS /{user}/impersonate", middleware.CreateOptionsHandler("POST"))
+
+	return handler
+}
+
+// selfUser flags the user when an admin is impersonating them
+type selfUser struct {
+	*repository.User
+	Impersonated   bool   `json:"impersonated"`
+	ImpersonatedBy string `json:"impersonatedBy,omitempty"`
+}
+
+func (h *UserHandler) handleGetSelf(w http.ResponseWriter, r *http.Request) {
+	user, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	// a token without the scope still finds out who it belongs to
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      user,
+		Ressource: user,
+		Actions:   []string{auth.ActionViewEmail},
+		Context:   r.Context(),
+	}); errors.Is(err, errors.ErrorForbidden) {
+		clone := *user
+		clone.Email = ""
+		user = &clone
+	} else if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	self := selfUser{User: user}
+	if actor, ok := h.authService.GetImpersonator(r.Context()); ok {
+		self.Impersonated = true
+		self.ImpersonatedBy = actor.Username
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(self)
+}
+
+func (h *UserHandler) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("user")
+	user, err := h.userService.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	request := &config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionViewEmail},
+		Context:   r.Context(),
+	}
+
+	if err := h.authService.Authorize(request); err == errors.ErrorForbidden {
+		user.Email = ""
+	} else if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
 
-func (h *UserHandler) handleGetUser(w http.ResponseWriter, r *http.Request) {
-	username := r.PathValue("user")
-	user, err := h.userService.GetUserByUsername(r.Context(), username)
-	if err != nil {
+func (h *UserHandler) handlePutUser(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("user")
+
+	user, err := h.userService.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	request := &config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionUpdate},
+		Context:   r.Context(),
+	}
+
+	if err := h.authService.Authorize(request); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your creation request with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	params := repository.UpdateUserParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	params.ID = user.ID
+
+	if err := h.userService.UpdateUser(r.Context(), params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("user")
+	user, err := h.userService.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	request := &config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionDelete},
+		Context:   r.Context(),
+	}
+
+	if err := h.authService.Authorize(request); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.userService.DeleteUser(r.Context(), user); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) handlePutUserAdmin(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("user")
+
+	user, err := h.userService.GetUserByUsername(r.Context(), username)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	request := &config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionUpdateAdmin},
+		Context:   r.Context(),
+	}
+
+	if err := h.authService.Authorize(request); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your creation request with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	params := repository.UpdateUserAdminParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	params.ID = user.ID
+
+	if err := h.userService.UpdateUserAdmin(r.Context(), params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) handleGetUserSessions(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionViewUserSessions},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	sessions, err := h.authService.GetUserSessions(r.Context(), user.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	// hide the token hash for security reasons
+	for i := range sessions {
+		sessions[i].TokenHash = ""
+	}
+
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *UserHandler) handleDeleteUserSessions(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionDeleteUserSessions},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			errors.HandleError(w, r, errors.NewError(fmt.Sprintf("id %s is not valid integer %s", idStr, err.Error()), http.StatusBadRequest))
+			return
+		}
+		if err := h.authService.DeleteUserSession(r.Context(), user.ID, int32(id)); err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := h.authService.DeleteUserSessions(r.Context(), user.ID); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) handleGetUserIdentities(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionViewUserIdentities},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	identities, err := h.userService.ListIdentities(r.Context(), user.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(identities)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *UserHandler) handleDeleteUserIdentity(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionUnlinkUserIdentities},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		errors.HandleError(w, r, errors.NewError(fmt.Sprintf("id %s is not valid integer %s", idStr, err.Error()), http.StatusBadRequest))
+		return
+	}
+
+	if err := h.userService.UnlinkIdentity(r.Context(), user.ID, int32(id)); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) handleLinkUserIdentity(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionLinkUserIdentities},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	providerName := r.PathValue("provider")
+	provider, err := h.authService.GetProvider(providerName)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	// the state cookie set here binds the callback to this browser
+	flow, err := h.authService.CreateOAuthState(r.Context(), w, providerName, r.URL.Query().Get("redirectTo"), user.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(struct {
+		URL string `json:"url"`
+	}{provider.AuthCodeURL(flow.State, flow.Nonce, flow.Verifier)})
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *UserHandler) handleGetUserTokens(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionViewUserTokens},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	tokens, err := h.authService.GetUserTokens(r.Context(), user.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	// hide the token hash for security reasons
+	for i := range tokens {
+		tokens[i].TokenHash = ""
+	}
+
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *UserHandler) handleCreateUserToken(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionCreateUserTokens},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your creation request with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	params := auth.CreateTokenParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	token, err := h.authService.CreateUserToken(r.Context(), user, params)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	token.TokenHash = ""
+	data, err := json.Marshal(token)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *UserHandler) handleDeleteUserToken(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionDeleteUserTokens},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		errors.HandleError(w, r, errors.NewError(fmt.Sprintf("id %s is not valid integer %s", idStr, err.Error()), http.StatusBadRequest))
+		return
+	}
+
+	if err := h.authService.DeleteUserToken(r.Context(), user.ID, int32(id)); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) handleGetUserApps(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionViewOAuthClients},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	clients, err := h.authService.GetOAuthClients(r.Context(), user.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	// hide the secret hash for security reasons
+	for i := range clients {
+		clients[i].SecretHash = ""
+	}
+
+	data, err := json.Marshal(clients)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *UserHandler) handleCreateUserApp(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionCreateOAuthClients},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "please submit your app with the required json payload", http.StatusBadRequest)
+		return
+	}
+
+	params := auth.CreateOAuthClientParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	client, err := h.authService.CreateOAuthClient(r.Context(), user, params)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	client.SecretHash = ""
+	data, err := json.Marshal(client)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *UserHandler) handleDeleteUserApp(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionDeleteOAuthClients},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.DeleteOAuthClient(r.Context(), user.ID, r.URL.Query().Get("id")); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
+	w.WriteHeader(http.StatusOK)
+}
 
+func (h *UserHandler) handleGetUserAuthorizations(w http.ResponseWriter, r *http.Request) {
 	requester, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	request := &config.AuthRequest{
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
 		User:      requester,
 		Ressource: user,
-		Actions:   []string{auth.ActionViewEmail},
+		Actions:   []string{auth.ActionViewAuthorizations},
 		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
 	}
 
-	if err := h.authService.Authorize(request); err == errors.ErrorForbidden {
-		user.Email = ""
-	} else if err != nil {
+	authorizations, err := h.authService.GetAuthorizations(r.Context(), user.ID)
+	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
-}
-
-func (h *UserHandler) handlePutUser(w http.ResponseWriter, r *http.Request) {
-	username := r.PathValue("user")
-
-	user, err := h.userService.GetUserByUsername(r.Context(), username)
+	data, err := json.Marshal(authorizations)
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *UserHandler) handleDeleteUserAuthorization(w http.ResponseWriter, r *http.Request) {
 	requester, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	request := &config.AuthRequest{
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
 		User:      requester,
 		Ressource: user,
-		Actions:   []string{auth.ActionUpdate},
+		Actions:   []string{auth.ActionRevokeAuthorizations},
 		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
 	}
 
-	if err := h.authService.Authorize(request); err != nil {
-		errors.HandleError(w, r, err)
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		errors.HandleError(w, r, errors.NewError(fmt.Sprintf("id %s is not valid integer %s", idStr, err.Error()), http.StatusBadRequest))
 		return
 	}
 
-	if r.Header.Get("Content-Type") != "application/json" {
-		http.Error(w, "please submit your creation request with the required json payload", http.StatusBadRequest)
+	if err := h.authService.RevokeAuthorization(r.Context(), user.ID, int32(id)); err != nil {
+		errors.HandleError(w, r, err)
 		return
 	}
+	w.WriteHeader(http.StatusOK)
+}
 
-	params := repository.UpdateUserParams{}
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+func (h *UserHandler) handleGetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	params.ID = user.ID
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
 
-	if err := h.userService.UpdateUser(r.Context(), params); err != nil {
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionViewTwoFactor},
+		Context:   r.Context(),
+	}); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-}
 
-func (h *UserHandler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
-	username := r.PathValue("user")
-	user, err := h.userService.GetUserByUsername(r.Context(), username)
+	status, err := h.authService.GetTwoFactor(r.Context(), user.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(status)
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *UserHandler) handleEnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
 	requester, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	request := &config.AuthRequest{
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
 		User:      requester,
 		Ressource: user,
-		Actions:   []string{auth.ActionDelete},
+		Actions:   []string{auth.ActionEnrollTwoFactor},
 		Context:   r.Context(),
-	}
-
-	if err := h.authService.Authorize(request); err != nil {
+	}); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	if err := h.userService.DeleteUser(r.Context(), user); err != nil {
+	enrollment, err := h.authService.EnrollTwoFactor(r.Context(), user)
+	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-}
-
-func (h *UserHandler) handlePutUserAdmin(w http.ResponseWriter, r *http.Request) {
-	username := r.PathValue("user")
 
-	user, err := h.userService.GetUserByUsername(r.Context(), username)
+	data, err := json.Marshal(enrollment)
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (h *UserHandler) handleVerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
 	requester, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	request := &config.AuthRequest{
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
 		User:      requester,
 		Ressource: user,
-		Actions:   []string{auth.ActionUpdateAdmin},
+		Actions:   []string{auth.ActionEnrollTwoFactor},
 		Context:   r.Context(),
-	}
-
-	if err := h.authService.Authorize(request); err != nil {
+	}); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
 	if r.Header.Get("Content-Type") != "application/json" {
-		http.Error(w, "please submit your creation request with the required json payload", http.StatusBadRequest)
+		http.Error(w, "please submit your code with the required json payload", http.StatusBadRequest)
 		return
 	}
 
-	params := repository.UpdateUserAdminParams{}
+	params := struct {
+		Code string `json:"code"`
+	}{}
 	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	params.ID = user.ID
+	recoveryCodes, err := h.authService.VerifyTwoFactor(r.Context(), user.ID, params.Code)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
 
-	if err := h.userService.UpdateUserAdmin(r.Context(), params); err != nil {
+	data, err := json.Marshal(recoveryCodes)
+	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
 }
 
-func (h *UserHandler) handleGetUserSessions(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) handleDisableTwoFactor(w http.ResponseWriter, r *http.Request) {
 	requester, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
@@ -461,25 +1996,72 @@ func (h *UserHandler) handleGetUserSessions(w http.ResponseWriter, r *http.Reque
 	if err := h.authService.Authorize(&config.AuthRequest{
 		User:      requester,
 		Ressource: user,
-		Actions:   []string{auth.ActionViewUserSessions},
+		Actions:   []string{auth.ActionDisableTwoFactor},
 		Context:   r.Context(),
 	}); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	sessions, err := h.authService.GetUserSessions(r.Context(), user.ID)
+	// users have to confirm with a code, admins can reset the two factor
+	// authentication of users who lost it
+	var code *auth.TwoFactorCode
+	if user.ID == requester.ID {
+		if r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "please submit your code with the required json payload", http.StatusBadRequest)
+			return
+		}
+
+		code = &auth.TwoFactorCode{}
+		if err := json.NewDecoder(r.Body).Decode(code); err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+	}
+
+	if err := h.authService.DisableTwoFactor(r.Context(), user.ID, code); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) handleGetPasskeys(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	// hide the token hash for security reasons
-	for i := range sessions {
-		sessions[i].TokenHash = ""
+	var user *repository.User
+	username := r.PathValue("user")
+	if username == requester.Username {
+		user = requester
+	} else {
+		user, err = h.userService.GetUserByUsername(r.Context(), username)
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
 	}
 
-	data, err := json.Marshal(sessions)
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionViewPasskeys},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	passkeys, err := h.authService.GetPasskeys(r.Context(), user.ID)
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	data, err := json.Marshal(passkeys)
 	if err != nil {
 		errors.HandleError(w, r, err)
 		return
@@ -489,7 +2071,7 @@ func (h *UserHandler) handleGetUserSessions(w http.ResponseWriter, r *http.Reque
 	w.Write(data)
 }
 
-func (h *UserHandler) handleDeleteUserSessions(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) handleDeletePasskey(w http.ResponseWriter, r *http.Request) {
 	requester, err := h.userService.GetUserFromContext(r.Context())
 	if err != nil {
 		errors.HandleError(w, r, err)
@@ -511,28 +2093,51 @@ func (h *UserHandler) handleDeleteUserSessions(w http.ResponseWriter, r *http.Re
 	if err := h.authService.Authorize(&config.AuthRequest{
 		User:      requester,
 		Ressource: user,
-		Actions:   []string{auth.ActionDeleteUserSessions},
+		Actions:   []string{auth.ActionManagePasskeys},
 		Context:   r.Context(),
 	}); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
 
-	if idStr := r.URL.Query().Get("id"); idStr != "" {
-		id, err := strconv.Atoi(idStr)
-		if err != nil {
-			errors.HandleError(w, r, errors.NewError(fmt.Sprintf("id %s is not valid integer %s", idStr, err.Error()), http.StatusBadRequest))
-			return
-		}
-		if err := h.authService.DeleteUserSession(r.Context(), user.ID, int32(id)); err != nil {
-			errors.HandleError(w, r, err)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
+	idStr := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		errors.HandleError(w, r, errors.NewError(fmt.Sprintf("id %s is not valid integer %s", idStr, err.Error()), http.StatusBadRequest))
 		return
 	}
 
-	if err := h.authService.DeleteUserSessions(r.Context(), user.ID); err != nil {
+	if err := h.authService.DeletePasskey(r.Context(), user.ID, int32(id)); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *UserHandler) handleImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	requester, err := h.userService.GetUserFromContext(r.Context())
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	user, err := h.userService.GetUserByUsername(r.Context(), r.PathValue("user"))
+	if err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.Authorize(&config.AuthRequest{
+		User:      requester,
+		Ressource: user,
+		Actions:   []string{auth.ActionImpersonate},
+		Context:   r.Context(),
+	}); err != nil {
+		errors.HandleError(w, r, err)
+		return
+	}
+
+	if err := h.authService.StartImpersonation(w, r, requester, user); err != nil {
 		errors.HandleError(w, r, err)
 		return
 	}
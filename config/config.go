@@ -1,8 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"net/netip"
+	"net/url"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
@@ -16,17 +22,68 @@ type EnvsConfig struct {
 	DBURL           string
 	GithubApiToken  string
 
+	// requests from these networks are trusted to tell the client address in
+	// X-Forwarded-For or Forwarded
+	TrustedProxies []netip.Prefix
+
+	// how close the address refreshing a session has to be to the last one
+	// it was used from, see the SessionBinding constants
+	SessionBinding string
+
+	// YAML or JSON file the RBAC policy is read from, the built-in one is used
+	// if unset. The file is checked for changes every PolicyReloadInterval
+	PolicyFile           string
+	PolicyReloadInterval time.Duration
+
+	// used to encrypt secrets stored in the database
+	SecretsKey []byte
+
 	// auth
-	JWTSigningSecret   []byte
+	JWTSigningSecret   []byte // only signs the oauth state, access tokens use the signing keys
+	JWTAlgorithm       string
+	JWTKeyRotation     time.Duration
+	JWTKeyOverlap      time.Duration
 	GoogleClientID     string
 	GoogleClientSecret string
 	GithubClientID     string
 	GithubClientSecret string
+	OidcProviders      []OidcProviderConfig
+
+	// passkeys, the origins are the ones the frontend is served from
+	WebauthnRPID    string
+	WebauthnRPName  string
+	WebauthnOrigins []string
 
 	// mail
-	SmtpHost string
-	ImapHost string
-	ImapPort string
+	SmtpHost       string
+	SmtpPort       string
+	ImapHost       string
+	ImapPort       string
+	MailUndoWindow time.Duration
+
+	// the account notifications are sent from, they are only logged if unset
+	SystemMailAddress  string
+	SystemMailUsername string
+	SystemMailPassword string
+
+	// PEM bundle of the CAs trusted for S/MIME, the system roots are used if unset
+	SmimeTrustStore string
+}
+
+const (
+	SessionBindingExact  = "exact"  // the same address
+	SessionBindingPrefix = "prefix" // the same /24 for IPv4 or /64 for IPv6
+	SessionBindingNone   = "none"
+)
+
+// OidcProviderConfig describes an OpenID Connect provider, its endpoints are
+// read from the discovery document of the issuer
+type OidcProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients
+	Scopes       []string
 }
 
 type PublicConfig struct {
@@ -35,17 +92,20 @@ type PublicConfig struct {
 }
 
 func GetPublicConfig() PublicConfig {
-	return PublicConfig{Policy, UsernameBlacklist}
+	return PublicConfig{Policy.Load(), UsernameBlacklist}
 }
 
 var Envs EnvsConfig
 var MaxDocsInstanceCount int64 = 3
 var JWTSigningMethod jwt.SigningMethod = jwt.SigningMethodHS256
 var UserContextKey = "user"
+var TokenScopesContextKey = "token_scopes"
+var SessionContextKey = "session_id"
+var ActorContextKey = "actor"
 
 // these are populated by external services
 var UsernameBlacklist []string
-var Policy *PolicyConfiguration
+var Policy atomic.Pointer[PolicyConfiguration] // swapped when the policy is reloaded
 
 func LoadConfig() {
 	godotenv.Load()
@@ -53,20 +113,38 @@ func LoadConfig() {
 
 	// Load config from environment
 	Envs = EnvsConfig{
-		AuthCallbackUrl:    getEnv("AUTH_CALLBACK"),
-		Url:                getEnv("URL"),
-		Domain:             getEnv("DOMAIN"),
-		Port:               getDefaultEnv("PORT", "80"),
-		DBURL:              getEnv("DB_URL"),
-		GoogleClientID:     getEnv("AUTH_GOOGLE_CLIENT_ID"),
-		GoogleClientSecret: getEnv("AUTH_GOOGLE_CLIENT_SECRET"),
-		GithubClientID:     getEnv("AUTH_GITHUB_CLIENT_ID"),
-		GithubClientSecret: getEnv("AUTH_GITHUB_CLIENT_SECRET"),
-		GithubApiToken:     getEnv("GITHUB_API_TOKEN"),
-		JWTSigningSecret:   []byte(getEnv("JWT_SECRET")),
-		SmtpHost:           getEnv("SMTP_HOST"),
-		ImapHost:           getEnv("IMAP_HOST"),
-		ImapPort:           getDefaultEnv("IMAP_PORT", "993"),
+		AuthCallbackUrl:      getEnv("AUTH_CALLBACK"),
+		Url:                  getEnv("URL"),
+		Domain:               getEnv("DOMAIN"),
+		Port:                 getDefaultEnv("PORT", "80"),
+		DBURL:                getEnv("DB_URL"),
+		GoogleClientID:       getEnv("AUTH_GOOGLE_CLIENT_ID"),
+		GoogleClientSecret:   getEnv("AUTH_GOOGLE_CLIENT_SECRET"),
+		GithubClientID:       getEnv("AUTH_GITHUB_CLIENT_ID"),
+		GithubClientSecret:   getEnv("AUTH_GITHUB_CLIENT_SECRET"),
+		OidcProviders:        getOidcProviders(),
+		WebauthnRPID:         getDefaultEnv("WEBAUTHN_RP_ID", strings.TrimPrefix(getEnv("DOMAIN"), ".")),
+		WebauthnRPName:       getDefaultEnv("WEBAUTHN_RP_NAME", "Piquel"),
+		WebauthnOrigins:      getListEnv("WEBAUTHN_ORIGINS", getOrigin(getEnv("AUTH_CALLBACK"))),
+		GithubApiToken:       getEnv("GITHUB_API_TOKEN"),
+		TrustedProxies:       getPrefixListEnv("TRUSTED_PROXIES"),
+		SessionBinding:       getSessionBinding(),
+		PolicyFile:           getDefaultEnv("POLICY_FILE", ""),
+		PolicyReloadInterval: getDurationEnv("POLICY_RELOAD_INTERVAL", "10s"),
+		JWTSigningSecret:     []byte(getEnv("JWT_SECRET")),
+		JWTAlgorithm:         getDefaultEnv("JWT_ALGORITHM", "EdDSA"),
+		JWTKeyRotation:       getDurationEnv("JWT_KEY_ROTATION", "720h"),
+		JWTKeyOverlap:        getDurationEnv("JWT_KEY_OVERLAP", "24h"),
+		SecretsKey:           []byte(getEnv("SECRETS_KEY")),
+		SmtpHost:             getEnv("SMTP_HOST"),
+		SmtpPort:             getDefaultEnv("SMTP_PORT", "587"),
+		ImapHost:             getEnv("IMAP_HOST"),
+		ImapPort:             getDefaultEnv("IMAP_PORT", "993"),
+		MailUndoWindow:       getDurationEnv("MAIL_UNDO_WINDOW", "10s"),
+		SystemMailAddress:    getDefaultEnv("SYSTEM_MAIL_ADDRESS", ""),
+		SystemMailUsername:   getDefaultEnv("SYSTEM_MAIL_USERNAME", getDefaultEnv("SYSTEM_MAIL_ADDRESS", "")),
+		SystemMailPassword:   getDefaultEnv("SYSTEM_MAIL_PASSWORD", ""),
+		SmimeTrustStore:      getDefaultEnv("SMIME_TRUST_STORE", ""),
 	}
 
 	log.Printf("[Config] Loaded environment configuration!")
@@ -88,3 +166,83 @@ func getDefaultEnv(key string, defaultValue string) string {
 
 	return defaultValue
 }
+
+func getDurationEnv(key string, defaultValue string) time.Duration {
+	value := getDefaultEnv(key, defaultValue)
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Environment variable %s is not a valid duration: %s", key, err.Error())
+	}
+	return duration
+}
+
+// getListEnv reads a comma separated list
+func getListEnv(key string, defaultValue string) []string {
+	var values []string
+	for value := range strings.SplitSeq(getDefaultEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getPrefixListEnv reads a comma separated list of CIDRs, plain addresses
+// being networks of their own
+func getPrefixListEnv(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, value := range getListEnv(key, "") {
+		if addr, err := netip.ParseAddr(value); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			log.Fatalf("Environment variable %s contains an invalid network %s: %s", key, value, err.Error())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+func getSessionBinding() string {
+	binding := getDefaultEnv("SESSION_BINDING", SessionBindingExact)
+	switch binding {
+	case SessionBindingExact, SessionBindingPrefix, SessionBindingNone:
+		return binding
+	}
+
+	log.Fatalf("Environment variable SESSION_BINDING must be %s, %s or %s", SessionBindingExact, SessionBindingPrefix, SessionBindingNone)
+	return ""
+}
+
+func getOrigin(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		log.Fatalf("%s is not a valid URL: %s", rawUrl, err.Error())
+	}
+	return fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
+}
+
+// getOidcProviders reads the providers listed in OIDC_PROVIDERS, each being
+// configured by OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and _SCOPES
+func getOidcProviders() []OidcProviderConfig {
+	var providers []OidcProviderConfig
+	for name := range strings.SplitSeq(getDefaultEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := fmt.Sprintf("OIDC_%s_", strings.ToUpper(name))
+		providers = append(providers, OidcProviderConfig{
+			Name:         name,
+			Issuer:       getEnv(prefix + "ISSUER"),
+			ClientID:     getEnv(prefix + "CLIENT_ID"),
+			ClientSecret: getDefaultEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       strings.Fields(getDefaultEnv(prefix+"SCOPES", "openid email profile")),
+		})
+	}
+	return providers
+}
@@ -3,7 +3,10 @@ package config
 import (
 	"context"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/piquel-fr/api/database/repository"
 	"github.com/piquel-fr/api/utils/errors"
@@ -12,6 +15,20 @@ import (
 type PolicyConfiguration struct {
 	Presets map[string]*Permission `json:"presets"`
 	Roles   map[string]*Role       `json:"roles"`
+
+	// ResolvedPresets is filled by Validate, once every preset is known to
+	// resolve to an action
+	ResolvedPresets map[string]*ResolvedPreset `json:"resolved_presets"`
+}
+
+// ResolvedPreset is a preset with the presets it is composed of applied. The
+// conditions of the innermost preset come first, all of them have to pass
+type ResolvedPreset struct {
+	Action         string     `json:"action"`
+	Conditions     Conditions `json:"-"`
+	ConditionNames []string   `json:"conditions"`
+	Resource       string     `json:"resource,omitempty"` // see Permission
+	Presets        []string   `json:"presets"`            // the preset then the ones it is composed of
 }
 
 func (p *PolicyConfiguration) ValidateRole(role string) error {
@@ -22,10 +39,151 @@ func (p *PolicyConfiguration) ValidateRole(role string) error {
 	return nil
 }
 
+// Validate checks that every preset and parent referenced exists and that
+// neither presets nor roles refer back to themselves. All the problems found
+// are reported, the presets are only resolved if there are none
+func (p *PolicyConfiguration) Validate() error {
+	var problems []string
+
+	resolved := map[string]*ResolvedPreset{}
+	for _, name := range slices.Sorted(maps.Keys(p.Presets)) {
+		preset := p.Presets[name]
+		switch {
+		case preset == nil || (preset.Action == "" && preset.Preset == ""):
+			problems = append(problems, fmt.Sprintf("preset %s has no action nor preset", name))
+			continue
+		case preset.Action != "" && preset.Preset != "":
+			problems = append(problems, fmt.Sprintf("preset %s has both an action and preset %s", name, preset.Preset))
+			continue
+		}
+
+		resolvedPreset, err := p.resolvePreset(name, []string{})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("preset %s: %s", name, err.Error()))
+			continue
+		}
+		resolved[name] = resolvedPreset
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(p.Roles)) {
+		role := p.Roles[name]
+		if role == nil {
+			problems = append(problems, fmt.Sprintf("role %s is empty", name))
+			continue
+		}
+
+		for _, resource := range slices.Sorted(maps.Keys(role.Permissions)) {
+			for i, permission := range role.Permissions[resource] {
+				switch {
+				case permission == nil || (permission.Action == "" && permission.Preset == ""):
+					problems = append(problems, fmt.Sprintf("role %s: permission %d on %s has no action nor preset", name, i, resource))
+				case permission.Action != "" && permission.Preset != "":
+					problems = append(problems, fmt.Sprintf("role %s: permission %d on %s has both an action and preset %s", name, i, resource, permission.Preset))
+				case permission.Preset != "" && p.Presets[permission.Preset] == nil:
+					problems = append(problems, fmt.Sprintf("role %s: permission %d on %s uses unknown preset %s", name, i, resource, permission.Preset))
+				case permission.Resource != "" && permission.Resource != resource:
+					problems = append(problems, fmt.Sprintf("role %s: permission %d on %s has conditions that only apply to %s", name, i, resource, permission.Resource))
+				case permission.Preset != "" && resolved[permission.Preset] != nil &&
+					resolved[permission.Preset].Resource != "" && resolved[permission.Preset].Resource != resource:
+					problems = append(problems, fmt.Sprintf("role %s: permission %d on %s uses preset %s, which only applies to %s", name, i, resource, permission.Preset, resolved[permission.Preset].Resource))
+				}
+			}
+		}
+
+		for _, parent := range role.Parents {
+			if _, ok := p.Roles[parent]; !ok {
+				problems = append(problems, fmt.Sprintf("role %s: parent %s does not exist", name, parent))
+			}
+		}
+
+		if cycle := p.findInheritanceCycle(name, []string{}); cycle != nil {
+			problems = append(problems, fmt.Sprintf("role %s: inheritance cycle %s", name, strings.Join(cycle, " -> ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid policy:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	p.ResolvedPresets = resolved
+	return nil
+}
+
+// resolvePreset follows the presets name is composed of down to the one with
+// the action, path holds the presets already followed
+func (p *PolicyConfiguration) resolvePreset(name string, path []string) (*ResolvedPreset, error) {
+	if slices.Contains(path, name) {
+		return nil, fmt.Errorf("composition cycle %s", strings.Join(append(path, name), " -> "))
+	}
+	path = append(path, name)
+
+	preset := p.Presets[name]
+	if preset == nil {
+		return nil, fmt.Errorf("unknown preset %s", name)
+	}
+
+	resolved := &ResolvedPreset{
+		Action:         preset.Action,
+		Conditions:     Conditions{},
+		ConditionNames: []string{},
+	}
+	if preset.Preset != "" {
+		base, err := p.resolvePreset(preset.Preset, slices.Clone(path))
+		if err != nil {
+			return nil, err
+		}
+		resolved.Action = base.Action
+		resolved.Conditions = append(resolved.Conditions, base.Conditions...)
+		resolved.ConditionNames = append(resolved.ConditionNames, base.ConditionNames...)
+		resolved.Resource = base.Resource
+		resolved.Presets = base.Presets
+	}
+
+	if preset.Resource != "" && resolved.Resource != "" && preset.Resource != resolved.Resource {
+		return nil, fmt.Errorf("conditions only apply to %s but preset %s only to %s", preset.Resource, preset.Preset, resolved.Resource)
+	}
+	if preset.Resource != "" {
+		resolved.Resource = preset.Resource
+	}
+
+	resolved.Conditions = append(resolved.Conditions, preset.Conditions...)
+	resolved.ConditionNames = append(resolved.ConditionNames, preset.ConditionNames...)
+	resolved.Presets = append([]string{name}, resolved.Presets...)
+	return resolved, nil
+}
+
+// findInheritanceCycle returns the path back to role if it inherits from
+// itself. Cycles not going through role are reported from their own roles
+func (p *PolicyConfiguration) findInheritanceCycle(role string, path []string) []string {
+	path = append(path, role)
+
+	current, ok := p.Roles[role]
+	if !ok || current == nil {
+		return nil
+	}
+
+	for _, parent := range current.Parents {
+		if parent == path[0] {
+			return append(path, parent)
+		}
+		if slices.Contains(path, parent) {
+			continue
+		}
+		if cycle := p.findInheritanceCycle(parent, slices.Clone(path)); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
+// Permission grants an action, or the one of a preset. The conditions of a
+// permission using a preset are checked after the ones of the preset
 type Permission struct {
-	Action     string     `json:"action"`
-	Conditions Conditions `json:"-"`
-	Preset     string     `json:"preset"`
+	Action         string     `json:"action"`
+	Conditions     Conditions `json:"-"`
+	ConditionNames []string   `json:"conditions,omitempty"` // describe Conditions, in the same order
+	Resource       string     `json:"resource,omitempty"`   // the only resource the conditions apply to, any if empty
+	Preset         string     `json:"preset"`
 }
 
 type Conditions []func(request *AuthRequest) error
@@ -35,6 +193,7 @@ type Role struct {
 	Color       string                   `json:"color"`
 	Permissions map[string][]*Permission `json:"permissions"`
 	Parents     []string                 `json:"parents"`
+	Custom      bool                     `json:"custom"` // stored in the database rather than the policy
 }
 
 type AuthRequest struct {
@@ -0,0 +1,3 @@
+-- name: AddAuditLog :exec
+INSERT INTO "audit_log" ("actorId", "userId", "event", "details", "ipAdress")
+VALUES ($1, $2, $3, $4, $5);
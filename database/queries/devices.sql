@@ -0,0 +1,12 @@
+-- name: AddUserDevice :execrows
+INSERT INTO "user_devices" ("userId", "fingerprint") VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: CountUserDevices :one
+SELECT COUNT(*) FROM "user_devices" WHERE "userId" = $1;
+
+-- name: LockUserDevices :exec
+SELECT "id" FROM "users" WHERE "id" = $1 FOR NO KEY UPDATE;
+
+-- name: DeleteUserDevices :exec
+DELETE FROM "user_devices" WHERE "userId" = $1;
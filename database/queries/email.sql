@@ -45,3 +45,63 @@ WHERE "userId" = $1 AND "account" = $2;
 -- name: ListAccountShares :many
 SELECT "userId" FROM "mail_share" WHERE "account" = $1
 ORDER BY "userId";
+
+-- name: AddShareInvite :one
+INSERT INTO "mail_share_invites" (
+    "userId", "account", "invitedBy", "permission", "expiresAt"
+)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT ("userId", "account") DO UPDATE
+SET "invitedBy" = EXCLUDED."invitedBy", "permission" = EXCLUDED."permission", "expiresAt" = EXCLUDED."expiresAt"
+RETURNING *;
+
+-- name: ListUserShareInvites :many
+SELECT i."id", i."account", m."email", m."name", u."username" AS "invitedBy", i."expiresAt", i."createdAt"
+FROM "mail_share_invites" i
+JOIN "mail_accounts" m ON m."id" = i."account"
+JOIN "users" u ON u."id" = i."invitedBy"
+WHERE i."userId" = $1 AND i."expiresAt" > NOW()
+ORDER BY i."createdAt" DESC;
+
+-- name: ListAccountShareInvites :many
+SELECT "userId" FROM "mail_share_invites" WHERE "account" = $1 AND "expiresAt" > NOW()
+ORDER BY "userId";
+
+-- name: AcceptShareInvite :execrows
+WITH invite AS (
+    DELETE FROM "mail_share_invites"
+    WHERE "id" = $1 AND "userId" = $2 AND "expiresAt" > NOW()
+    RETURNING "userId", "account", "permission"
+)
+INSERT INTO "mail_share" ("userId", "account", "permission")
+SELECT "userId", "account", "permission" FROM invite
+ON CONFLICT ("userId", "account") DO UPDATE
+SET "permission" = EXCLUDED."permission";
+
+-- name: DeclineShareInvite :execrows
+DELETE FROM "mail_share_invites"
+WHERE "id" = $1 AND "userId" = $2;
+
+-- name: DeleteShareInvite :exec
+DELETE FROM "mail_share_invites"
+WHERE "userId" = $1 AND "account" = $2;
+
+-- name: ListOwnedMailAccountIds :many
+SELECT "id" FROM "mail_accounts" WHERE "ownerId" = $1
+ORDER BY "id";
+
+-- name: DeleteAccountShares :exec
+DELETE FROM "mail_share"
+WHERE "account" = $1;
+
+-- name: DeleteAccountShareInvites :exec
+DELETE FROM "mail_share_invites"
+WHERE "account" = $1;
+
+-- name: DeleteUserShares :exec
+DELETE FROM "mail_share"
+WHERE "userId" = $1;
+
+-- name: DeleteUserShareInvites :exec
+DELETE FROM "mail_share_invites"
+WHERE "userId" = $1 OR "invitedBy" = $1;
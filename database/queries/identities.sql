@@ -0,0 +1,25 @@
+-- name: AddUserIdentity :one
+INSERT INTO "user_identities" ("userId", "provider", "subject", "email", "verified")
+VALUES ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: GetUserIdentity :one
+SELECT * FROM "user_identities" WHERE "provider" = $1 AND "subject" = $2;
+
+-- name: ListUserIdentities :many
+SELECT * FROM "user_identities" WHERE "userId" = $1 ORDER BY "id" ASC;
+
+-- name: LockUserIdentities :many
+SELECT * FROM "user_identities" WHERE "userId" = $1 ORDER BY "id" ASC
+FOR UPDATE;
+
+-- name: CountUserIdentities :one
+SELECT COUNT(*) FROM "user_identities" WHERE "userId" = $1;
+
+-- name: UpdateUserIdentity :exec
+UPDATE "user_identities" SET "email" = $2, "verified" = $3 WHERE "id" = $1;
+
+-- name: DeleteUserIdentity :execrows
+DELETE FROM "user_identities" WHERE "userId" = $1 AND "id" = $2;
+
+-- name: DeleteUserIdentities :exec
+DELETE FROM "user_identities" WHERE "userId" = $1;
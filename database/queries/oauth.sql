@@ -0,0 +1,9 @@
+-- name: AddOAuthState :exec
+INSERT INTO "oauth_states" ("nonce", "verifier", "expiresAt") VALUES ($1, $2, $3);
+
+-- name: ConsumeOAuthState :one
+DELETE FROM "oauth_states" WHERE "nonce" = $1 AND "expiresAt" > NOW()
+RETURNING "verifier";
+
+-- name: DeleteExpiredOAuthStates :exec
+DELETE FROM "oauth_states" WHERE "expiresAt" <= NOW();
@@ -0,0 +1,87 @@
+-- name: AddOAuthClient :one
+INSERT INTO "oauth_clients" ("id", "ownerId", "name", "secretHash", "redirectUris")
+VALUES ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM "oauth_clients" WHERE "id" = $1;
+
+-- name: ListUserOAuthClients :many
+SELECT * FROM "oauth_clients" WHERE "ownerId" = $1 ORDER BY "createdAt" DESC;
+
+-- name: ListOwnedOAuthClientIds :many
+SELECT "id" FROM "oauth_clients" WHERE "ownerId" = $1
+ORDER BY "id";
+
+-- name: DeleteOAuthClient :exec
+DELETE FROM "oauth_clients" WHERE "id" = $1;
+
+-- name: AddOAuthCode :exec
+INSERT INTO "oauth_codes" ("codeHash", "clientId", "userId", "redirectUri", "scopes", "codeChallenge", "expiresAt")
+VALUES ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: ConsumeOAuthCode :one
+DELETE FROM "oauth_codes" WHERE "codeHash" = $1 AND "expiresAt" > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredOAuthCodes :exec
+DELETE FROM "oauth_codes" WHERE "expiresAt" <= NOW();
+
+-- name: DeleteClientOAuthCodes :exec
+DELETE FROM "oauth_codes" WHERE "clientId" = $1;
+
+-- name: DeleteUserOAuthCodes :exec
+DELETE FROM "oauth_codes" WHERE "userId" = $1;
+
+-- name: AddOAuthToken :one
+INSERT INTO "oauth_tokens" ("clientId", "userId", "scopes", "accessTokenHash", "refreshTokenHash", "accessExpiresAt", "refreshExpiresAt")
+VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *;
+
+-- name: GetOAuthTokenByAccessHash :one
+SELECT * FROM "oauth_tokens" WHERE "accessTokenHash" = $1;
+
+-- name: GetOAuthTokenByRefreshHash :one
+SELECT * FROM "oauth_tokens" WHERE "refreshTokenHash" = $1;
+
+-- name: RotateOAuthToken :one
+UPDATE "oauth_tokens"
+SET "accessTokenHash" = @access_token_hash, "refreshTokenHash" = @refresh_token_hash,
+    "accessExpiresAt" = @access_expires_at, "refreshExpiresAt" = @refresh_expires_at
+WHERE "refreshTokenHash" = @previous_refresh_token_hash AND "refreshExpiresAt" > NOW()
+RETURNING *;
+
+-- name: AddConsumedOAuthRefreshToken :exec
+INSERT INTO "consumed_oauth_refresh_tokens" ("tokenHash", "grantId", "expiresAt")
+VALUES ($1, $2, $3) ON CONFLICT ("tokenHash") DO NOTHING;
+
+-- name: GetConsumedOAuthRefreshToken :one
+SELECT * FROM "consumed_oauth_refresh_tokens" WHERE "tokenHash" = $1;
+
+-- name: DeleteGrantConsumedOAuthTokens :exec
+DELETE FROM "consumed_oauth_refresh_tokens" WHERE "grantId" = $1;
+
+-- name: DeleteExpiredConsumedOAuthTokens :exec
+DELETE FROM "consumed_oauth_refresh_tokens" WHERE "expiresAt" <= NOW();
+
+-- name: TouchOAuthToken :exec
+UPDATE "oauth_tokens" SET "lastUsedAt" = NOW() WHERE "id" = $1;
+
+-- name: DeleteOAuthToken :exec
+DELETE FROM "oauth_tokens" WHERE "id" = $1;
+
+-- name: ListUserAuthorizations :many
+SELECT "oauth_tokens"."id", "oauth_tokens"."clientId", "oauth_clients"."name" AS "clientName",
+    "oauth_tokens"."scopes", "oauth_tokens"."lastUsedAt", "oauth_tokens"."createdAt"
+FROM "oauth_tokens" JOIN "oauth_clients" ON "oauth_clients"."id" = "oauth_tokens"."clientId"
+WHERE "oauth_tokens"."userId" = $1 ORDER BY "oauth_tokens"."createdAt" DESC;
+
+-- name: DeleteUserAuthorization :execrows
+DELETE FROM "oauth_tokens" WHERE "userId" = $1 AND "id" = $2;
+
+-- name: DeleteClientOAuthTokens :exec
+DELETE FROM "oauth_tokens" WHERE "clientId" = $1;
+
+-- name: DeleteUserOAuthTokens :exec
+DELETE FROM "oauth_tokens" WHERE "userId" = $1;
+
+-- name: DeleteExpiredOAuthTokens :exec
+DELETE FROM "oauth_tokens" WHERE "refreshExpiresAt" <= NOW();
@@ -0,0 +1,49 @@
+-- name: AddOutboxMessage :one
+INSERT INTO "mail_outbox" (
+    "account", "senderId", "recipients", "subject", "body", "sign", "encrypt", "scheme", "recipientKeys", "sendAt", "nextAttemptAt"
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10) RETURNING *;
+
+-- name: GetOutboxMessage :one
+SELECT * FROM "mail_outbox" WHERE "id" = $1;
+
+-- name: ListAccountOutbox :many
+SELECT * FROM "mail_outbox" WHERE "account" = $1
+ORDER BY "sendAt" DESC;
+
+-- name: CancelOutboxMessage :execrows
+UPDATE "mail_outbox" SET "status" = 'cancelled', "updatedAt" = NOW()
+WHERE "id" = $1 AND "status" = 'scheduled' AND "sendAt" > NOW();
+
+-- name: ClaimDueOutboxMessages :many
+UPDATE "mail_outbox" SET "status" = 'sending', "attempts" = "attempts" + 1, "updatedAt" = NOW()
+WHERE "id" IN (
+    SELECT "id" FROM "mail_outbox"
+    WHERE "status" = 'scheduled' AND "nextAttemptAt" <= NOW()
+    ORDER BY "nextAttemptAt"
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: ReleaseStaleOutboxMessages :exec
+UPDATE "mail_outbox" SET "status" = 'scheduled', "updatedAt" = NOW()
+WHERE "status" = 'sending' AND "updatedAt" < $1;
+
+-- name: MarkOutboxMessageSent :execrows
+UPDATE "mail_outbox" SET "status" = 'sent', "lastError" = '', "updatedAt" = NOW()
+WHERE "id" = $1 AND "status" = 'sending' AND "attempts" = $2;
+
+-- name: MarkOutboxMessageFailed :execrows
+UPDATE "mail_outbox" SET "status" = 'failed', "lastError" = $2, "updatedAt" = NOW()
+WHERE "id" = $1 AND "status" = 'sending' AND "attempts" = $3;
+
+-- name: RetryOutboxMessage :execrows
+UPDATE "mail_outbox" SET "status" = 'scheduled', "lastError" = $2, "nextAttemptAt" = $3, "updatedAt" = NOW()
+WHERE "id" = $1 AND "status" = 'sending' AND "attempts" = $4;
+
+-- name: DeleteAccountOutbox :exec
+DELETE FROM "mail_outbox" WHERE "account" = $1;
+
+-- name: DeleteUserOutbox :exec
+DELETE FROM "mail_outbox" WHERE "senderId" = $1;
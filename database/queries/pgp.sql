@@ -0,0 +1,28 @@
+-- name: SetPgpKey :exec
+INSERT INTO "mail_pgp_keys" (
+    "account", "fingerprint", "publicKey", "privateKey", "passphrase"
+)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT ("account") DO UPDATE
+SET "fingerprint" = EXCLUDED."fingerprint", "publicKey" = EXCLUDED."publicKey",
+    "privateKey" = EXCLUDED."privateKey", "passphrase" = EXCLUDED."passphrase", "createdAt" = NOW();
+
+-- name: GetPgpKey :one
+SELECT * FROM "mail_pgp_keys" WHERE "account" = $1;
+
+-- name: DeletePgpKey :exec
+DELETE FROM "mail_pgp_keys" WHERE "account" = $1;
+
+-- name: AddPgpTrustedKey :exec
+INSERT INTO "mail_pgp_trusted_keys" ("account", "fingerprint", "publicKey")
+VALUES ($1, $2, $3)
+ON CONFLICT ("account", "fingerprint") DO UPDATE SET "publicKey" = EXCLUDED."publicKey";
+
+-- name: ListPgpTrustedKeys :many
+SELECT * FROM "mail_pgp_trusted_keys" WHERE "account" = $1 ORDER BY "createdAt" ASC;
+
+-- name: DeletePgpTrustedKey :execrows
+DELETE FROM "mail_pgp_trusted_keys" WHERE "account" = $1 AND "fingerprint" = $2;
+
+-- name: DeleteAccountPgpTrustedKeys :exec
+DELETE FROM "mail_pgp_trusted_keys" WHERE "account" = $1;
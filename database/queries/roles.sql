@@ -0,0 +1,30 @@
+-- name: AddRole :exec
+INSERT INTO "roles" ("id", "name", "color", "parents") VALUES ($1, $2, $3, $4);
+
+-- name: ListRoles :many
+SELECT * FROM "roles" ORDER BY "id" ASC;
+
+-- name: UpdateRole :execrows
+UPDATE "roles" SET "name" = $2, "color" = $3, "parents" = $4, "updatedAt" = NOW() WHERE "id" = $1;
+
+-- name: DeleteRole :execrows
+DELETE FROM "roles" WHERE "id" = $1;
+
+-- name: AddRolePermission :exec
+INSERT INTO "role_permissions" ("role", "resource", "action", "preset", "conditions")
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ListRolePermissions :many
+SELECT * FROM "role_permissions" ORDER BY "role" ASC, "id" ASC;
+
+-- name: DeleteRolePermissions :exec
+DELETE FROM "role_permissions" WHERE "role" = $1;
+
+-- name: LockRole :one
+SELECT "id" FROM "roles" WHERE "id" = $1 FOR UPDATE;
+
+-- name: LockRoleShared :one
+SELECT "id" FROM "roles" WHERE "id" = $1 FOR KEY SHARE;
+
+-- name: CountRoleUsers :one
+SELECT COUNT(*) FROM "users" WHERE "role" = $1;
@@ -0,0 +1,18 @@
+-- name: AddServiceCredential :one
+INSERT INTO "service_credentials" ("userId", "clientId", "secretHash")
+VALUES ($1, $2, $3) RETURNING *;
+
+-- name: GetServiceCredential :one
+SELECT * FROM "service_credentials" WHERE "clientId" = $1;
+
+-- name: ListServiceCredentials :many
+SELECT * FROM "service_credentials" WHERE "userId" = $1 ORDER BY "createdAt" DESC;
+
+-- name: TouchServiceCredential :exec
+UPDATE "service_credentials" SET "lastUsedAt" = NOW() WHERE "id" = $1;
+
+-- name: DeleteServiceCredential :execrows
+DELETE FROM "service_credentials" WHERE "userId" = $1 AND "id" = $2;
+
+-- name: DeleteServiceCredentials :exec
+DELETE FROM "service_credentials" WHERE "userId" = $1;
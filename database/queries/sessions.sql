@@ -1,12 +1,15 @@
 -- name: AddSession :one
-INSERT INTO "user_sessions" ("userId", "tokenHash", "userAgent", "ipAdress", "expiresAt")
-VALUES ($1, $2, $3, $4, $5) RETURNING *;
+INSERT INTO "user_sessions" ("userId", "actorId", "tokenHash", "userAgent", "ipAdress", "lastIpAdress", "browser", "os", "device", "newDevice", "expiresAt")
+VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $8, $9, $10) RETURNING *;
 
 -- name: GetSessionFromHash :one
 SELECT * FROM "user_sessions" WHERE "tokenHash" = $1;
 
+-- name: GetSessionById :one
+SELECT * FROM "user_sessions" WHERE "id" = $1;
+
 -- name: UpdateSession :exec
-UPDATE "user_sessions" SET "tokenHash" = $2, "expiresAt" = $3 WHERE "userId" = $1;
+UPDATE "user_sessions" SET "tokenHash" = $2, "expiresAt" = $3, "lastIpAdress" = $4, "lastSeenAt" = NOW() WHERE "id" = $1;
 
 -- name: DeleteSessionById :exec
 DELETE FROM "user_sessions" WHERE "userId" = $1 AND "id" = $2;
@@ -19,3 +22,22 @@ SELECT * FROM "user_sessions" WHERE "userId" = $1 ORDER BY "id" ASC;
 
 -- name: ClearUserSessions :exec
 DELETE FROM "user_sessions" WHERE "userId" = $1;
+
+-- name: ClearActorSessions :exec
+DELETE FROM "user_sessions" WHERE "actorId" = $1;
+
+-- name: AddConsumedRefreshToken :execrows
+INSERT INTO "consumed_refresh_tokens" ("tokenHash", "sessionId", "userId", "expiresAt")
+VALUES ($1, $2, $3, $4) ON CONFLICT ("tokenHash") DO NOTHING;
+
+-- name: GetConsumedRefreshToken :one
+SELECT * FROM "consumed_refresh_tokens" WHERE "tokenHash" = $1;
+
+-- name: DeleteSessionConsumedTokens :exec
+DELETE FROM "consumed_refresh_tokens" WHERE "userId" = $1 AND "sessionId" = $2;
+
+-- name: DeleteUserConsumedTokens :exec
+DELETE FROM "consumed_refresh_tokens" WHERE "userId" = $1;
+
+-- name: DeleteExpiredConsumedTokens :exec
+DELETE FROM "consumed_refresh_tokens" WHERE "expiresAt" <= NOW();
@@ -0,0 +1,9 @@
+-- name: AddSigningKey :exec
+INSERT INTO "signing_keys" ("kid", "algorithm", "privateKey", "activatesAt", "retiresAt", "expiresAt")
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: ListSigningKeys :many
+SELECT * FROM "signing_keys" WHERE "expiresAt" > NOW() ORDER BY "activatesAt";
+
+-- name: DeleteExpiredSigningKeys :exec
+DELETE FROM "signing_keys" WHERE "expiresAt" <= NOW();
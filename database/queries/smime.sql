@@ -0,0 +1,14 @@
+-- name: SetSmimeCert :exec
+INSERT INTO "mail_smime_certs" (
+    "account", "fingerprint", "certificate", "privateKey", "notAfter"
+)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT ("account") DO UPDATE
+SET "fingerprint" = EXCLUDED."fingerprint", "certificate" = EXCLUDED."certificate",
+    "privateKey" = EXCLUDED."privateKey", "notAfter" = EXCLUDED."notAfter", "createdAt" = NOW();
+
+-- name: GetSmimeCert :one
+SELECT * FROM "mail_smime_certs" WHERE "account" = $1;
+
+-- name: DeleteSmimeCert :exec
+DELETE FROM "mail_smime_certs" WHERE "account" = $1;
@@ -0,0 +1,18 @@
+-- name: AddUserToken :one
+INSERT INTO "user_tokens" ("userId", "name", "tokenHash", "scopes", "expiresAt")
+VALUES ($1, $2, $3, $4, $5) RETURNING *;
+
+-- name: GetUserTokenByHash :one
+SELECT * FROM "user_tokens" WHERE "tokenHash" = $1;
+
+-- name: ListUserTokens :many
+SELECT * FROM "user_tokens" WHERE "userId" = $1 ORDER BY "createdAt" DESC;
+
+-- name: TouchUserToken :exec
+UPDATE "user_tokens" SET "lastUsedAt" = NOW() WHERE "id" = $1;
+
+-- name: DeleteUserToken :execrows
+DELETE FROM "user_tokens" WHERE "userId" = $1 AND "id" = $2;
+
+-- name: DeleteUserTokens :exec
+DELETE FROM "user_tokens" WHERE "userId" = $1;
@@ -0,0 +1,44 @@
+-- name: SetUserTotp :exec
+INSERT INTO "user_totp" ("userId", "secret") VALUES ($1, $2)
+ON CONFLICT ("userId") DO UPDATE SET "secret" = $2, "enabled" = FALSE, "lastCounter" = 0, "recoveryCodes" = '{}';
+
+-- name: GetUserTotp :one
+SELECT * FROM "user_totp" WHERE "userId" = $1;
+
+-- name: EnableUserTotp :exec
+UPDATE "user_totp" SET "enabled" = TRUE, "recoveryCodes" = $2 WHERE "userId" = $1;
+
+-- name: UseTotpCounter :execrows
+UPDATE "user_totp" SET "lastCounter" = $2 WHERE "userId" = $1 AND "lastCounter" < $2;
+
+-- name: UseRecoveryCode :execrows
+UPDATE "user_totp" SET "recoveryCodes" = array_remove("recoveryCodes", sqlc.arg(code)::TEXT)
+WHERE "userId" = sqlc.arg(userId) AND sqlc.arg(code)::TEXT = ANY("recoveryCodes");
+
+-- name: FailUserTotp :exec
+UPDATE "user_totp"
+SET "failedAttempts" = CASE WHEN "failedAttempts" + 1 >= sqlc.arg(maxFailures)::INTEGER THEN 0 ELSE "failedAttempts" + 1 END,
+    "lockedUntil" = CASE WHEN "failedAttempts" + 1 >= sqlc.arg(maxFailures)::INTEGER THEN sqlc.arg(lockedUntil)::TIMESTAMPTZ ELSE "lockedUntil" END
+WHERE "userId" = sqlc.arg(userId);
+
+-- name: ResetUserTotpFailures :exec
+UPDATE "user_totp" SET "failedAttempts" = 0 WHERE "userId" = $1;
+
+-- name: DeleteUserTotp :exec
+DELETE FROM "user_totp" WHERE "userId" = $1;
+
+-- name: AddPendingLogin :exec
+INSERT INTO "pending_logins" ("tokenHash", "userId", "redirectTo", "expiresAt") VALUES ($1, $2, $3, $4);
+
+-- name: AttemptPendingLogin :one
+UPDATE "pending_logins" SET "attempts" = "attempts" + 1
+WHERE "tokenHash" = $1 AND "expiresAt" > NOW() RETURNING *;
+
+-- name: DeletePendingLogin :exec
+DELETE FROM "pending_logins" WHERE "tokenHash" = $1;
+
+-- name: DeleteUserPendingLogins :exec
+DELETE FROM "pending_logins" WHERE "userId" = $1;
+
+-- name: DeleteExpiredPendingLogins :exec
+DELETE FROM "pending_logins" WHERE "expiresAt" <= NOW();
@@ -1,6 +1,6 @@
 -- name: AddUser :one
-INSERT INTO "users" ("username", "name", "image", "email", "role")
-VALUES ($1, $2, $3, $4, $5) RETURNING *;
+INSERT INTO "users" ("username", "name", "image", "email", "role", "kind")
+VALUES ($1, $2, $3, $4, $5, $6) RETURNING *;
 
 -- name: GetUserByUsername :one
 SELECT * FROM "users" WHERE "username" = $1;
@@ -14,6 +14,12 @@ SELECT * FROM "users" WHERE "email" = $1;
 -- name: ListUsers :many
 SELECT * FROM "users" ORDER BY "id" ASC LIMIT $1 OFFSET $2;
 
+-- name: ListServiceAccounts :many
+SELECT * FROM "users" WHERE "kind" = 'service' ORDER BY "id" ASC;
+
+-- name: ListAssignedRoles :many
+SELECT DISTINCT "role" FROM "users" ORDER BY "role";
+
 -- name: ListUserNames :many
 SELECT "username" FROM "users";
 
@@ -21,4 +27,8 @@ SELECT "username" FROM "users";
 UPDATE "users" SET "username" = $2, "name" = $3, "image" = $4 WHERE "id" = $1;
 
 -- name: UpdateUserAdmin :exec
-UPDATE "users" SET "username" = $2, "email" = $3, "name" = $4, "image" = $5, "role" = $6 WHERE "id" = $1;
+UPDATE "users" SET "username" = $2, "email" = $3, "name" = $4, "image" = $5, "role" = $6,
+"roleVersion" = CASE WHEN "role" = $6 THEN "roleVersion" ELSE "roleVersion" + 1 END WHERE "id" = $1;
+
+-- name: DeleteUser :exec
+DELETE FROM "users" WHERE "id" = $1;
@@ -0,0 +1,25 @@
+-- name: AddWebauthnCredential :one
+INSERT INTO "webauthn_credentials" ("userId", "name", "credentialId", "publicKey", "attestationType", "transports", "aaguid", "signCount", "backupEligible", "backupState")
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *;
+
+-- name: ListWebauthnCredentials :many
+SELECT * FROM "webauthn_credentials" WHERE "userId" = $1 ORDER BY "createdAt" ASC;
+
+-- name: UpdateWebauthnCredential :exec
+UPDATE "webauthn_credentials" SET "signCount" = $2, "backupState" = $3 WHERE "credentialId" = $1;
+
+-- name: DeleteWebauthnCredential :execrows
+DELETE FROM "webauthn_credentials" WHERE "userId" = $1 AND "id" = $2;
+
+-- name: DeleteWebauthnCredentials :exec
+DELETE FROM "webauthn_credentials" WHERE "userId" = $1;
+
+-- name: AddWebauthnSession :exec
+INSERT INTO "webauthn_sessions" ("tokenHash", "data", "expiresAt") VALUES ($1, $2, $3);
+
+-- name: ConsumeWebauthnSession :one
+DELETE FROM "webauthn_sessions" WHERE "tokenHash" = $1 AND "expiresAt" > NOW()
+RETURNING "data";
+
+-- name: DeleteExpiredWebauthnSessions :exec
+DELETE FROM "webauthn_sessions" WHERE "expiresAt" <= NOW();
@@ -7,8 +7,29 @@ package repository
 
 import (
 	"context"
+	"time"
 )
 
+const acceptShareInvite = `-- name: AcceptShareInvite :execrows
+WITH invite AS (
+    DELETE FROM "mail_share_invites"
+    WHERE "id" = $1 AND "userId" = $2 AND "expiresAt" > NOW()
+    RETURNING "userId", "account", "permission"
+)
+INSERT INTO "mail_share" ("userId", "account", "permission")
+SELECT "userId", "account", "permission" FROM invite
+ON CONFLICT ("userId", "account") DO UPDATE
+SET "permission" = EXCLUDED."permission"
+`
+
+func (q *Queries) AcceptShareInvite(ctx context.Context, iD int32, userId int32) (int64, error) {
+	result, err := q.db.Exec(ctx, acceptShareInvite, iD, userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const addEmailAccount = `-- name: AddEmailAccount :one
 INSERT INTO "mail_accounts" (
     "ownerId", "email", "name", "username", "password"
@@ -55,6 +76,45 @@ func (q *Queries) AddShare(ctx context.Context, arg AddShareParams) error {
 	return err
 }
 
+const addShareInvite = `-- name: AddShareInvite :one
+INSERT INTO "mail_share_invites" (
+    "userId", "account", "invitedBy", "permission", "expiresAt"
+)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT ("userId", "account") DO UPDATE
+SET "invitedBy" = EXCLUDED."invitedBy", "permission" = EXCLUDED."permission", "expiresAt" = EXCLUDED."expiresAt"
+RETURNING id, "userId", account, "invitedBy", permission, "expiresAt", "createdAt"
+`
+
+type AddShareInviteParams struct {
+	UserId     int32     `json:"userId"`
+	Account    int32     `json:"account"`
+	InvitedBy  int32     `json:"invitedBy"`
+	Permission string    `json:"permission"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+func (q *Queries) AddShareInvite(ctx context.Context, arg AddShareInviteParams) (*MailShareInvite, error) {
+	row := q.db.QueryRow(ctx, addShareInvite,
+		arg.UserId,
+		arg.Account,
+		arg.InvitedBy,
+		arg.Permission,
+		arg.ExpiresAt,
+	)
+	var i MailShareInvite
+	err := row.Scan(
+		&i.ID,
+		&i.UserId,
+		&i.Account,
+		&i.InvitedBy,
+		&i.Permission,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
 const countUserMailAccounts = `-- name: CountUserMailAccounts :one
 SELECT COUNT(DISTINCT "mail_accounts"."id")
 FROM "mail_accounts"
@@ -69,6 +129,39 @@ func (q *Queries) CountUserMailAccounts(ctx context.Context, ownerid int32) (int
 	return count, err
 }
 
+const declineShareInvite = `-- name: DeclineShareInvite :execrows
+DELETE FROM "mail_share_invites"
+WHERE "id" = $1 AND "userId" = $2
+`
+
+func (q *Queries) DeclineShareInvite(ctx context.Context, iD int32, userId int32) (int64, error) {
+	result, err := q.db.Exec(ctx, declineShareInvite, iD, userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteAccountShareInvites = `-- name: DeleteAccountShareInvites :exec
+DELETE FROM "mail_share_invites"
+WHERE "account" = $1
+`
+
+func (q *Queries) DeleteAccountShareInvites(ctx context.Context, account int32) error {
+	_, err := q.db.Exec(ctx, deleteAccountShareInvites, account)
+	return err
+}
+
+const deleteAccountShares = `-- name: DeleteAccountShares :exec
+DELETE FROM "mail_share"
+WHERE "account" = $1
+`
+
+func (q *Queries) DeleteAccountShares(ctx context.Context, account int32) error {
+	_, err := q.db.Exec(ctx, deleteAccountShares, account)
+	return err
+}
+
 const deleteMailAccount = `-- name: DeleteMailAccount :exec
 DELETE FROM "mail_accounts" 
 WHERE "id" = $1
@@ -89,6 +182,36 @@ func (q *Queries) DeleteShare(ctx context.Context, userId int32, account int32)
 	return err
 }
 
+const deleteShareInvite = `-- name: DeleteShareInvite :exec
+DELETE FROM "mail_share_invites"
+WHERE "userId" = $1 AND "account" = $2
+`
+
+func (q *Queries) DeleteShareInvite(ctx context.Context, userId int32, account int32) error {
+	_, err := q.db.Exec(ctx, deleteShareInvite, userId, account)
+	return err
+}
+
+const deleteUserShareInvites = `-- name: DeleteUserShareInvites :exec
+DELETE FROM "mail_share_invites"
+WHERE "userId" = $1 OR "invitedBy" = $1
+`
+
+func (q *Queries) DeleteUserShareInvites(ctx context.Context, userid int32) error {
+	_, err := q.db.Exec(ctx, deleteUserShareInvites, userid)
+	return err
+}
+
+const deleteUserShares = `-- name: DeleteUserShares :exec
+DELETE FROM "mail_share"
+WHERE "userId" = $1
+`
+
+func (q *Queries) DeleteUserShares(ctx context.Context, userid int32) error {
+	_, err := q.db.Exec(ctx, deleteUserShares, userid)
+	return err
+}
+
 const getMailAccountByEmail = `-- name: GetMailAccountByEmail :one
 SELECT m.id, m."ownerId", m.email, m.name, m.username, m.password FROM "mail_accounts" m
 LEFT JOIN "mail_share" s ON m."id" = s."account"
@@ -131,6 +254,31 @@ func (q *Queries) GetMailAccountById(ctx context.Context, id int32) (*MailAccoun
 	return &i, err
 }
 
+const listAccountShareInvites = `-- name: ListAccountShareInvites :many
+SELECT "userId" FROM "mail_share_invites" WHERE "account" = $1 AND "expiresAt" > NOW()
+ORDER BY "userId"
+`
+
+func (q *Queries) ListAccountShareInvites(ctx context.Context, account int32) ([]int32, error) {
+	rows, err := q.db.Query(ctx, listAccountShareInvites, account)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var userId int32
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		items = append(items, userId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listAccountShares = `-- name: ListAccountShares :many
 SELECT "userId" FROM "mail_share" WHERE "account" = $1
 ORDER BY "userId"
@@ -156,6 +304,31 @@ func (q *Queries) ListAccountShares(ctx context.Context, account int32) ([]int32
 	return items, nil
 }
 
+const listOwnedMailAccountIds = `-- name: ListOwnedMailAccountIds :many
+SELECT "id" FROM "mail_accounts" WHERE "ownerId" = $1
+ORDER BY "id"
+`
+
+func (q *Queries) ListOwnedMailAccountIds(ctx context.Context, ownerid int32) ([]int32, error) {
+	rows, err := q.db.Query(ctx, listOwnedMailAccountIds, ownerid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int32
+	for rows.Next() {
+		var id int32
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUserMailAccounts = `-- name: ListUserMailAccounts :many
 SELECT DISTINCT mail_accounts.id, mail_accounts."ownerId", mail_accounts.email, mail_accounts.name, mail_accounts.username, mail_accounts.password FROM "mail_accounts"
 LEFT JOIN "mail_share" ON "mail_accounts"."id" = "mail_share"."account"
@@ -189,3 +362,50 @@ func (q *Queries) ListUserMailAccounts(ctx context.Context, ownerid int32) ([]*M
 	}
 	return items, nil
 }
+
+const listUserShareInvites = `-- name: ListUserShareInvites :many
+SELECT i."id", i."account", m."email", m."name", u."username" AS "invitedBy", i."expiresAt", i."createdAt"
+FROM "mail_share_invites" i
+JOIN "mail_accounts" m ON m."id" = i."account"
+JOIN "users" u ON u."id" = i."invitedBy"
+WHERE i."userId" = $1 AND i."expiresAt" > NOW()
+ORDER BY i."createdAt" DESC
+`
+
+type ListUserShareInvitesRow struct {
+	ID        int32     `json:"id"`
+	Account   int32     `json:"account"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	InvitedBy string    `json:"invitedBy"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (q *Queries) ListUserShareInvites(ctx context.Context, userid int32) ([]*ListUserShareInvitesRow, error) {
+	rows, err := q.db.Query(ctx, listUserShareInvites, userid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*ListUserShareInvitesRow
+	for rows.Next() {
+		var i ListUserShareInvitesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Account,
+			&i.Email,
+			&i.Name,
+			&i.InvitedBy,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
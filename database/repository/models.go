@@ -6,8 +6,35 @@ package repository
 
 import (
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AuditLog struct {
+	ID        int32     `json:"id"`
+	ActorId   int32     `json:"actorId"`
+	UserId    int32     `json:"userId"`
+	Event     string    `json:"event"`
+	Details   string    `json:"details"`
+	IpAdress  string    `json:"ipAdress"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ConsumedOauthRefreshToken struct {
+	TokenHash  string    `json:"tokenHash"`
+	GrantId    int32     `json:"grantId"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	ConsumedAt time.Time `json:"consumedAt"`
+}
+
+type ConsumedRefreshToken struct {
+	TokenHash  string    `json:"tokenHash"`
+	SessionId  int32     `json:"sessionId"`
+	UserId     int32     `json:"userId"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	ConsumedAt time.Time `json:"consumedAt"`
+}
+
 type MailAccount struct {
 	ID       int32  `json:"id"`
 	OwnerId  int32  `json:"ownerId"`
@@ -17,28 +44,238 @@ type MailAccount struct {
 	Password string `json:"password"`
 }
 
+type MailOutbox struct {
+	ID            int32     `json:"id"`
+	Account       int32     `json:"account"`
+	SenderId      int32     `json:"senderId"`
+	Recipients    []string  `json:"recipients"`
+	Subject       string    `json:"subject"`
+	Body          string    `json:"body"`
+	Sign          bool      `json:"sign"`
+	Encrypt       bool      `json:"encrypt"`
+	Scheme        string    `json:"scheme"`
+	RecipientKeys []string  `json:"recipientKeys"`
+	Status        string    `json:"status"`
+	Attempts      int32     `json:"attempts"`
+	LastError     string    `json:"lastError"`
+	SendAt        time.Time `json:"sendAt"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type MailPgpKey struct {
+	Account     int32     `json:"account"`
+	Fingerprint string    `json:"fingerprint"`
+	PublicKey   string    `json:"publicKey"`
+	PrivateKey  string    `json:"privateKey"`
+	Passphrase  string    `json:"passphrase"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type MailPgpTrustedKey struct {
+	Account     int32     `json:"account"`
+	Fingerprint string    `json:"fingerprint"`
+	PublicKey   string    `json:"publicKey"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
 type MailShare struct {
 	UserId     int32  `json:"userId"`
 	Account    int32  `json:"account"`
 	Permission string `json:"permission"`
 }
 
+type MailShareInvite struct {
+	ID         int32     `json:"id"`
+	UserId     int32     `json:"userId"`
+	Account    int32     `json:"account"`
+	InvitedBy  int32     `json:"invitedBy"`
+	Permission string    `json:"permission"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type MailSmimeCert struct {
+	Account     int32     `json:"account"`
+	Fingerprint string    `json:"fingerprint"`
+	Certificate string    `json:"certificate"`
+	PrivateKey  string    `json:"privateKey"`
+	NotAfter    time.Time `json:"notAfter"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type OauthClient struct {
+	ID           string    `json:"id"`
+	OwnerId      int32     `json:"ownerId"`
+	Name         string    `json:"name"`
+	SecretHash   string    `json:"secretHash"`
+	RedirectUris []string  `json:"redirectUris"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type OauthCode struct {
+	CodeHash      string    `json:"codeHash"`
+	ClientId      string    `json:"clientId"`
+	UserId        int32     `json:"userId"`
+	RedirectUri   string    `json:"redirectUri"`
+	Scopes        []string  `json:"scopes"`
+	CodeChallenge string    `json:"codeChallenge"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type OauthState struct {
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OauthToken struct {
+	ID               int32              `json:"id"`
+	ClientId         string             `json:"clientId"`
+	UserId           int32              `json:"userId"`
+	Scopes           []string           `json:"scopes"`
+	AccessTokenHash  string             `json:"accessTokenHash"`
+	RefreshTokenHash string             `json:"refreshTokenHash"`
+	AccessExpiresAt  time.Time          `json:"accessExpiresAt"`
+	RefreshExpiresAt time.Time          `json:"refreshExpiresAt"`
+	LastUsedAt       pgtype.Timestamptz `json:"lastUsedAt"`
+	CreatedAt        time.Time          `json:"createdAt"`
+}
+
+type PendingLogin struct {
+	TokenHash  string    `json:"tokenHash"`
+	UserId     int32     `json:"userId"`
+	RedirectTo string    `json:"redirectTo"`
+	Attempts   int32     `json:"attempts"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type Role struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	Parents   []string  `json:"parents"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type RolePermission struct {
+	ID         int32    `json:"id"`
+	Role       string   `json:"role"`
+	Resource   string   `json:"resource"`
+	Action     string   `json:"action"`
+	Preset     string   `json:"preset"`
+	Conditions []string `json:"conditions"`
+}
+
+type ServiceCredential struct {
+	ID         int32              `json:"id"`
+	UserId     int32              `json:"userId"`
+	ClientId   string             `json:"clientId"`
+	SecretHash string             `json:"secretHash"`
+	LastUsedAt pgtype.Timestamptz `json:"lastUsedAt"`
+	CreatedAt  time.Time          `json:"createdAt"`
+}
+
+type SigningKey struct {
+	Kid         string    `json:"kid"`
+	Algorithm   string    `json:"algorithm"`
+	PrivateKey  string    `json:"privateKey"`
+	ActivatesAt time.Time `json:"activatesAt"`
+	RetiresAt   time.Time `json:"retiresAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
 type User struct {
+	ID          int32     `json:"id"`
+	Username    string    `json:"username"`
+	Name        string    `json:"name"`
+	Image       string    `json:"image"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	RoleVersion int32     `json:"roleVersion"`
+	Kind        string    `json:"kind"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type UserDevice struct {
+	UserId      int32     `json:"userId"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type UserIdentity struct {
 	ID        int32     `json:"id"`
-	Username  string    `json:"username"`
-	Name      string    `json:"name"`
-	Image     string    `json:"image"`
+	UserId    int32     `json:"userId"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
 	Email     string    `json:"email"`
-	Role      string    `json:"role"`
+	Verified  bool      `json:"verified"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
 type UserSession struct {
-	ID        int32     `json:"id"`
-	UserId    int32     `json:"userId"`
+	ID           int32       `json:"id"`
+	UserId       int32       `json:"userId"`
+	ActorId      pgtype.Int4 `json:"actorId"`
+	TokenHash    string      `json:"tokenHash"`
+	UserAgent    string      `json:"userAgent"`
+	IpAdress     string      `json:"ipAdress"`
+	Browser      string      `json:"browser"`
+	Os           string      `json:"os"`
+	Device       string      `json:"device"`
+	NewDevice    bool        `json:"newDevice"`
+	LastIpAdress string      `json:"lastIpAdress"`
+	LastSeenAt   time.Time   `json:"lastSeenAt"`
+	ExpiresAt    time.Time   `json:"expiresAt"`
+	CreatedAt    time.Time   `json:"createdAt"`
+}
+
+type UserToken struct {
+	ID         int32              `json:"id"`
+	UserId     int32              `json:"userId"`
+	Name       string             `json:"name"`
+	TokenHash  string             `json:"tokenHash"`
+	Scopes     []string           `json:"scopes"`
+	ExpiresAt  time.Time          `json:"expiresAt"`
+	LastUsedAt pgtype.Timestamptz `json:"lastUsedAt"`
+	CreatedAt  time.Time          `json:"createdAt"`
+}
+
+type UserTotp struct {
+	UserId         int32     `json:"userId"`
+	Secret         string    `json:"secret"`
+	Enabled        bool      `json:"enabled"`
+	LastCounter    int64     `json:"lastCounter"`
+	RecoveryCodes  []string  `json:"recoveryCodes"`
+	FailedAttempts int32     `json:"failedAttempts"`
+	LockedUntil    time.Time `json:"lockedUntil"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+type WebauthnCredential struct {
+	ID              int32     `json:"id"`
+	UserId          int32     `json:"userId"`
+	Name            string    `json:"name"`
+	CredentialId    []byte    `json:"credentialId"`
+	PublicKey       []byte    `json:"publicKey"`
+	AttestationType string    `json:"attestationType"`
+	Transports      []string  `json:"transports"`
+	Aaguid          []byte    `json:"aaguid"`
+	SignCount       int64     `json:"signCount"`
+	BackupEligible  bool      `json:"backupEligible"`
+	BackupState     bool      `json:"backupState"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+type WebauthnSession struct {
 	TokenHash string    `json:"tokenHash"`
-	UserAgent string    `json:"userAgent"`
-	IpAdress  string    `json:"ipAdress"`
+	Data      string    `json:"data"`
 	ExpiresAt time.Time `json:"expiresAt"`
 	CreatedAt time.Time `json:"createdAt"`
 }
@@ -6,33 +6,165 @@ package repository
 
 import (
 	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
+	AcceptShareInvite(ctx context.Context, iD int32, userId int32) (int64, error)
+	AddAuditLog(ctx context.Context, arg AddAuditLogParams) error
+	AddConsumedOAuthRefreshToken(ctx context.Context, arg AddConsumedOAuthRefreshTokenParams) error
+	AddConsumedRefreshToken(ctx context.Context, arg AddConsumedRefreshTokenParams) (int64, error)
 	AddEmailAccount(ctx context.Context, arg AddEmailAccountParams) (int32, error)
+	AddOAuthClient(ctx context.Context, arg AddOAuthClientParams) (*OauthClient, error)
+	AddOAuthCode(ctx context.Context, arg AddOAuthCodeParams) error
+	AddOAuthState(ctx context.Context, arg AddOAuthStateParams) error
+	AddOAuthToken(ctx context.Context, arg AddOAuthTokenParams) (*OauthToken, error)
+	AddOutboxMessage(ctx context.Context, arg AddOutboxMessageParams) (*MailOutbox, error)
+	AddPendingLogin(ctx context.Context, arg AddPendingLoginParams) error
+	AddPgpTrustedKey(ctx context.Context, arg AddPgpTrustedKeyParams) error
+	AddRole(ctx context.Context, arg AddRoleParams) error
+	AddRolePermission(ctx context.Context, arg AddRolePermissionParams) error
+	AddServiceCredential(ctx context.Context, arg AddServiceCredentialParams) (*ServiceCredential, error)
 	AddSession(ctx context.Context, arg AddSessionParams) (*UserSession, error)
 	AddShare(ctx context.Context, arg AddShareParams) error
+	AddShareInvite(ctx context.Context, arg AddShareInviteParams) (*MailShareInvite, error)
+	AddSigningKey(ctx context.Context, arg AddSigningKeyParams) error
 	AddUser(ctx context.Context, arg AddUserParams) (*User, error)
+	AddUserDevice(ctx context.Context, userId int32, fingerprint string) (int64, error)
+	AddUserIdentity(ctx context.Context, arg AddUserIdentityParams) (*UserIdentity, error)
+	AddUserToken(ctx context.Context, arg AddUserTokenParams) (*UserToken, error)
+	AddWebauthnCredential(ctx context.Context, arg AddWebauthnCredentialParams) (*WebauthnCredential, error)
+	AddWebauthnSession(ctx context.Context, arg AddWebauthnSessionParams) error
+	AttemptPendingLogin(ctx context.Context, tokenhash string) (*PendingLogin, error)
+	CancelOutboxMessage(ctx context.Context, id int32) (int64, error)
+	ClaimDueOutboxMessages(ctx context.Context, limit int32) ([]*MailOutbox, error)
+	ClearActorSessions(ctx context.Context, actorid pgtype.Int4) error
 	ClearUserSessions(ctx context.Context, userid int32) error
+	ConsumeOAuthCode(ctx context.Context, codehash string) (*OauthCode, error)
+	ConsumeOAuthState(ctx context.Context, nonce string) (string, error)
+	ConsumeWebauthnSession(ctx context.Context, tokenhash string) (string, error)
+	CountRoleUsers(ctx context.Context, role string) (int64, error)
+	CountUserDevices(ctx context.Context, userid int32) (int64, error)
+	CountUserIdentities(ctx context.Context, userid int32) (int64, error)
 	CountUserMailAccounts(ctx context.Context, ownerid int32) (int64, error)
+	DeclineShareInvite(ctx context.Context, iD int32, userId int32) (int64, error)
+	DeleteAccountOutbox(ctx context.Context, account int32) error
+	DeleteAccountPgpTrustedKeys(ctx context.Context, account int32) error
+	DeleteAccountShareInvites(ctx context.Context, account int32) error
+	DeleteAccountShares(ctx context.Context, account int32) error
+	DeleteClientOAuthCodes(ctx context.Context, clientid string) error
+	DeleteClientOAuthTokens(ctx context.Context, clientid string) error
+	DeleteExpiredConsumedOAuthTokens(ctx context.Context) error
+	DeleteExpiredConsumedTokens(ctx context.Context) error
+	DeleteExpiredOAuthCodes(ctx context.Context) error
+	DeleteExpiredOAuthStates(ctx context.Context) error
+	DeleteExpiredOAuthTokens(ctx context.Context) error
+	DeleteExpiredPendingLogins(ctx context.Context) error
+	DeleteExpiredSigningKeys(ctx context.Context) error
+	DeleteExpiredWebauthnSessions(ctx context.Context) error
+	DeleteGrantConsumedOAuthTokens(ctx context.Context, grantid int32) error
 	DeleteMailAccount(ctx context.Context, id int32) error
+	DeleteOAuthClient(ctx context.Context, id string) error
+	DeleteOAuthToken(ctx context.Context, id int32) error
+	DeletePendingLogin(ctx context.Context, tokenhash string) error
+	DeletePgpKey(ctx context.Context, account int32) error
+	DeletePgpTrustedKey(ctx context.Context, account int32, fingerprint string) (int64, error)
+	DeleteRole(ctx context.Context, id string) (int64, error)
+	DeleteRolePermissions(ctx context.Context, role string) error
+	DeleteServiceCredential(ctx context.Context, userId int32, iD int32) (int64, error)
+	DeleteServiceCredentials(ctx context.Context, userid int32) error
 	DeleteSessionByHash(ctx context.Context, tokenhash string) error
 	DeleteSessionById(ctx context.Context, userId int32, iD int32) error
+	DeleteSessionConsumedTokens(ctx context.Context, userId int32, sessionId int32) error
 	DeleteShare(ctx context.Context, userId int32, account int32) error
+	DeleteShareInvite(ctx context.Context, userId int32, account int32) error
+	DeleteSmimeCert(ctx context.Context, account int32) error
+	DeleteUser(ctx context.Context, id int32) error
+	DeleteUserAuthorization(ctx context.Context, userId int32, iD int32) (int64, error)
+	DeleteUserConsumedTokens(ctx context.Context, userid int32) error
+	DeleteUserDevices(ctx context.Context, userid int32) error
+	DeleteUserIdentities(ctx context.Context, userid int32) error
+	DeleteUserIdentity(ctx context.Context, userId int32, iD int32) (int64, error)
+	DeleteUserOAuthCodes(ctx context.Context, userid int32) error
+	DeleteUserOAuthTokens(ctx context.Context, userid int32) error
+	DeleteUserOutbox(ctx context.Context, senderid int32) error
+	DeleteUserPendingLogins(ctx context.Context, userid int32) error
+	DeleteUserShareInvites(ctx context.Context, userid int32) error
+	DeleteUserShares(ctx context.Context, userid int32) error
+	DeleteUserToken(ctx context.Context, userId int32, iD int32) (int64, error)
+	DeleteUserTokens(ctx context.Context, userid int32) error
+	DeleteUserTotp(ctx context.Context, userid int32) error
+	DeleteWebauthnCredential(ctx context.Context, userId int32, iD int32) (int64, error)
+	DeleteWebauthnCredentials(ctx context.Context, userid int32) error
+	EnableUserTotp(ctx context.Context, userId int32, recoveryCodes []string) error
+	FailUserTotp(ctx context.Context, arg FailUserTotpParams) error
+	GetConsumedOAuthRefreshToken(ctx context.Context, tokenhash string) (*ConsumedOauthRefreshToken, error)
+	GetConsumedRefreshToken(ctx context.Context, tokenhash string) (*ConsumedRefreshToken, error)
 	GetMailAccountByEmail(ctx context.Context, email string) (*MailAccount, error)
 	GetMailAccountById(ctx context.Context, id int32) (*MailAccount, error)
+	GetOAuthClient(ctx context.Context, id string) (*OauthClient, error)
+	GetOAuthTokenByAccessHash(ctx context.Context, accesstokenhash string) (*OauthToken, error)
+	GetOAuthTokenByRefreshHash(ctx context.Context, refreshtokenhash string) (*OauthToken, error)
+	GetOutboxMessage(ctx context.Context, id int32) (*MailOutbox, error)
+	GetPgpKey(ctx context.Context, account int32) (*MailPgpKey, error)
+	GetServiceCredential(ctx context.Context, clientid string) (*ServiceCredential, error)
+	GetSessionById(ctx context.Context, id int32) (*UserSession, error)
 	GetSessionFromHash(ctx context.Context, tokenhash string) (*UserSession, error)
+	GetSmimeCert(ctx context.Context, account int32) (*MailSmimeCert, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	GetUserById(ctx context.Context, id int32) (*User, error)
 	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	GetUserIdentity(ctx context.Context, provider string, subject string) (*UserIdentity, error)
 	GetUserSessions(ctx context.Context, userid int32) ([]*UserSession, error)
+	GetUserTokenByHash(ctx context.Context, tokenhash string) (*UserToken, error)
+	GetUserTotp(ctx context.Context, userid int32) (*UserTotp, error)
+	ListAccountOutbox(ctx context.Context, account int32) ([]*MailOutbox, error)
+	ListAccountShareInvites(ctx context.Context, account int32) ([]int32, error)
 	ListAccountShares(ctx context.Context, account int32) ([]int32, error)
+	ListAssignedRoles(ctx context.Context) ([]string, error)
+	ListOwnedMailAccountIds(ctx context.Context, ownerid int32) ([]int32, error)
+	ListOwnedOAuthClientIds(ctx context.Context, ownerid int32) ([]string, error)
+	ListPgpTrustedKeys(ctx context.Context, account int32) ([]*MailPgpTrustedKey, error)
+	ListRolePermissions(ctx context.Context) ([]*RolePermission, error)
+	ListRoles(ctx context.Context) ([]*Role, error)
+	ListServiceAccounts(ctx context.Context) ([]*User, error)
+	ListServiceCredentials(ctx context.Context, userid int32) ([]*ServiceCredential, error)
+	ListSigningKeys(ctx context.Context) ([]*SigningKey, error)
+	ListUserAuthorizations(ctx context.Context, userid int32) ([]*ListUserAuthorizationsRow, error)
+	ListUserIdentities(ctx context.Context, userid int32) ([]*UserIdentity, error)
 	ListUserMailAccounts(ctx context.Context, ownerid int32) ([]*MailAccount, error)
 	ListUserNames(ctx context.Context) ([]string, error)
+	ListUserOAuthClients(ctx context.Context, ownerid int32) ([]*OauthClient, error)
+	ListUserShareInvites(ctx context.Context, userid int32) ([]*ListUserShareInvitesRow, error)
+	ListUserTokens(ctx context.Context, userid int32) ([]*UserToken, error)
 	ListUsers(ctx context.Context, limit int32, offset int32) ([]*User, error)
+	ListWebauthnCredentials(ctx context.Context, userid int32) ([]*WebauthnCredential, error)
+	LockRole(ctx context.Context, id string) (string, error)
+	LockRoleShared(ctx context.Context, id string) (string, error)
+	LockUserDevices(ctx context.Context, id int32) error
+	LockUserIdentities(ctx context.Context, userid int32) ([]*UserIdentity, error)
+	MarkOutboxMessageFailed(ctx context.Context, arg MarkOutboxMessageFailedParams) (int64, error)
+	MarkOutboxMessageSent(ctx context.Context, iD int32, attempts int32) (int64, error)
+	ReleaseStaleOutboxMessages(ctx context.Context, updatedat time.Time) error
+	ResetUserTotpFailures(ctx context.Context, userid int32) error
+	RetryOutboxMessage(ctx context.Context, arg RetryOutboxMessageParams) (int64, error)
+	RotateOAuthToken(ctx context.Context, arg RotateOAuthTokenParams) (*OauthToken, error)
+	SetPgpKey(ctx context.Context, arg SetPgpKeyParams) error
+	SetSmimeCert(ctx context.Context, arg SetSmimeCertParams) error
+	SetUserTotp(ctx context.Context, userId int32, secret string) error
+	TouchOAuthToken(ctx context.Context, id int32) error
+	TouchServiceCredential(ctx context.Context, id int32) error
+	TouchUserToken(ctx context.Context, id int32) error
+	UpdateRole(ctx context.Context, arg UpdateRoleParams) (int64, error)
 	UpdateSession(ctx context.Context, arg UpdateSessionParams) error
 	UpdateUser(ctx context.Context, arg UpdateUserParams) error
 	UpdateUserAdmin(ctx context.Context, arg UpdateUserAdminParams) error
+	UpdateUserIdentity(ctx context.Context, arg UpdateUserIdentityParams) error
+	UpdateWebauthnCredential(ctx context.Context, arg UpdateWebauthnCredentialParams) error
+	UseRecoveryCode(ctx context.Context, code string, userId int32) (int64, error)
+	UseTotpCounter(ctx context.Context, userId int32, lastCounter int64) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
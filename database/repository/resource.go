@@ -3,6 +3,7 @@ package repository
 const (
 	ResourceUser         string = "user"
 	ResourceMailAccount  string = "email_account"
+	ResourceRole         string = "role"
 )
 
 func (profile *User) GetResourceName() string { return ResourceUser }
@@ -10,3 +11,7 @@ func (profile *User) GetOwner() int32         { return profile.ID }
 
 func (account *MailAccount) GetResourceName() string { return ResourceMailAccount }
 func (account *MailAccount) GetOwner() int32         { return account.OwnerId }
+
+// roles belong to nobody, only the policy grants access to them
+func (role *Role) GetResourceName() string { return ResourceRole }
+func (role *Role) GetOwner() int32         { return 0 }
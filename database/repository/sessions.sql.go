@@ -8,42 +8,95 @@ package repository
 import (
 	"context"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const addSession = `-- name: AddSession :one
-INSERT INTO "user_sessions" ("userId", "tokenHash", "userAgent", "ipAdress", "expiresAt")
-VALUES ($1, $2, $3, $4, $5) RETURNING id, "userId", "tokenHash", "userAgent", "ipAdress", "expiresAt", "createdAt"
+const addConsumedRefreshToken = `-- name: AddConsumedRefreshToken :execrows
+INSERT INTO "consumed_refresh_tokens" ("tokenHash", "sessionId", "userId", "expiresAt")
+VALUES ($1, $2, $3, $4) ON CONFLICT ("tokenHash") DO NOTHING
 `
 
-type AddSessionParams struct {
-	UserId    int32     `json:"userId"`
+type AddConsumedRefreshTokenParams struct {
 	TokenHash string    `json:"tokenHash"`
-	UserAgent string    `json:"userAgent"`
-	IpAdress  string    `json:"ipAdress"`
+	SessionId int32     `json:"sessionId"`
+	UserId    int32     `json:"userId"`
 	ExpiresAt time.Time `json:"expiresAt"`
 }
 
+func (q *Queries) AddConsumedRefreshToken(ctx context.Context, arg AddConsumedRefreshTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, addConsumedRefreshToken,
+		arg.TokenHash,
+		arg.SessionId,
+		arg.UserId,
+		arg.ExpiresAt,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const addSession = `-- name: AddSession :one
+INSERT INTO "user_sessions" ("userId", "actorId", "tokenHash", "userAgent", "ipAdress", "lastIpAdress", "browser", "os", "device", "newDevice", "expiresAt")
+VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $8, $9, $10) RETURNING id, "userId", "actorId", "tokenHash", "userAgent", "ipAdress", browser, os, device, "newDevice", "lastIpAdress", "lastSeenAt", "expiresAt", "createdAt"
+`
+
+type AddSessionParams struct {
+	UserId    int32       `json:"userId"`
+	ActorId   pgtype.Int4 `json:"actorId"`
+	TokenHash string      `json:"tokenHash"`
+	UserAgent string      `json:"userAgent"`
+	IpAdress  string      `json:"ipAdress"`
+	Browser   string      `json:"browser"`
+	Os        string      `json:"os"`
+	Device    string      `json:"device"`
+	NewDevice bool        `json:"newDevice"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+}
+
 func (q *Queries) AddSession(ctx context.Context, arg AddSessionParams) (*UserSession, error) {
 	row := q.db.QueryRow(ctx, addSession,
 		arg.UserId,
+		arg.ActorId,
 		arg.TokenHash,
 		arg.UserAgent,
 		arg.IpAdress,
+		arg.Browser,
+		arg.Os,
+		arg.Device,
+		arg.NewDevice,
 		arg.ExpiresAt,
 	)
 	var i UserSession
 	err := row.Scan(
 		&i.ID,
 		&i.UserId,
+		&i.ActorId,
 		&i.TokenHash,
 		&i.UserAgent,
 		&i.IpAdress,
+		&i.Browser,
+		&i.Os,
+		&i.Device,
+		&i.NewDevice,
+		&i.LastIpAdress,
+		&i.LastSeenAt,
 		&i.ExpiresAt,
 		&i.CreatedAt,
 	)
 	return &i, err
 }
 
+const clearActorSessions = `-- name: ClearActorSessions :exec
+DELETE FROM "user_sessions" WHERE "actorId" = $1
+`
+
+func (q *Queries) ClearActorSessions(ctx context.Context, actorid pgtype.Int4) error {
+	_, err := q.db.Exec(ctx, clearActorSessions, actorid)
+	return err
+}
+
 const clearUserSessions = `-- name: ClearUserSessions :exec
 DELETE FROM "user_sessions" WHERE "userId" = $1
 `
@@ -53,6 +106,15 @@ func (q *Queries) ClearUserSessions(ctx context.Context, userid int32) error {
 	return err
 }
 
+const deleteExpiredConsumedTokens = `-- name: DeleteExpiredConsumedTokens :exec
+DELETE FROM "consumed_refresh_tokens" WHERE "expiresAt" <= NOW()
+`
+
+func (q *Queries) DeleteExpiredConsumedTokens(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredConsumedTokens)
+	return err
+}
+
 const deleteSessionByHash = `-- name: DeleteSessionByHash :exec
 DELETE FROM "user_sessions" WHERE "tokenHash" = $1
 `
@@ -71,8 +133,69 @@ func (q *Queries) DeleteSessionById(ctx context.Context, userId int32, iD int32)
 	return err
 }
 
+const deleteSessionConsumedTokens = `-- name: DeleteSessionConsumedTokens :exec
+DELETE FROM "consumed_refresh_tokens" WHERE "userId" = $1 AND "sessionId" = $2
+`
+
+func (q *Queries) DeleteSessionConsumedTokens(ctx context.Context, userId int32, sessionId int32) error {
+	_, err := q.db.Exec(ctx, deleteSessionConsumedTokens, userId, sessionId)
+	return err
+}
+
+const deleteUserConsumedTokens = `-- name: DeleteUserConsumedTokens :exec
+DELETE FROM "consumed_refresh_tokens" WHERE "userId" = $1
+`
+
+func (q *Queries) DeleteUserConsumedTokens(ctx context.Context, userid int32) error {
+	_, err := q.db.Exec(ctx, deleteUserConsumedTokens, userid)
+	return err
+}
+
+const getConsumedRefreshToken = `-- name: GetConsumedRefreshToken :one
+SELECT "tokenHash", "sessionId", "userId", "expiresAt", "consumedAt" FROM "consumed_refresh_tokens" WHERE "tokenHash" = $1
+`
+
+func (q *Queries) GetConsumedRefreshToken(ctx context.Context, tokenhash string) (*ConsumedRefreshToken, error) {
+	row := q.db.QueryRow(ctx, getConsumedRefreshToken, tokenhash)
+	var i ConsumedRefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.SessionId,
+		&i.UserId,
+		&i.ExpiresAt,
+		&i.ConsumedAt,
+	)
+	return &i, err
+}
+
+const getSessionById = `-- name: GetSessionById :one
+SELECT id, "userId", "actorId", "tokenHash", "userAgent", "ipAdress", browser, os, device, "newDevice", "lastIpAdress", "lastSeenAt", "expiresAt", "createdAt" FROM "user_sessions" WHERE "id" = $1
+`
+
+func (q *Queries) GetSessionById(ctx context.Context, id int32) (*UserSession, error) {
+	row := q.db.QueryRow(ctx, getSessionById, id)
+	var i UserSession
+	err := row.Scan(
+		&i.ID,
+		&i.UserId,
+		&i.ActorId,
+		&i.TokenHash,
+		&i.UserAgent,
+		&i.IpAdress,
+		&i.Browser,
+		&i.Os,
+		&i.Device,
+		&i.NewDevice,
+		&i.LastIpAdress,
+		&i.LastSeenAt,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return &i, err
+}
+
 const getSessionFromHash = `-- name: GetSessionFromHash :one
-SELECT id, "userId", "tokenHash", "userAgent", "ipAdress", "expiresAt", "createdAt" FROM "user_sessions" WHERE "tokenHash" = $1
+SELECT id, "userId", "actorId", "tokenHash", "userAgent", "ipAdress", browser, os, device, "newDevice", "lastIpAdress", "lastSeenAt", "expiresAt", "createdAt" FROM "user_sessions" WHERE "tokenHash" = $1
 `
 
 func (q *Queries) GetSessionFromHash(ctx context.Context, tokenhash string) (*UserSession, error) {
@@ -81,9 +204,16 @@ func (q *Queries) GetSessionFromHash(ctx context.Context, tokenhash string) (*Us
 	err := row.Scan(
 		&i.ID,
 		&i.UserId,
+		&i.ActorId,
 		&i.TokenHash,
 		&i.UserAgent,
 		&i.IpAdress,
+		&i.Browser,
+		&i.Os,
+		&i.Device,
+		&i.NewDevice,
+		&i.LastIpAdress,
+		&i.LastSeenAt,
 		&i.ExpiresAt,
 		&i.CreatedAt,
 	)
@@ -91,7 +221,7 @@ func (q *Queries) GetSessionFromHash(ctx context.Context, tokenhash string) (*Us
 }
 
 const getUserSessions = `-- name: GetUserSessions :many
-SELECT id, "userId", "tokenHash", "userAgent", "ipAdress", "expiresAt", "createdAt" FROM "user_sessions" WHERE "userId" = $1 ORDER BY "id" ASC
+SELECT id, "userId", "actorId", "tokenHash", "userAgent", "ipAdress", browser, os, device, "newDevice", "lastIpAdress", "lastSeenAt", "expiresAt", "createdAt" FROM "user_sessions" WHERE "userId" = $1 ORDER BY "id" ASC
 `
 
 func (q *Queries) GetUserSessions(ctx context.Context, userid int32) ([]*UserSession, error) {
@@ -106,9 +236,16 @@ func (q *Queries) GetUserSessions(ctx context.Context, userid int32) ([]*UserSes
 		if err := rows.Scan(
 			&i.ID,
 			&i.UserId,
+			&i.ActorId,
 			&i.TokenHash,
 			&i.UserAgent,
 			&i.IpAdress,
+			&i.Browser,
+			&i.Os,
+			&i.Device,
+			&i.NewDevice,
+			&i.LastIpAdress,
+			&i.LastSeenAt,
 			&i.ExpiresAt,
 			&i.CreatedAt,
 		); err != nil {
@@ -123,16 +260,22 @@ func (q *Queries) GetUserSessions(ctx context.Context, userid int32) ([]*UserSes
 }
 
 const updateSession = `-- name: UpdateSession :exec
-UPDATE "user_sessions" SET "tokenHash" = $2, "expiresAt" = $3 WHERE "userId" = $1
+UPDATE "user_sessions" SET "tokenHash" = $2, "expiresAt" = $3, "lastIpAdress" = $4, "lastSeenAt" = NOW() WHERE "id" = $1
 `
 
 type UpdateSessionParams struct {
-	UserId    int32     `json:"userId"`
-	TokenHash string    `json:"tokenHash"`
-	ExpiresAt time.Time `json:"expiresAt"`
+	ID           int32     `json:"id"`
+	TokenHash    string    `json:"tokenHash"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	LastIpAdress string    `json:"lastIpAdress"`
 }
 
 func (q *Queries) UpdateSession(ctx context.Context, arg UpdateSessionParams) error {
-	_, err := q.db.Exec(ctx, updateSession, arg.UserId, arg.TokenHash, arg.ExpiresAt)
+	_, err := q.db.Exec(ctx, updateSession,
+		arg.ID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+		arg.LastIpAdress,
+	)
 	return err
 }
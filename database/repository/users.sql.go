@@ -10,8 +10,8 @@ import (
 )
 
 const addUser = `-- name: AddUser :one
-INSERT INTO "users" ("username", "name", "image", "email", "role")
-VALUES ($1, $2, $3, $4, $5) RETURNING id, username, name, image, email, role, "createdAt"
+INSERT INTO "users" ("username", "name", "image", "email", "role", "kind")
+VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, username, name, image, email, role, "roleVersion", kind, "createdAt"
 `
 
 type AddUserParams struct {
@@ -20,6 +20,7 @@ type AddUserParams struct {
 	Image    string `json:"image"`
 	Email    string `json:"email"`
 	Role     string `json:"role"`
+	Kind     string `json:"kind"`
 }
 
 func (q *Queries) AddUser(ctx context.Context, arg AddUserParams) (*User, error) {
@@ -29,6 +30,7 @@ func (q *Queries) AddUser(ctx context.Context, arg AddUserParams) (*User, error)
 		arg.Image,
 		arg.Email,
 		arg.Role,
+		arg.Kind,
 	)
 	var i User
 	err := row.Scan(
@@ -38,13 +40,24 @@ func (q *Queries) AddUser(ctx context.Context, arg AddUserParams) (*User, error)
 		&i.Image,
 		&i.Email,
 		&i.Role,
+		&i.RoleVersion,
+		&i.Kind,
 		&i.CreatedAt,
 	)
 	return &i, err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM "users" WHERE "id" = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, deleteUser, id)
+	return err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, username, name, image, email, role, "createdAt" FROM "users" WHERE "email" = $1
+SELECT id, username, name, image, email, role, "roleVersion", kind, "createdAt" FROM "users" WHERE "email" = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (*User, error) {
@@ -57,13 +70,15 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (*User, erro
 		&i.Image,
 		&i.Email,
 		&i.Role,
+		&i.RoleVersion,
+		&i.Kind,
 		&i.CreatedAt,
 	)
 	return &i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, username, name, image, email, role, "createdAt" FROM "users" WHERE "id" = $1
+SELECT id, username, name, image, email, role, "roleVersion", kind, "createdAt" FROM "users" WHERE "id" = $1
 `
 
 func (q *Queries) GetUserById(ctx context.Context, id int32) (*User, error) {
@@ -76,13 +91,15 @@ func (q *Queries) GetUserById(ctx context.Context, id int32) (*User, error) {
 		&i.Image,
 		&i.Email,
 		&i.Role,
+		&i.RoleVersion,
+		&i.Kind,
 		&i.CreatedAt,
 	)
 	return &i, err
 }
 
 const getUserByUsername = `-- name: GetUserByUsername :one
-SELECT id, username, name, image, email, role, "createdAt" FROM "users" WHERE "username" = $1
+SELECT id, username, name, image, email, role, "roleVersion", kind, "createdAt" FROM "users" WHERE "username" = $1
 `
 
 func (q *Queries) GetUserByUsername(ctx context.Context, username string) (*User, error) {
@@ -95,11 +112,71 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (*User
 		&i.Image,
 		&i.Email,
 		&i.Role,
+		&i.RoleVersion,
+		&i.Kind,
 		&i.CreatedAt,
 	)
 	return &i, err
 }
 
+const listAssignedRoles = `-- name: ListAssignedRoles :many
+SELECT DISTINCT "role" FROM "users" ORDER BY "role"
+`
+
+func (q *Queries) ListAssignedRoles(ctx context.Context) ([]string, error) {
+	rows, err := q.db.Query(ctx, listAssignedRoles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		items = append(items, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listServiceAccounts = `-- name: ListServiceAccounts :many
+SELECT id, username, name, image, email, role, "roleVersion", kind, "createdAt" FROM "users" WHERE "kind" = 'service' ORDER BY "id" ASC
+`
+
+func (q *Queries) ListServiceAccounts(ctx context.Context) ([]*User, error) {
+	rows, err := q.db.Query(ctx, listServiceAccounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Name,
+			&i.Image,
+			&i.Email,
+			&i.Role,
+			&i.RoleVersion,
+			&i.Kind,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUserNames = `-- name: ListUserNames :many
 SELECT "username" FROM "users"
 `
@@ -125,7 +202,7 @@ func (q *Queries) ListUserNames(ctx context.Context) ([]string, error) {
 }
 
 const listUsers = `-- name: ListUsers :many
-SELECT id, username, name, image, email, role, "createdAt" FROM "users" ORDER BY "id" ASC LIMIT $1 OFFSET $2
+SELECT id, username, name, image, email, role, "roleVersion", kind, "createdAt" FROM "users" ORDER BY "id" ASC LIMIT $1 OFFSET $2
 `
 
 func (q *Queries) ListUsers(ctx context.Context, limit int32, offset int32) ([]*User, error) {
@@ -144,6 +221,8 @@ func (q *Queries) ListUsers(ctx context.Context, limit int32, offset int32) ([]*
 			&i.Image,
 			&i.Email,
 			&i.Role,
+			&i.RoleVersion,
+			&i.Kind,
 			&i.CreatedAt,
 		); err != nil {
 			return nil, err
@@ -178,7 +257,8 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 }
 
 const updateUserAdmin = `-- name: UpdateUserAdmin :exec
-UPDATE "users" SET "username" = $2, "email" = $3, "name" = $4, "image" = $5, "role" = $6 WHERE "id" = $1
+UPDATE "users" SET "username" = $2, "email" = $3, "name" = $4, "image" = $5, "role" = $6,
+"roleVersion" = CASE WHEN "role" = $6 THEN "roleVersion" ELSE "roleVersion" + 1 END WHERE "id" = $1
 `
 
 type UpdateUserAdminParams struct {
@@ -5,19 +5,215 @@ CREATE TABLE "users" (
     "image" TEXT NOT NULL,
     "email" TEXT NOT NULL,
     "role" TEXT NOT NULL,
+    "roleVersion" INTEGER NOT NULL DEFAULT 1, -- bumped when the role changes, invalidates access tokens
+    "kind" VARCHAR(16) NOT NULL DEFAULT 'user', -- 'user' or 'service'
     "createdAt" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE "user_sessions" (
     "id" SERIAL PRIMARY KEY NOT NULL,
     "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "actorId" INTEGER REFERENCES "users" ("id"), -- the admin impersonating the user, if any
     "tokenHash" VARCHAR(255) NOT NULL,
     "userAgent" TEXT NOT NULL,
     "ipAdress" VARCHAR(45) NOT NULL,
+    "browser" TEXT NOT NULL DEFAULT '', -- parsed from the user agent
+    "os" TEXT NOT NULL DEFAULT '',
+    "device" TEXT NOT NULL DEFAULT '', -- desktop, mobile, tablet, bot or unknown
+    "newDevice" BOOLEAN NOT NULL DEFAULT FALSE, -- the first session of the user on this device
+    "lastIpAdress" VARCHAR(45) NOT NULL DEFAULT '',
+    "lastSeenAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(), -- updated on every refresh
     "expiresAt" TIMESTAMPTZ NOT NULL,
     "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
 
+-- devices users signed in from, a device is its browser, OS and type
+CREATE TABLE "user_devices" (
+    "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "fingerprint" VARCHAR(255) NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY ("userId", "fingerprint")
+);
+
+-- refresh tokens that were rotated away. A session is a family of refresh
+-- tokens, one of them being presented again revokes the session
+CREATE TABLE "consumed_refresh_tokens" (
+    "tokenHash" VARCHAR(255) PRIMARY KEY NOT NULL,
+    "sessionId" INTEGER NOT NULL, -- not a reference, the session can be deleted first
+    "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "expiresAt" TIMESTAMPTZ NOT NULL,
+    "consumedAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- impersonation starts and stops, and every mutating request made while
+-- impersonating. Not references, the log outlives the users
+CREATE TABLE "audit_log" (
+    "id" SERIAL PRIMARY KEY NOT NULL,
+    "actorId" INTEGER NOT NULL,
+    "userId" INTEGER NOT NULL,
+    "event" VARCHAR(64) NOT NULL,
+    "details" TEXT NOT NULL,
+    "ipAdress" VARCHAR(45) NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "user_tokens" (
+    "id" SERIAL PRIMARY KEY NOT NULL,
+    "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "name" VARCHAR(255) NOT NULL,
+    "tokenHash" VARCHAR(255) UNIQUE NOT NULL,
+    "scopes" TEXT[] NOT NULL,
+    "expiresAt" TIMESTAMPTZ NOT NULL,
+    "lastUsedAt" TIMESTAMPTZ,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- client credentials of service accounts
+CREATE TABLE "service_credentials" (
+    "id" SERIAL PRIMARY KEY NOT NULL,
+    "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "clientId" VARCHAR(255) UNIQUE NOT NULL,
+    "secretHash" VARCHAR(255) NOT NULL,
+    "lastUsedAt" TIMESTAMPTZ,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- third party apps acting on behalf of users through the OAuth server
+CREATE TABLE "oauth_clients" (
+    "id" VARCHAR(255) PRIMARY KEY NOT NULL, -- the client_id
+    "ownerId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "name" VARCHAR(255) NOT NULL,
+    "secretHash" VARCHAR(255) NOT NULL, -- empty for public clients, they only rely on PKCE
+    "redirectUris" TEXT[] NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "oauth_codes" (
+    "codeHash" VARCHAR(255) PRIMARY KEY NOT NULL,
+    "clientId" VARCHAR(255) REFERENCES "oauth_clients" ("id") NOT NULL,
+    "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "redirectUri" TEXT NOT NULL,
+    "scopes" TEXT[] NOT NULL,
+    "codeChallenge" VARCHAR(255) NOT NULL, -- S256 only
+    "expiresAt" TIMESTAMPTZ NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- a grant given to a client, its refresh token is rotated on every use
+CREATE TABLE "oauth_tokens" (
+    "id" SERIAL PRIMARY KEY NOT NULL,
+    "clientId" VARCHAR(255) REFERENCES "oauth_clients" ("id") NOT NULL,
+    "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "scopes" TEXT[] NOT NULL,
+    "accessTokenHash" VARCHAR(255) UNIQUE NOT NULL,
+    "refreshTokenHash" VARCHAR(255) UNIQUE NOT NULL,
+    "accessExpiresAt" TIMESTAMPTZ NOT NULL,
+    "refreshExpiresAt" TIMESTAMPTZ NOT NULL,
+    "lastUsedAt" TIMESTAMPTZ,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- refresh tokens of grants that were rotated, presenting one again revokes
+-- the grant
+CREATE TABLE "consumed_oauth_refresh_tokens" (
+    "tokenHash" VARCHAR(255) PRIMARY KEY NOT NULL,
+    "grantId" INTEGER NOT NULL, -- not a reference, the grant can be deleted first
+    "expiresAt" TIMESTAMPTZ NOT NULL,
+    "consumedAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "user_totp" (
+    "userId" INTEGER PRIMARY KEY REFERENCES "users" ("id") NOT NULL,
+    "secret" TEXT NOT NULL,
+    "enabled" BOOLEAN NOT NULL DEFAULT FALSE,
+    "lastCounter" BIGINT NOT NULL DEFAULT 0,
+    "recoveryCodes" TEXT[] NOT NULL DEFAULT '{}',
+    "failedAttempts" INTEGER NOT NULL DEFAULT 0,
+    "lockedUntil" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "pending_logins" (
+    "tokenHash" VARCHAR(255) PRIMARY KEY NOT NULL,
+    "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "redirectTo" TEXT NOT NULL,
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "expiresAt" TIMESTAMPTZ NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "webauthn_credentials" (
+    "id" SERIAL PRIMARY KEY NOT NULL,
+    "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "name" VARCHAR(255) NOT NULL,
+    "credentialId" BYTEA UNIQUE NOT NULL,
+    "publicKey" BYTEA NOT NULL,
+    "attestationType" TEXT NOT NULL,
+    "transports" TEXT[] NOT NULL,
+    "aaguid" BYTEA NOT NULL,
+    "signCount" BIGINT NOT NULL,
+    "backupEligible" BOOLEAN NOT NULL,
+    "backupState" BOOLEAN NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "webauthn_sessions" (
+    "tokenHash" VARCHAR(255) PRIMARY KEY NOT NULL,
+    "data" TEXT NOT NULL,
+    "expiresAt" TIMESTAMPTZ NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "user_identities" (
+    "id" SERIAL PRIMARY KEY NOT NULL,
+    "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "provider" TEXT NOT NULL,
+    "subject" TEXT NOT NULL,
+    "email" TEXT NOT NULL,
+    "verified" BOOLEAN NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE ("provider", "subject")
+);
+
+CREATE TABLE "oauth_states" (
+    "nonce" TEXT PRIMARY KEY NOT NULL,
+    "verifier" TEXT NOT NULL,
+    "expiresAt" TIMESTAMPTZ NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- keys access tokens are signed with. A key is published before it activates
+-- and after it retires, so that verifiers caching the JWKS keep up
+CREATE TABLE "signing_keys" (
+    "kid" VARCHAR(255) PRIMARY KEY NOT NULL,
+    "algorithm" VARCHAR(16) NOT NULL,
+    "privateKey" TEXT NOT NULL,
+    "activatesAt" TIMESTAMPTZ NOT NULL,
+    "retiresAt" TIMESTAMPTZ NOT NULL,
+    "expiresAt" TIMESTAMPTZ NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- custom roles, merged with the roles of the policy
+CREATE TABLE "roles" (
+    "id" VARCHAR(64) PRIMARY KEY NOT NULL, -- what users.role refers to
+    "name" VARCHAR(255) NOT NULL,
+    "color" VARCHAR(32) NOT NULL,
+    "parents" TEXT[] NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    "updatedAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- a permission either has an action or uses a preset of the policy
+CREATE TABLE "role_permissions" (
+    "id" SERIAL PRIMARY KEY NOT NULL,
+    "role" VARCHAR(64) REFERENCES "roles" ("id") NOT NULL,
+    "resource" VARCHAR(64) NOT NULL,
+    "action" VARCHAR(64) NOT NULL,
+    "preset" VARCHAR(64) NOT NULL,
+    "conditions" TEXT[] NOT NULL -- names of conditions, all have to pass
+);
+
 CREATE TABLE "mail_accounts" (
     "id" SERIAL PRIMARY KEY NOT NULL,
     "ownerId" SERIAL REFERENCES "users" ("id") NOT NULL,
@@ -33,3 +229,60 @@ CREATE TABLE "mail_share" (
     "permission" TEXT NOT NULL,
     UNIQUE ("userId", "account")
 );
+
+CREATE TABLE "mail_outbox" (
+    "id" SERIAL PRIMARY KEY NOT NULL,
+    "account" INTEGER REFERENCES "mail_accounts" ("id") NOT NULL,
+    "senderId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "recipients" TEXT[] NOT NULL,
+    "subject" TEXT NOT NULL,
+    "body" TEXT NOT NULL,
+    "sign" BOOLEAN NOT NULL DEFAULT FALSE,
+    "encrypt" BOOLEAN NOT NULL DEFAULT FALSE,
+    "scheme" TEXT NOT NULL DEFAULT 'pgp',
+    "recipientKeys" TEXT[] NOT NULL DEFAULT '{}',
+    "status" TEXT NOT NULL DEFAULT 'scheduled',
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "lastError" TEXT NOT NULL DEFAULT '',
+    "sendAt" TIMESTAMPTZ NOT NULL,
+    "nextAttemptAt" TIMESTAMPTZ NOT NULL,
+    "updatedAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "mail_share_invites" (
+    "id" SERIAL PRIMARY KEY NOT NULL,
+    "userId" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "account" INTEGER REFERENCES "mail_accounts" ("id") NOT NULL,
+    "invitedBy" INTEGER REFERENCES "users" ("id") NOT NULL,
+    "permission" TEXT NOT NULL,
+    "expiresAt" TIMESTAMPTZ NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE ("userId", "account")
+);
+
+CREATE TABLE "mail_pgp_keys" (
+    "account" INTEGER PRIMARY KEY REFERENCES "mail_accounts" ("id") NOT NULL,
+    "fingerprint" TEXT NOT NULL,
+    "publicKey" TEXT NOT NULL,
+    "privateKey" TEXT NOT NULL,
+    "passphrase" TEXT NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE "mail_pgp_trusted_keys" (
+    "account" INTEGER REFERENCES "mail_accounts" ("id") NOT NULL,
+    "fingerprint" TEXT NOT NULL,
+    "publicKey" TEXT NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY ("account", "fingerprint")
+);
+
+CREATE TABLE "mail_smime_certs" (
+    "account" INTEGER PRIMARY KEY REFERENCES "mail_accounts" ("id") NOT NULL,
+    "fingerprint" TEXT NOT NULL,
+    "certificate" TEXT NOT NULL,
+    "privateKey" TEXT NOT NULL,
+    "notAfter" TIMESTAMPTZ NOT NULL,
+    "createdAt" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -26,11 +27,14 @@ func main() {
 	storageService := storage.NewDatabaseStorageService()
 	defer storageService.Close()
 	userService := users.NewRealUserService(storageService)
-	authService := auth.NewRealAuthService(storageService, userService)
 	emailService := email.NewRealEmailService(storageService)
+	authService := auth.NewRealAuthService(storageService, userService, emailService)
+	authService.StartKeyRotation(context.Background())
+	authService.StartPolicyReload(context.Background())
+	emailService.StartOutboxWorker(context.Background())
 
 	config.UsernameBlacklist = userService.GetUsernameBlacklist()
-	config.Policy = authService.GetPolicy()
+	config.Policy.Store(authService.GetPolicy())
 
 	router, err := api.CreateRouter(userService, authService, emailService)
 	if err != nil {
@@ -2,17 +2,21 @@ package auth
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/base64"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5"
 	"github.com/piquel-fr/api/config"
 	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/services/email"
 	"github.com/piquel-fr/api/services/storage"
 	"github.com/piquel-fr/api/services/users"
 	"github.com/piquel-fr/api/utils"
@@ -23,42 +27,138 @@ import (
 const (
 	refreshKey = "refresh_token"
 	accessKey  = "access_token"
+
+	// a rotated refresh token presented again within this window is rejected
+	// without revoking its session
+	refreshReuseGrace = time.Second * 10
 )
 
+const refreshReuseBody = `A refresh token of one of your sessions was used after it had already been
+replaced. This can mean it was stolen, so the session was signed out.
+
+Session details:
+  Device: %s
+  IP address: %s
+  Signed in: %s
+
+If this was not you, review your sessions and linked accounts.
+`
+
+const newDeviceBody = `Your account was signed in from a device it was never used on before.
+
+Session details:
+  Browser: %s
+  Operating system: %s
+  Device: %s
+  IP address: %s
+  Signed in: %s
+
+If this was not you, sign the session out and review your linked accounts.
+`
+
+// JwtClaims only identify the user, the user itself is resolved on every
+// request so that changes apply before the token expires
 type JwtClaims struct {
-	User *repository.User `json:"user"`
+	RoleVersion int32        `json:"rv"`              // the token is rejected once the role changed
+	SessionId   int32        `json:"sid"`             // the session the token was issued for
+	Actor       *ActorClaims `json:"act,omitempty"`   // the admin impersonating the user
+	Scope       string       `json:"scope,omitempty"` // space separated, limits the token like personal access tokens
 	jwt.RegisteredClaims
 }
 
 type AuthService interface {
 	GetPolicy() *config.PolicyConfiguration
+	StartPolicyReload(ctx context.Context) // reloads the policy when the file or the custom roles change
+
+	// custom roles, merged with the roles of the policy
+	GetCustomRoles(ctx context.Context) ([]*CustomRole, error)
+	CreateCustomRole(ctx context.Context, id string, params RoleParams) error
+	UpdateCustomRole(ctx context.Context, id string, params RoleParams) error
+	DeleteCustomRole(ctx context.Context, id string) error
 	GetProvider(name string) (oauth.Provider, error)
 
+	// oauth state, binds the callback to the browser that started the flow
+	// linkUserId is 0 for a login, or the user the new identity is linked to
+	CreateOAuthState(ctx context.Context, w http.ResponseWriter, provider, redirectTo string, linkUserId int32) (*OAuthFlow, error)
+	ConsumeOAuthState(w http.ResponseWriter, r *http.Request, provider string) (*OAuthFlow, error)
+
 	// auth flows
 	FinishAuth(user *repository.User, r *http.Request, w http.ResponseWriter) error // sets the users refresh & access tokens
 	Refresh(w http.ResponseWriter, r *http.Request) error                           // refreshes the user's tokens
 	Logout(w http.ResponseWriter, r *http.Request) error
 
+	// access token signing keys, rotated in the background
+	StartKeyRotation(ctx context.Context)
+	GetJWKS() *jose.JSONWebKeySet
+
+	// impersonation, the admin is signed back in as themselves when stopping
+	StartImpersonation(w http.ResponseWriter, r *http.Request, actor, user *repository.User) error
+	StopImpersonation(w http.ResponseWriter, r *http.Request) error
+	GetImpersonator(ctx context.Context) (*repository.User, bool)
+
 	// authorization
 	Authorize(request *config.AuthRequest) error
+	ExplainAuthorization(request *config.AuthRequest) *AuthorizationTrace // records why Authorize allows or denies the request
 	AuthMiddleware(next http.Handler) http.Handler
 
 	// session management
 	GetUserSessions(ctx context.Context, userId int32) ([]*repository.UserSession, error)
 	DeleteUserSession(ctx context.Context, userId, id int32) error
 	DeleteUserSessions(ctx context.Context, userId int32) error
+
+	// personal access tokens, accepted as "Authorization: Bearer <token>"
+	CreateUserToken(ctx context.Context, user *repository.User, params CreateTokenParams) (*CreatedToken, error)
+	GetUserTokens(ctx context.Context, userId int32) ([]*repository.UserToken, error)
+	DeleteUserToken(ctx context.Context, userId, id int32) error
+
+	// service accounts, they authenticate with the client credentials grant
+	CreateServiceCredential(ctx context.Context, user *repository.User) (*CreatedServiceCredential, error)
+	GetServiceCredentials(ctx context.Context, userId int32) ([]*repository.ServiceCredential, error)
+	DeleteServiceCredential(ctx context.Context, userId, id int32) error
+
+	// OAuth server, third party apps act on behalf of users with scoped tokens
+	Token(ctx context.Context, request TokenRequest) (*TokenResponse, error) // the token endpoint, for every grant type
+	IntrospectToken(ctx context.Context, clientId, clientSecret, token string) (*TokenIntrospection, error)
+	RevokeToken(ctx context.Context, clientId, clientSecret, token string) error
+	GetOAuthConsent(ctx context.Context, user *repository.User, request AuthorizationRequest) (*OAuthConsent, error)
+	AnswerOAuthConsent(ctx context.Context, user *repository.User, request AuthorizationRequest, approved bool) (string, error) // returns the URL to send the user back to
+	CreateOAuthClient(ctx context.Context, owner *repository.User, params CreateOAuthClientParams) (*CreatedOAuthClient, error)
+	GetOAuthClients(ctx context.Context, ownerId int32) ([]*repository.OauthClient, error)
+	DeleteOAuthClient(ctx context.Context, ownerId int32, clientId string) error
+	GetAuthorizations(ctx context.Context, userId int32) ([]*repository.ListUserAuthorizationsRow, error)
+	RevokeAuthorization(ctx context.Context, userId, id int32) error
+
+	// two factor authentication
+	GetTwoFactor(ctx context.Context, userId int32) (*TwoFactorStatus, error)
+	EnrollTwoFactor(ctx context.Context, user *repository.User) (*TwoFactorEnrollment, error)
+	VerifyTwoFactor(ctx context.Context, userId int32, code string) ([]string, error) // returns the recovery codes
+	DisableTwoFactor(ctx context.Context, userId int32, code *TwoFactorCode) error
+	RequireTwoFactor(ctx context.Context, w http.ResponseWriter, user *repository.User, redirectTo string) (bool, error)
+	CompleteTwoFactor(w http.ResponseWriter, r *http.Request, code TwoFactorCode) (string, error)
+
+	// passkeys
+	BeginPasskeyRegistration(ctx context.Context, w http.ResponseWriter, user *repository.User) (*protocol.CredentialCreation, error)
+	FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request, user *repository.User, name string) (*repository.WebauthnCredential, error)
+	BeginPasskeyLogin(ctx context.Context, w http.ResponseWriter) (*protocol.CredentialAssertion, error)
+	FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) error // signs the user in like FinishAuth
+	GetPasskeys(ctx context.Context, userId int32) ([]*repository.WebauthnCredential, error)
+	DeletePasskey(ctx context.Context, userId, id int32) error
 }
 
 type realAuthService struct {
 	userService    users.UserService
 	storageService storage.StorageService
+	emailService   email.EmailService
+	webauthn       *webauthn.WebAuthn
+	keys           *keyRing
 }
 
-func NewRealAuthService(storageService storage.StorageService, userService users.UserService) AuthService {
-	return &realAuthService{userService, storageService}
+func NewRealAuthService(storageService storage.StorageService, userService users.UserService, emailService email.EmailService) AuthService {
+	loadPolicy()
+	return &realAuthService{userService, storageService, emailService, newWebauthn(), &keyRing{}}
 }
 
-func (s *realAuthService) GetPolicy() *config.PolicyConfiguration { return &policy }
+func (s *realAuthService) GetPolicy() *config.PolicyConfiguration { return policy.Load() }
 
 func (s *realAuthService) GetProvider(name string) (oauth.Provider, error) {
 	provider, ok := oauth.Providers[name]
@@ -69,53 +169,71 @@ func (s *realAuthService) GetProvider(name string) (oauth.Provider, error) {
 }
 
 func (s *realAuthService) FinishAuth(user *repository.User, r *http.Request, w http.ResponseWriter) error {
-	ipAddress := utils.GetIpAddress(r)
+	if user.Kind == users.KindService {
+		return errorServiceAccountLogin
+	}
 
-	refreshExpiry := time.Hour * 24 * 30 // 30 days
-	refreshToken, refreshHash := s.generateRefreshToken(ipAddress)
+	ipAddress := utils.GetIpAddress(r)
+	userAgent := utils.ParseUserAgent(r.Header.Get("User-Agent"))
 
-	accessExpiry := time.Minute * 5 // 5 minutes
-	accessToken := s.generateAccessToken(user, time.Now().Add(accessExpiry))
-	accessTokenString, err := s.signToken(accessToken)
+	newDevice, err := s.trackDevice(r.Context(), user.ID, userAgent)
 	if err != nil {
 		return err
 	}
 
+	refreshExpiry := time.Hour * 24 * 30 // 30 days
+	refreshToken, refreshHash := generateRefreshToken()
+
 	sessionParams := repository.AddSessionParams{
 		UserId:    user.ID,
 		TokenHash: refreshHash,
 		UserAgent: r.Header.Get("User-Agent"),
 		IpAdress:  ipAddress,
+		Browser:   userAgent.Name(),
+		Os:        userAgent.OS,
+		Device:    userAgent.Device,
+		NewDevice: newDevice,
 		ExpiresAt: time.Now().Add(refreshExpiry), // one month
 	}
-	if _, err := s.storageService.AddSession(r.Context(), sessionParams); err != nil {
+	session, err := s.storageService.AddSession(r.Context(), sessionParams)
+	if err != nil {
 		return err
 	}
 
-	w.Header().Add("Set-Cookie", utils.GenerateSetCookie(refreshKey, refreshToken, config.Envs.Domain, "/auth", "Strict", refreshExpiry))
-	w.Header().Add("Set-Cookie", utils.GenerateSetCookie(accessKey, accessTokenString, config.Envs.Domain, "/", "Lax", accessExpiry))
-	return nil
+	if newDevice && user.Email != "" {
+		go func() {
+			body := fmt.Sprintf(newDeviceBody, session.Browser, session.Os, session.Device, session.IpAdress, session.CreatedAt.Format(time.RFC1123))
+			if err := s.emailService.SendSystemEmail(user.Email, "New sign-in to your account", body); err != nil {
+				log.Printf("[Auth] Failed to alert user %d of a new device: %s\n", user.ID, err.Error())
+			}
+		}()
+	}
+
+	return s.setSessionCookies(w, user, nil, session.ID, refreshToken, refreshExpiry)
 }
 
 func (s *realAuthService) Refresh(w http.ResponseWriter, r *http.Request) error {
 	ipAddress := utils.GetIpAddress(r)
 	cookies := utils.GetCookiesFromStr(r.Header.Get("Cookie"))
+	if cookies[refreshKey] == "" {
+		return errors.ErrorNotAuthenticated
+	}
 
-	hash := s.hashRefreshToken(cookies[refreshKey], ipAddress)
+	hash := hashToken(cookies[refreshKey])
 	session, err := s.storageService.GetSessionFromHash(r.Context(), hash)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return errors.ErrorNotAuthenticated
+		return s.checkRefreshTokenReuse(r.Context(), hash)
 	}
 	if err != nil {
 		return err
 	}
 
-	if time.Now().After(session.ExpiresAt) || !s.verifyRefreshToken(cookies[refreshKey], ipAddress, hash) {
+	if time.Now().After(session.ExpiresAt) || !sessionAddressMatches(session, ipAddress) {
 		return errors.ErrorNotAuthenticated
 	}
 
 	refreshExpiry := time.Hour * 24 * 30 // 30 days
-	refreshToken, refreshHash := s.generateRefreshToken(ipAddress)
+	refreshToken, refreshHash := generateRefreshToken()
 
 	user, err := s.userService.GetUserById(r.Context(), session.UserId)
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -124,19 +242,106 @@ func (s *realAuthService) Refresh(w http.ResponseWriter, r *http.Request) error
 	if err != nil {
 		return err
 	}
-	accessExpiry := time.Minute * 5 // 5 minutes
-	accessToken := s.generateAccessToken(user, time.Now().Add(accessExpiry))
-	accessTokenString, err := s.signToken(accessToken)
+
+	var actor *repository.User
+	if session.ActorId.Valid {
+		actor, err = s.userService.GetUserById(r.Context(), session.ActorId.Int32)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.ErrorNotAuthenticated
+		}
+		if err != nil {
+			return err
+		}
+
+		// impersonation sessions end at their original expiry
+		refreshExpiry = time.Until(session.ExpiresAt)
+	}
+
+	// consumed tokens of expired sessions can't be replayed anymore
+	if err := s.storageService.DeleteExpiredConsumedTokens(r.Context()); err != nil {
+		return err
+	}
+
+	// the old token is remembered so that presenting it again revokes the session
+	err = s.storageService.WithTransaction(r.Context(), func(queries repository.Querier) error {
+		consumed, err := queries.AddConsumedRefreshToken(r.Context(), repository.AddConsumedRefreshTokenParams{
+			TokenHash: hash,
+			SessionId: session.ID,
+			UserId:    session.UserId,
+			ExpiresAt: session.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		if consumed == 0 { // another request rotated this token first
+			return errors.ErrorNotAuthenticated
+		}
+
+		return queries.UpdateSession(r.Context(), repository.UpdateSessionParams{
+			ID:           session.ID,
+			TokenHash:    refreshHash,
+			ExpiresAt:    time.Now().Add(refreshExpiry),
+			LastIpAdress: ipAddress,
+		})
+	})
 	if err != nil {
 		return err
 	}
 
-	updateSessionParams := repository.UpdateSessionParams{
-		UserId:    user.ID,
-		TokenHash: refreshHash,
-		ExpiresAt: time.Now().Add(refreshExpiry),
+	return s.setSessionCookies(w, user, actor, session.ID, refreshToken, refreshExpiry)
+}
+
+// sessionAddressMatches checks the address refreshing a session against the
+// last one it was used from, as configured by config.Envs.SessionBinding
+func sessionAddressMatches(session *repository.UserSession, ipAddress string) bool {
+	lastIpAddress := session.LastIpAdress
+	if lastIpAddress == "" { // sessions created before it was recorded
+		lastIpAddress = session.IpAdress
+	}
+
+	switch config.Envs.SessionBinding {
+	case config.SessionBindingNone:
+		return true
+	case config.SessionBindingPrefix:
+		return utils.SameNetwork(lastIpAddress, ipAddress)
 	}
-	if err := s.storageService.UpdateSession(r.Context(), updateSessionParams); err != nil {
+	return lastIpAddress == ipAddress
+}
+
+// trackDevice remembers the device the user signs in from and reports if it
+// was never seen before. The first device of a user is not considered new,
+// there is nothing to alert about when signing up. Sign ins of the same user
+// are serialized so that two first ones can't both see no devices
+func (s *realAuthService) trackDevice(ctx context.Context, userId int32, userAgent utils.UserAgent) (bool, error) {
+	newDevice := false
+	err := s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		if err := queries.LockUserDevices(ctx, userId); err != nil {
+			return err
+		}
+
+		count, err := queries.CountUserDevices(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		added, err := queries.AddUserDevice(ctx, userId, userAgent.Fingerprint())
+		if err != nil {
+			return err
+		}
+
+		newDevice = added > 0 && count > 0
+		return nil
+	})
+	return newDevice, err
+}
+
+// setSessionCookies issues an access token for the session, actor being the
+// admin impersonating user if any
+func (s *realAuthService) setSessionCookies(w http.ResponseWriter, user, actor *repository.User, sessionId int32, refreshToken string, refreshExpiry time.Duration) error {
+	accessExpiry := time.Minute * 5 // 5 minutes
+	accessToken := s.generateAccessToken(user, actor, sessionId, time.Now().Add(accessExpiry))
+	accessTokenString, err := s.signToken(accessToken)
+	if err != nil {
 		return err
 	}
 
@@ -145,57 +350,106 @@ func (s *realAuthService) Refresh(w http.ResponseWriter, r *http.Request) error
 	return nil
 }
 
+// checkRefreshTokenReuse is called with a refresh token that matches no
+// session. If it was already rotated, either the user or an attacker holds a
+// stolen copy, so the whole session is revoked and the user is alerted
+func (s *realAuthService) checkRefreshTokenReuse(ctx context.Context, hash string) error {
+	consumed, err := s.storageService.GetConsumedRefreshToken(ctx, hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrorNotAuthenticated
+	}
+	if err != nil {
+		return err
+	}
+
+	// tabs refreshing at the same time present the same token, that is not reuse
+	if time.Since(consumed.ConsumedAt) < refreshReuseGrace {
+		return errors.ErrorNotAuthenticated
+	}
+
+	session, err := s.storageService.GetSessionById(ctx, consumed.SessionId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrorNotAuthenticated
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		if err := queries.DeleteSessionConsumedTokens(ctx, session.UserId, session.ID); err != nil {
+			return err
+		}
+		return queries.DeleteSessionById(ctx, session.UserId, session.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[Auth] Refresh token reuse detected, revoked session %d of user %d\n", session.ID, session.UserId)
+
+	user, err := s.userService.GetUserById(ctx, session.UserId)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		body := fmt.Sprintf(refreshReuseBody, session.UserAgent, session.IpAdress, session.CreatedAt.Format(time.RFC1123))
+		if err := s.emailService.SendSystemEmail(user.Email, "A session was revoked for your security", body); err != nil {
+			log.Printf("[Auth] Failed to alert user %d of a revoked session: %s\n", user.ID, err.Error())
+		}
+	}()
+
+	return errors.ErrorNotAuthenticated
+}
+
 func (s *realAuthService) Logout(w http.ResponseWriter, r *http.Request) error {
-	ipAddress := utils.GetIpAddress(r)
 	cookies := utils.GetCookiesFromStr(r.Header.Get("Cookie"))
 
 	w.Header().Add("Set-Cookie", utils.GenerateClearCookie(refreshKey, config.Envs.Domain, "/auth"))
 	w.Header().Add("Set-Cookie", utils.GenerateClearCookie(accessKey, config.Envs.Domain, "/"))
 
-	hash := s.hashRefreshToken(cookies[refreshKey], ipAddress)
-	return s.storageService.DeleteSessionByHash(r.Context(), hash)
-}
-
-func (s *realAuthService) generateAccessToken(user *repository.User, expiresAt time.Time) *jwt.Token {
-	idString := strconv.Itoa(int(user.ID))
-	return jwt.NewWithClaims(config.JWTSigningMethod,
-		JwtClaims{
-			User: user,
-			RegisteredClaims: jwt.RegisteredClaims{
-				Subject:   idString,
-				ExpiresAt: jwt.NewNumericDate(expiresAt),
-				IssuedAt:  jwt.NewNumericDate(time.Now()),
-			},
-		})
-}
+	hash := hashToken(cookies[refreshKey])
+	session, err := s.storageService.GetSessionFromHash(r.Context(), hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-// returns token, hash
-func (s *realAuthService) generateRefreshToken(ipAdress string) (string, string) {
-	token := utils.GenerateSecureToken(32)
-	return token, s.hashRefreshToken(token, ipAdress)
+	return s.DeleteUserSession(r.Context(), session.UserId, session.ID)
 }
 
-func (s *realAuthService) verifyRefreshToken(token, ipAdress, hash string) bool {
-	return s.hashRefreshToken(token, ipAdress) == hash
-}
+func (s *realAuthService) generateAccessToken(user, actor *repository.User, sessionId int32, expiresAt time.Time) jwt.Claims {
+	var actorClaims *ActorClaims
+	if actor != nil {
+		actorClaims = &ActorClaims{strconv.Itoa(int(actor.ID)), actor.RoleVersion}
+	}
 
-func (s *realAuthService) hashRefreshToken(token, ipAdress string) string {
-	hash := sha256.Sum256(fmt.Appendf([]byte(token), "-%s", ipAdress))
-	return base64.URLEncoding.EncodeToString(hash[:])
+	idString := strconv.Itoa(int(user.ID))
+	return JwtClaims{
+		RoleVersion: user.RoleVersion,
+		SessionId:   sessionId,
+		Actor:       actorClaims,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   idString,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
 }
 
-func (s *realAuthService) signToken(token *jwt.Token) (string, error) {
-	return token.SignedString(config.Envs.JWTSigningSecret)
+// returns token, hash. The IP address is not part of the hash, it is checked
+// against the session so that a token replayed from elsewhere is still found
+func generateRefreshToken() (string, string) {
+	token := utils.GenerateSecureToken(32)
+	return token, hashToken(token)
 }
 
-func (s *realAuthService) getTokenFromRequest(r *http.Request) (*jwt.Token, *JwtClaims, error) {
-	cookies := utils.GetCookiesFromStr(r.Header.Get("Cookie"))
-	tokenString := cookies[accessKey]
-
+func (s *realAuthService) parseAccessToken(ctx context.Context, tokenString string) (*jwt.Token, *JwtClaims, error) {
 	claims := &JwtClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
-		return config.Envs.JWTSigningSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.verificationKey(ctx),
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}))
 
 	return token, claims, err
 }
@@ -207,7 +461,31 @@ func (s *realAuthService) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		token, claims, err := s.getTokenFromRequest(r)
+		bearer, isBearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if isBearer && (strings.HasPrefix(bearer, tokenPrefix) || strings.HasPrefix(bearer, oauthAccessPrefix)) {
+			authenticate := s.authenticateUserToken
+			if strings.HasPrefix(bearer, oauthAccessPrefix) {
+				authenticate = s.authenticateOAuthToken
+			}
+
+			user, scopes, err := authenticate(r.Context(), bearer)
+			if err != nil {
+				errors.HandleError(w, r, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), config.UserContextKey, user)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, config.TokenScopesContextKey, scopes)))
+			return
+		}
+
+		// access tokens come from the cookie, or from the token endpoint
+		tokenString := bearer
+		if !isBearer {
+			tokenString = utils.GetCookiesFromStr(r.Header.Get("Cookie"))[accessKey]
+		}
+
+		token, claims, err := s.parseAccessToken(r.Context(), tokenString)
 		if err != nil {
 			errors.HandleError(w, r, err)
 			return
@@ -221,8 +499,46 @@ func (s *realAuthService) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		newReq := r.WithContext(context.WithValue(r.Context(), config.UserContextKey, claims.User))
-		next.ServeHTTP(w, newReq)
+		id, err := strconv.ParseInt(claims.Subject, 10, 32)
+		if err != nil {
+			errors.HandleError(w, r, errors.ErrorNotAuthenticated)
+			return
+		}
+
+		user, err := s.userService.GetCachedUser(r.Context(), int32(id))
+		if errors.Is(err, pgx.ErrNoRows) {
+			errors.HandleError(w, r, errors.ErrorNotAuthenticated)
+			return
+		}
+		if err != nil {
+			errors.HandleError(w, r, err)
+			return
+		}
+
+		// the client refreshes and gets a token matching the new role
+		if user.RoleVersion != claims.RoleVersion {
+			errors.HandleError(w, r, errors.ErrorNotAuthenticated)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), config.UserContextKey, user)
+		ctx = context.WithValue(ctx, config.SessionContextKey, claims.SessionId)
+		if claims.Scope != "" {
+			ctx = context.WithValue(ctx, config.TokenScopesContextKey, strings.Fields(claims.Scope))
+		}
+
+		if claims.Actor != nil {
+			actor, err := s.resolveActor(r.Context(), claims.Actor)
+			if err != nil {
+				errors.HandleError(w, r, err)
+				return
+			}
+
+			s.auditRequest(next, w, r.WithContext(context.WithValue(ctx, config.ActorContextKey, actor)), actor, user)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
@@ -231,9 +547,19 @@ func (s *realAuthService) GetUserSessions(ctx context.Context, userId int32) ([]
 }
 
 func (s *realAuthService) DeleteUserSession(ctx context.Context, userId, id int32) error {
-	return s.storageService.DeleteSessionById(ctx, userId, id)
+	return s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		if err := queries.DeleteSessionConsumedTokens(ctx, userId, id); err != nil {
+			return err
+		}
+		return queries.DeleteSessionById(ctx, userId, id)
+	})
 }
 
 func (s *realAuthService) DeleteUserSessions(ctx context.Context, userId int32) error {
-	return s.storageService.ClearUserSessions(ctx, userId)
+	return s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		if err := queries.DeleteUserConsumedTokens(ctx, userId); err != nil {
+			return err
+		}
+		return queries.ClearUserSessions(ctx, userId)
+	})
 }
@@ -14,6 +14,10 @@ func newRoleNotFoundError(role string) error {
 	return fmt.Errorf("Role %s does not exist!", role)
 }
 
+func newPresetNotFoundError(preset string) error {
+	return fmt.Errorf("Preset %s does not exist!", preset)
+}
+
 func newRoleInheritanceCycleError(checkedRoles []string, role string) error {
 	return fmt.Errorf("There is a role inheritance cycle. Role %s has already been checks: %v.", role, checkedRoles)
 }
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/piquel-fr/api/config"
+)
+
+var traceContextKey = "authorization_trace"
+
+// AuthorizationTrace records how Authorize reached its decision
+type AuthorizationTrace struct {
+	Allowed bool         `json:"allowed"`
+	Error   string       `json:"error,omitempty"` // why the request was denied
+	Steps   []*TraceStep `json:"steps"`
+}
+
+type TraceStep struct {
+	Depth   int    `json:"depth"` // how many parents away from the role of the user
+	Role    string `json:"role,omitempty"`
+	Action  string `json:"action,omitempty"`
+	Message string `json:"message"`
+}
+
+// ExplainAuthorization runs Authorize and records every step of it. The
+// request is evaluated as if the user made it from a session, without the
+// token scopes or impersonation of the caller
+func (s *realAuthService) ExplainAuthorization(request *config.AuthRequest) *AuthorizationTrace {
+	trace := &AuthorizationTrace{Steps: []*TraceStep{}}
+
+	explained := *request
+	explained.Context = context.WithValue(context.Background(), traceContextKey, trace)
+
+	err := s.Authorize(&explained)
+	trace.Allowed = err == nil
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	return trace
+}
+
+// explain adds a step to the trace of the request, if it is being explained
+func explain(request *config.AuthRequest, depth int, role, action, format string, args ...any) {
+	if request.Context == nil {
+		return
+	}
+
+	trace, ok := request.Context.Value(traceContextKey).(*AuthorizationTrace)
+	if !ok {
+		return
+	}
+
+	trace.Steps = append(trace.Steps, &TraceStep{
+		Depth:   depth,
+		Role:    role,
+		Action:  action,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+)
+
+// impersonation sessions are not extended when refreshed
+const impersonationExpiry = time.Hour
+
+const (
+	auditImpersonationStart = "impersonation_start"
+	auditImpersonationStop  = "impersonation_stop"
+	auditRequest            = "request"
+)
+
+// actions that stay with the user, an admin can't take them on their behalf
+var impersonationForbiddenActions = []string{
+	ActionDelete,
+	ActionUpdateAdmin,
+	ActionCreateUserTokens,
+	ActionCreateOAuthClients,
+	ActionAuthorizeOAuthClients,
+	ActionLinkUserIdentities,
+	ActionUnlinkUserIdentities,
+	ActionEnrollTwoFactor,
+	ActionDisableTwoFactor,
+	ActionManagePasskeys,
+	ActionImpersonate,
+}
+
+var errorImpersonationForbidden = errors.NewError("this action can't be taken while impersonating a user", http.StatusForbidden)
+
+// ActorClaims identify the admin acting as the subject of the token, like the
+// act claim of RFC 8693
+type ActorClaims struct {
+	Subject     string `json:"sub"`
+	RoleVersion int32  `json:"rv"`
+}
+
+// StartImpersonation replaces the session of actor with one for user. The
+// tokens carry both, see GetImpersonator
+func (s *realAuthService) StartImpersonation(w http.ResponseWriter, r *http.Request, actor, user *repository.User) error {
+	if actor.ID == user.ID {
+		return errors.NewError("you can't impersonate yourself", http.StatusBadRequest)
+	}
+
+	refreshToken, refreshHash := generateRefreshToken()
+	ipAddress := utils.GetIpAddress(r)
+	userAgent := utils.ParseUserAgent(r.Header.Get("User-Agent"))
+
+	// the device is the admin's, it is not tracked as one of the user
+	sessionParams := repository.AddSessionParams{
+		UserId:    user.ID,
+		ActorId:   pgtype.Int4{Int32: actor.ID, Valid: true},
+		TokenHash: refreshHash,
+		UserAgent: r.Header.Get("User-Agent"),
+		IpAdress:  ipAddress,
+		Browser:   userAgent.Name(),
+		Os:        userAgent.OS,
+		Device:    userAgent.Device,
+		ExpiresAt: time.Now().Add(impersonationExpiry),
+	}
+	session, err := s.storageService.AddSession(r.Context(), sessionParams)
+	if err != nil {
+		return err
+	}
+
+	// the session of the admin is over, a new one starts when they stop
+	if sessionId, ok := r.Context().Value(config.SessionContextKey).(int32); ok && sessionId != 0 {
+		if err := s.DeleteUserSession(r.Context(), actor.ID, sessionId); err != nil {
+			return err
+		}
+	}
+
+	details := fmt.Sprintf("%s started impersonating %s", actor.Username, user.Username)
+	if err := s.audit(r.Context(), actor.ID, user.ID, auditImpersonationStart, details, ipAddress); err != nil {
+		return err
+	}
+
+	return s.setSessionCookies(w, user, actor, session.ID, refreshToken, impersonationExpiry)
+}
+
+// StopImpersonation ends the impersonation session of the request and signs
+// the admin back in as themselves
+func (s *realAuthService) StopImpersonation(w http.ResponseWriter, r *http.Request) error {
+	cookies := utils.GetCookiesFromStr(r.Header.Get("Cookie"))
+
+	session, err := s.storageService.GetSessionFromHash(r.Context(), hashToken(cookies[refreshKey]))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrorNotAuthenticated
+	}
+	if err != nil {
+		return err
+	}
+
+	if !session.ActorId.Valid {
+		return errors.NewError("you are not impersonating anyone", http.StatusBadRequest)
+	}
+
+	if err := s.DeleteUserSession(r.Context(), session.UserId, session.ID); err != nil {
+		return err
+	}
+
+	actor, err := s.userService.GetUserById(r.Context(), session.ActorId.Int32)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.ErrorNotAuthenticated
+	}
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userService.GetUserById(r.Context(), session.UserId)
+	if err != nil {
+		return err
+	}
+
+	details := fmt.Sprintf("%s stopped impersonating %s", actor.Username, user.Username)
+	if err := s.audit(r.Context(), actor.ID, user.ID, auditImpersonationStop, details, utils.GetIpAddress(r)); err != nil {
+		return err
+	}
+
+	return s.FinishAuth(actor, r, w)
+}
+
+func (s *realAuthService) GetImpersonator(ctx context.Context) (*repository.User, bool) {
+	actor, ok := ctx.Value(config.ActorContextKey).(*repository.User)
+	return actor, ok
+}
+
+// resolveActor returns the admin behind an impersonation token, which is
+// rejected once the role of the admin changed
+func (s *realAuthService) resolveActor(ctx context.Context, claims *ActorClaims) (*repository.User, error) {
+	id, err := strconv.ParseInt(claims.Subject, 10, 32)
+	if err != nil {
+		return nil, errors.ErrorNotAuthenticated
+	}
+
+	actor, err := s.userService.GetCachedUser(ctx, int32(id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.ErrorNotAuthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if actor.RoleVersion != claims.RoleVersion {
+		return nil, errors.ErrorNotAuthenticated
+	}
+	return actor, nil
+}
+
+// auditRequest records a mutating request made while impersonating, once it
+// was handled
+func (s *realAuthService) auditRequest(next http.Handler, w http.ResponseWriter, r *http.Request, actor, user *repository.User) {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(recorder, r)
+
+	details := fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, recorder.status)
+	if err := s.audit(r.Context(), actor.ID, user.ID, auditRequest, details, utils.GetIpAddress(r)); err != nil {
+		log.Printf("[Auth] Failed to audit \"%s\" by %s as %s: %s\n", details, actor.Username, user.Username, err.Error())
+	}
+}
+
+func (s *realAuthService) audit(ctx context.Context, actorId, userId int32, event, details, ipAddress string) error {
+	return s.storageService.AddAuditLog(ctx, repository.AddAuditLogParams{
+		ActorId:  actorId,
+		UserId:   userId,
+		Event:    event,
+		Details:  details,
+		IpAdress: ipAddress,
+	})
+}
+
+func impersonationAllows(ctx context.Context, actions []string) bool {
+	if ctx == nil || ctx.Value(config.ActorContextKey) == nil {
+		return true
+	}
+
+	for _, action := range actions {
+		if slices.Contains(impersonationForbiddenActions, action) {
+			return false
+		}
+	}
+	return true
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils"
+)
+
+const (
+	keyRotationInterval = time.Hour
+	keyReloadCooldown   = time.Second * 30 // how often an unknown kid may trigger a reload
+)
+
+type signingKey struct {
+	kid         string
+	method      jwt.SigningMethod
+	private     crypto.Signer
+	activatesAt time.Time
+	retiresAt   time.Time
+}
+
+// keyRing holds the keys that are currently published, ordered by activation
+type keyRing struct {
+	mutex    sync.RWMutex
+	keys     []*signingKey
+	loadedAt time.Time
+}
+
+// current returns the most recently activated key that is not retired yet
+func (k *keyRing) current(now time.Time) *signingKey {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		key := k.keys[i]
+		if !now.Before(key.activatesAt) && now.Before(key.retiresAt) {
+			return key
+		}
+	}
+	return nil
+}
+
+func (k *keyRing) find(kid string) *signingKey {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+
+	for _, key := range k.keys {
+		if key.kid == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+// StartKeyRotation loads the signing keys and keeps rotating them in the
+// background until ctx is done
+func (s *realAuthService) StartKeyRotation(ctx context.Context) {
+	log.Printf("[Auth] Starting signing key rotation...\n")
+
+	if _, err := signingMethod(config.Envs.JWTAlgorithm); err != nil {
+		log.Fatalf("[Auth] Failed to configure token signing: %s", err.Error())
+	}
+
+	if err := s.rotateKeys(ctx); err != nil {
+		log.Fatalf("[Auth] Failed to load the signing keys: %s", err.Error())
+	}
+
+	go func() {
+		ticker := time.NewTicker(keyRotationInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.rotateKeys(ctx); err != nil {
+					log.Printf("[Auth] Failed to rotate the signing keys: %s\n", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// rotateKeys reloads the keys and schedules the next one once the current key
+// enters the overlap window, so that it is published before it signs anything.
+// Other instances pick up the new key on their next reload
+func (s *realAuthService) rotateKeys(ctx context.Context) error {
+	if err := s.storageService.DeleteExpiredSigningKeys(ctx); err != nil {
+		return err
+	}
+
+	if err := s.loadKeys(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	current := s.keys.current(now)
+
+	s.keys.mutex.RLock()
+	var latest *signingKey
+	if len(s.keys.keys) > 0 {
+		latest = s.keys.keys[len(s.keys.keys)-1]
+	}
+	s.keys.mutex.RUnlock()
+
+	var activatesAt time.Time
+	switch {
+	case current == nil, latest.method.Alg() != config.Envs.JWTAlgorithm:
+		// nothing can sign, or the algorithm was changed: use a new key right away
+		activatesAt = now
+	case latest == current && !now.Before(current.retiresAt.Add(-config.Envs.JWTKeyOverlap)):
+		activatesAt = current.retiresAt
+	default:
+		return nil
+	}
+
+	params, err := newSigningKey(config.Envs.JWTAlgorithm, activatesAt)
+	if err != nil {
+		return err
+	}
+
+	if err := s.storageService.AddSigningKey(ctx, params); err != nil {
+		return err
+	}
+	log.Printf("[Auth] Generated signing key %s, active from %s\n", params.Kid, activatesAt.Format(time.RFC3339))
+
+	return s.loadKeys(ctx)
+}
+
+func (s *realAuthService) loadKeys(ctx context.Context) error {
+	stored, err := s.storageService.ListSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*signingKey, 0, len(stored))
+	for _, key := range stored {
+		parsed, err := parseSigningKey(key)
+		if err != nil {
+			return fmt.Errorf("signing key %s is invalid: %w", key.Kid, err)
+		}
+		keys = append(keys, parsed)
+	}
+
+	s.keys.mutex.Lock()
+	s.keys.keys = keys
+	s.keys.loadedAt = time.Now()
+	s.keys.mutex.Unlock()
+	return nil
+}
+
+// signToken signs the claims with the current key, its kid is set in the header
+func (s *realAuthService) signToken(claims jwt.Claims) (string, error) {
+	key := s.keys.current(time.Now())
+	if key == nil {
+		return "", fmt.Errorf("no signing key is active")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// verificationKey is the jwt.Keyfunc of access tokens. A kid that is not
+// known yet may have just been generated by another instance
+func (s *realAuthService) verificationKey(ctx context.Context) jwt.Keyfunc {
+	return func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key := s.keys.find(kid)
+		if key == nil {
+			s.keys.mutex.RLock()
+			stale := time.Since(s.keys.loadedAt) > keyReloadCooldown
+			s.keys.mutex.RUnlock()
+
+			if stale {
+				if err := s.loadKeys(ctx); err != nil {
+					return nil, err
+				}
+				key = s.keys.find(kid)
+			}
+		}
+
+		if key == nil || key.method.Alg() != token.Method.Alg() {
+			return nil, fmt.Errorf("signing key %s is unknown", kid)
+		}
+		return key.private.Public(), nil
+	}
+}
+
+func (s *realAuthService) GetJWKS() *jose.JSONWebKeySet {
+	s.keys.mutex.RLock()
+	defer s.keys.mutex.RUnlock()
+
+	set := &jose.JSONWebKeySet{Keys: make([]jose.JSONWebKey, len(s.keys.keys))}
+	for i, key := range s.keys.keys {
+		set.Keys[i] = jose.JSONWebKey{
+			Key:       key.private.Public(),
+			KeyID:     key.kid,
+			Algorithm: key.method.Alg(),
+			Use:       "sig",
+		}
+	}
+	return set
+}
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case jwt.SigningMethodEdDSA.Alg():
+		return jwt.SigningMethodEdDSA, nil
+	case jwt.SigningMethodRS256.Alg():
+		return jwt.SigningMethodRS256, nil
+	}
+	return nil, fmt.Errorf("signing algorithm %s is not supported, use EdDSA or RS256", algorithm)
+}
+
+// newSigningKey generates a key, its kid being its RFC 7638 thumbprint
+func newSigningKey(algorithm string, activatesAt time.Time) (repository.AddSigningKeyParams, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		_, err = signingMethod(algorithm)
+	}
+	if err != nil {
+		return repository.AddSigningKeyParams{}, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return repository.AddSigningKeyParams{}, err
+	}
+
+	encrypted, err := utils.EncryptSecret(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})))
+	if err != nil {
+		return repository.AddSigningKeyParams{}, err
+	}
+
+	thumbprint, err := (&jose.JSONWebKey{Key: private.Public()}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return repository.AddSigningKeyParams{}, err
+	}
+
+	retiresAt := activatesAt.Add(config.Envs.JWTKeyRotation)
+	return repository.AddSigningKeyParams{
+		Kid:         base64.RawURLEncoding.EncodeToString(thumbprint),
+		Algorithm:   algorithm,
+		PrivateKey:  encrypted,
+		ActivatesAt: activatesAt,
+		RetiresAt:   retiresAt,
+		ExpiresAt:   retiresAt.Add(config.Envs.JWTKeyOverlap),
+	}, nil
+}
+
+func parseSigningKey(key *repository.SigningKey) (*signingKey, error) {
+	method, err := signingMethod(key.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted, err := utils.DecryptSecret(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(decrypted))
+	if block == nil {
+		return nil, fmt.Errorf("the private key is not PEM encoded")
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("the private key can't sign")
+	}
+
+	return &signingKey{
+		kid:         key.Kid,
+		method:      method,
+		private:     signer,
+		activatesAt: key.ActivatesAt,
+		retiresAt:   key.RetiresAt,
+	}, nil
+}
@@ -0,0 +1,598 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/services/storage"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+)
+
+const (
+	oauthClientIdPrefix     = "app_"
+	oauthClientSecretPrefix = "apps_"
+	oauthCodePrefix         = "oac_"
+	oauthAccessPrefix       = "oat_"
+	oauthRefreshPrefix      = "ort_"
+
+	oauthCodeExpiry    = time.Minute * 10
+	oauthAccessExpiry  = time.Hour
+	oauthRefreshExpiry = time.Hour * 24 * 30 // extended on every refresh
+
+	maxRedirectUris = 10
+
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+)
+
+var (
+	errorInvalidGrant        = NewOAuthError("invalid_grant", "the code or refresh token is invalid, expired or was issued to another client", http.StatusBadRequest)
+	errorInvalidRedirect     = errors.NewError("the redirect_uri is not registered for this client", http.StatusBadRequest)
+	errorConsentNeedsBrowser = errors.NewError("apps can only be authorized from a browser session", http.StatusForbidden)
+	errorUnknownOAuthClient  = errors.NewError("the client_id is unknown", http.StatusBadRequest)
+)
+
+type CreateOAuthClientParams struct {
+	Name         string   `json:"name"`
+	RedirectUris []string `json:"redirectUris"`
+	Confidential bool     `json:"confidential"` // confidential clients get a secret, public ones only rely on PKCE
+}
+
+type CreatedOAuthClient struct {
+	ClientSecret string `json:"clientSecret,omitempty"` // only returned when the client is created
+	*repository.OauthClient
+}
+
+// AuthorizationRequest holds the parameters a client sends to the
+// authorization endpoint, see RFC 6749 section 4.1.1 and RFC 7636
+type AuthorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientId            string `json:"client_id"`
+	RedirectUri         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// OAuthConsent is what the user is shown before authorizing a client
+type OAuthConsent struct {
+	ClientId    string   `json:"clientId"`
+	ClientName  string   `json:"clientName"`
+	RedirectUri string   `json:"redirectUri"`
+	Scopes      []string `json:"scopes"`
+}
+
+// TokenRequest holds the form parameters of the token endpoint, the client
+// secret comes from HTTP basic auth or the client_secret field
+type TokenRequest struct {
+	GrantType    string
+	ClientId     string
+	ClientSecret string
+	Scope        string
+	Code         string
+	RedirectUri  string
+	CodeVerifier string
+	RefreshToken string
+}
+
+// TokenIntrospection is the response of the introspection endpoint, see
+// RFC 7662 section 2.2. Only active is set for unknown tokens
+type TokenIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+func (s *realAuthService) CreateOAuthClient(ctx context.Context, owner *repository.User, params CreateOAuthClientParams) (*CreatedOAuthClient, error) {
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > 255 {
+		return nil, errors.NewError("the app name must be between 1 and 255 characters", http.StatusBadRequest)
+	}
+
+	if len(params.RedirectUris) == 0 || len(params.RedirectUris) > maxRedirectUris {
+		return nil, errors.NewError(fmt.Sprintf("an app needs between 1 and %d redirect URIs", maxRedirectUris), http.StatusBadRequest)
+	}
+
+	for _, redirectUri := range params.RedirectUris {
+		if err := validateRedirectUri(redirectUri); err != nil {
+			return nil, err
+		}
+	}
+
+	var secret, secretHash string
+	if params.Confidential {
+		secret = oauthClientSecretPrefix + utils.GenerateSecureToken(32)
+		secretHash = hashToken(secret)
+	}
+
+	client, err := s.storageService.AddOAuthClient(ctx, repository.AddOAuthClientParams{
+		ID:           oauthClientIdPrefix + utils.GenerateSecureToken(16),
+		OwnerId:      owner.ID,
+		Name:         params.Name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectUris,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreatedOAuthClient{secret, client}, nil
+}
+
+func (s *realAuthService) GetOAuthClients(ctx context.Context, ownerId int32) ([]*repository.OauthClient, error) {
+	return s.storageService.ListUserOAuthClients(ctx, ownerId)
+}
+
+// DeleteOAuthClient deletes the client along with every grant given to it
+func (s *realAuthService) DeleteOAuthClient(ctx context.Context, ownerId int32, clientId string) error {
+	client, err := s.storageService.GetOAuthClient(ctx, clientId)
+	if err != nil {
+		return err
+	}
+
+	if client.OwnerId != ownerId {
+		return errors.ErrorNotFound
+	}
+
+	return s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		return storage.RemoveOAuthClient(ctx, queries, client.ID)
+	})
+}
+
+func (s *realAuthService) GetAuthorizations(ctx context.Context, userId int32) ([]*repository.ListUserAuthorizationsRow, error) {
+	return s.storageService.ListUserAuthorizations(ctx, userId)
+}
+
+func (s *realAuthService) RevokeAuthorization(ctx context.Context, userId, id int32) error {
+	deleted, err := s.storageService.DeleteUserAuthorization(ctx, userId, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.ErrorNotFound
+	}
+	return nil
+}
+
+// GetOAuthConsent validates the authorization request and describes it, so
+// that the user knows what they are allowing
+func (s *realAuthService) GetOAuthConsent(ctx context.Context, user *repository.User, request AuthorizationRequest) (*OAuthConsent, error) {
+	client, scopes, oauthErr, err := s.validateAuthorizationRequest(ctx, user, request)
+	if err != nil {
+		return nil, err
+	}
+	if oauthErr != nil {
+		return nil, errors.NewError(oauthErr.Description, http.StatusBadRequest)
+	}
+
+	return &OAuthConsent{
+		ClientId:    client.ID,
+		ClientName:  client.Name,
+		RedirectUri: request.RedirectUri,
+		Scopes:      scopes,
+	}, nil
+}
+
+// AnswerOAuthConsent returns the URL the user is sent back to the client with,
+// carrying either an authorization code or an error
+func (s *realAuthService) AnswerOAuthConsent(ctx context.Context, user *repository.User, request AuthorizationRequest, approved bool) (string, error) {
+	if sessionId, ok := ctx.Value(config.SessionContextKey).(int32); !ok || sessionId == 0 {
+		return "", errorConsentNeedsBrowser
+	}
+
+	_, scopes, oauthErr, err := s.validateAuthorizationRequest(ctx, user, request)
+	if err != nil {
+		return "", err
+	}
+
+	if oauthErr != nil {
+		return buildRedirect(request.RedirectUri, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+			"state":             {request.State},
+		}), nil
+	}
+
+	if !approved {
+		return buildRedirect(request.RedirectUri, url.Values{
+			"error": {"access_denied"},
+			"state": {request.State},
+		}), nil
+	}
+
+	// codes that were never exchanged are dropped here
+	if err := s.storageService.DeleteExpiredOAuthCodes(ctx); err != nil {
+		return "", err
+	}
+
+	code := oauthCodePrefix + utils.GenerateSecureToken(32)
+	if err := s.storageService.AddOAuthCode(ctx, repository.AddOAuthCodeParams{
+		CodeHash:      hashToken(code),
+		ClientId:      request.ClientId,
+		UserId:        user.ID,
+		RedirectUri:   request.RedirectUri,
+		Scopes:        scopes,
+		CodeChallenge: request.CodeChallenge,
+		ExpiresAt:     time.Now().Add(oauthCodeExpiry),
+	}); err != nil {
+		return "", err
+	}
+
+	return buildRedirect(request.RedirectUri, url.Values{
+		"code":  {code},
+		"state": {request.State},
+	}), nil
+}
+
+// validateAuthorizationRequest returns an error that can't be sent back to the
+// client when the client or redirect URI are invalid, and an OAuthError that
+// is sent back to the redirect URI otherwise
+func (s *realAuthService) validateAuthorizationRequest(ctx context.Context, user *repository.User, request AuthorizationRequest) (*repository.OauthClient, []string, *OAuthError, error) {
+	client, err := s.storageService.GetOAuthClient(ctx, request.ClientId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, nil, errorUnknownOAuthClient
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if !slices.Contains(client.RedirectUris, request.RedirectUri) {
+		return nil, nil, nil, errorInvalidRedirect
+	}
+
+	if request.ResponseType != "code" {
+		return client, nil, NewOAuthError("unsupported_response_type", "only the code response type is supported", http.StatusBadRequest), nil
+	}
+
+	// PKCE is required from every client, as recommended by OAuth 2.1
+	if request.CodeChallengeMethod != "S256" || request.CodeChallenge == "" {
+		return client, nil, NewOAuthError("invalid_request", "a code_challenge with the S256 method is required", http.StatusBadRequest), nil
+	}
+
+	scopes := strings.Fields(request.Scope)
+	if len(scopes) == 0 {
+		return client, nil, NewOAuthError("invalid_scope", "at least one scope is required", http.StatusBadRequest), nil
+	}
+
+	// like personal access tokens, an app can't get more than the user, nor
+	// than the token the request is made with
+	callerScopes, scoped := tokenScopes(ctx)
+	for _, scope := range scopes {
+		resourceName, action, ok := strings.Cut(scope, ":")
+		if !ok || resourceName == "" || action == "" || !roleHasAction(user.Role, resourceName, action, []string{}) ||
+			(scoped && !scopesAllow(callerScopes, resourceName, action)) {
+			return client, nil, NewOAuthError("invalid_scope", fmt.Sprintf("scope %s is not allowed", scope), http.StatusBadRequest), nil
+		}
+	}
+
+	return client, scopes, nil, nil
+}
+
+// Token is the token endpoint, failures are returned as OAuthError when they
+// are caused by the request
+func (s *realAuthService) Token(ctx context.Context, request TokenRequest) (*TokenResponse, error) {
+	switch request.GrantType {
+	case GrantClientCredentials:
+		return s.clientCredentialsGrant(ctx, request.ClientId, request.ClientSecret, request.Scope)
+	case GrantAuthorizationCode:
+		return s.authorizationCodeGrant(ctx, request)
+	case GrantRefreshToken:
+		return s.refreshTokenGrant(ctx, request)
+	}
+	return nil, NewOAuthError("unsupported_grant_type", fmt.Sprintf("grant type %s is not supported", request.GrantType), http.StatusBadRequest)
+}
+
+func (s *realAuthService) authorizationCodeGrant(ctx context.Context, request TokenRequest) (*TokenResponse, error) {
+	client, err := s.authenticateOAuthClient(ctx, request.ClientId, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := s.storageService.ConsumeOAuthCode(ctx, hashToken(request.Code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errorInvalidGrant
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if code.ClientId != client.ID || code.RedirectUri != request.RedirectUri {
+		return nil, errorInvalidGrant
+	}
+
+	challenge := sha256.Sum256([]byte(request.CodeVerifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(code.CodeChallenge)) != 1 {
+		return nil, errorInvalidGrant
+	}
+
+	// grants that were not refreshed in time are dropped here
+	if err := s.storageService.DeleteExpiredOAuthTokens(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.storageService.DeleteExpiredConsumedOAuthTokens(ctx); err != nil {
+		return nil, err
+	}
+
+	accessToken := oauthAccessPrefix + utils.GenerateSecureToken(32)
+	refreshToken := oauthRefreshPrefix + utils.GenerateSecureToken(32)
+	if _, err := s.storageService.AddOAuthToken(ctx, repository.AddOAuthTokenParams{
+		ClientId:         client.ID,
+		UserId:           code.UserId,
+		Scopes:           code.Scopes,
+		AccessTokenHash:  hashToken(accessToken),
+		RefreshTokenHash: hashToken(refreshToken),
+		AccessExpiresAt:  time.Now().Add(oauthAccessExpiry),
+		RefreshExpiresAt: time.Now().Add(oauthRefreshExpiry),
+	}); err != nil {
+		return nil, err
+	}
+
+	return newOAuthTokenResponse(accessToken, refreshToken, code.Scopes), nil
+}
+
+// refreshTokenGrant rotates both tokens. The previous refresh token is
+// remembered, presenting it again revokes the grant as it was likely stolen
+func (s *realAuthService) refreshTokenGrant(ctx context.Context, request TokenRequest) (*TokenResponse, error) {
+	client, err := s.authenticateOAuthClient(ctx, request.ClientId, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	previousHash := hashToken(request.RefreshToken)
+	token, err := s.storageService.GetOAuthTokenByRefreshHash(ctx, previousHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, s.checkOAuthRefreshTokenReuse(ctx, previousHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if token.ClientId != client.ID {
+		return nil, errorInvalidGrant
+	}
+
+	accessToken := oauthAccessPrefix + utils.GenerateSecureToken(32)
+	refreshToken := oauthRefreshPrefix + utils.GenerateSecureToken(32)
+	err = s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		token, err = queries.RotateOAuthToken(ctx, repository.RotateOAuthTokenParams{
+			AccessTokenHash:          hashToken(accessToken),
+			RefreshTokenHash:         hashToken(refreshToken),
+			AccessExpiresAt:          time.Now().Add(oauthAccessExpiry),
+			RefreshExpiresAt:         time.Now().Add(oauthRefreshExpiry),
+			PreviousRefreshTokenHash: previousHash,
+		})
+		if errors.Is(err, pgx.ErrNoRows) { // another request rotated this token first
+			return errorInvalidGrant
+		}
+		if err != nil {
+			return err
+		}
+
+		return queries.AddConsumedOAuthRefreshToken(ctx, repository.AddConsumedOAuthRefreshTokenParams{
+			TokenHash: previousHash,
+			GrantId:   token.ID,
+			ExpiresAt: token.RefreshExpiresAt,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newOAuthTokenResponse(accessToken, refreshToken, token.Scopes), nil
+}
+
+// checkOAuthRefreshTokenReuse revokes the grant a rotated refresh token was
+// issued for, unlike sessions there is no grace period as a client refreshes
+// on its own
+func (s *realAuthService) checkOAuthRefreshTokenReuse(ctx context.Context, hash string) error {
+	consumed, err := s.storageService.GetConsumedOAuthRefreshToken(ctx, hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errorInvalidGrant
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		if err := queries.DeleteGrantConsumedOAuthTokens(ctx, consumed.GrantId); err != nil {
+			return err
+		}
+		return queries.DeleteOAuthToken(ctx, consumed.GrantId)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[Auth] OAuth refresh token reuse detected, revoked grant %d\n", consumed.GrantId)
+	return errorInvalidGrant
+}
+
+// IntrospectToken describes a token issued to the client, tokens of other
+// clients are reported as inactive
+func (s *realAuthService) IntrospectToken(ctx context.Context, clientId, clientSecret, token string) (*TokenIntrospection, error) {
+	client, err := s.authenticateOAuthClient(ctx, clientId, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	grant, tokenType, expiresAt, err := s.findOAuthToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if grant == nil || grant.ClientId != client.ID || time.Now().After(expiresAt) {
+		return &TokenIntrospection{Active: false}, nil
+	}
+
+	user, err := s.userService.GetUserById(ctx, grant.UserId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &TokenIntrospection{Active: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenIntrospection{
+		Active:    true,
+		Scope:     strings.Join(grant.Scopes, " "),
+		ClientId:  client.ID,
+		Username:  user.Username,
+		TokenType: tokenType,
+		Subject:   strconv.Itoa(int(user.ID)),
+		ExpiresAt: expiresAt.Unix(),
+		IssuedAt:  grant.CreatedAt.Unix(),
+	}, nil
+}
+
+// RevokeToken ends the grant of either of its tokens. Unknown tokens are not
+// an error, see RFC 7009 section 2.2
+func (s *realAuthService) RevokeToken(ctx context.Context, clientId, clientSecret, token string) error {
+	client, err := s.authenticateOAuthClient(ctx, clientId, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	grant, _, _, err := s.findOAuthToken(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	if grant == nil || grant.ClientId != client.ID {
+		return nil
+	}
+	return s.storageService.DeleteOAuthToken(ctx, grant.ID)
+}
+
+// returns the grant of an access or refresh token, and when that token expires
+func (s *realAuthService) findOAuthToken(ctx context.Context, token string) (*repository.OauthToken, string, time.Time, error) {
+	var grant *repository.OauthToken
+	var err error
+	switch {
+	case strings.HasPrefix(token, oauthAccessPrefix):
+		grant, err = s.storageService.GetOAuthTokenByAccessHash(ctx, hashToken(token))
+		if err == nil {
+			return grant, "access_token", grant.AccessExpiresAt, nil
+		}
+	case strings.HasPrefix(token, oauthRefreshPrefix):
+		grant, err = s.storageService.GetOAuthTokenByRefreshHash(ctx, hashToken(token))
+		if err == nil {
+			return grant, "refresh_token", grant.RefreshExpiresAt, nil
+		}
+	default:
+		return nil, "", time.Time{}, nil
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, "", time.Time{}, nil
+	}
+	return nil, "", time.Time{}, err
+}
+
+// authenticateOAuthClient checks the secret of confidential clients, public
+// clients are identified by their client_id alone
+func (s *realAuthService) authenticateOAuthClient(ctx context.Context, clientId, clientSecret string) (*repository.OauthClient, error) {
+	if clientId == "" {
+		return nil, errorInvalidClient
+	}
+
+	client, err := s.storageService.GetOAuthClient(ctx, clientId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errorInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.SecretHash != "" && subtle.ConstantTimeCompare([]byte(hashToken(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, errorInvalidClient
+	}
+	return client, nil
+}
+
+// returns the user the token was issued for and the scopes the request is
+// limited to
+func (s *realAuthService) authenticateOAuthToken(ctx context.Context, token string) (*repository.User, []string, error) {
+	grant, err := s.storageService.GetOAuthTokenByAccessHash(ctx, hashToken(token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, errors.ErrorNotAuthenticated
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if time.Now().After(grant.AccessExpiresAt) {
+		return nil, nil, errors.ErrorNotAuthenticated
+	}
+
+	user, err := s.userService.GetCachedUser(ctx, grant.UserId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, errors.ErrorNotAuthenticated
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.storageService.TouchOAuthToken(ctx, grant.ID); err != nil {
+		return nil, nil, err
+	}
+
+	return user, grant.Scopes, nil
+}
+
+func newOAuthTokenResponse(accessToken, refreshToken string, scopes []string) *TokenResponse {
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessExpiry.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}
+}
+
+// redirect URIs are compared exactly. Plain http is only allowed for apps
+// running on the machine of the user, see RFC 8252 section 7.3
+func validateRedirectUri(redirectUri string) error {
+	parsed, err := url.Parse(redirectUri)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" || parsed.Fragment != "" {
+		return errors.NewError(fmt.Sprintf("redirect URI %s must be an absolute URL without a fragment", redirectUri), http.StatusBadRequest)
+	}
+
+	loopback := parsed.Hostname() == "localhost" || parsed.Hostname() == "127.0.0.1" || parsed.Hostname() == "::1"
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && loopback) {
+		return errors.NewError(fmt.Sprintf("redirect URI %s must use https", redirectUri), http.StatusBadRequest)
+	}
+	return nil
+}
+
+func buildRedirect(redirectUri string, params url.Values) string {
+	parsed, _ := url.Parse(redirectUri) // validated when the client was created
+	query := parsed.Query()
+	for key, values := range params {
+		if values[0] != "" {
+			query[key] = values
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"slices"
+	"strconv"
 
 	"github.com/piquel-fr/api/config"
 	"github.com/piquel-fr/api/utils/errors"
@@ -15,8 +16,24 @@ func (s *realAuthService) Authorize(request *config.AuthRequest) error {
 	role := request.User.Role
 	resourceName := request.Ressource.GetResourceName()
 
+	// requests made with a personal access token are limited to its scopes
+	if scopes, ok := tokenScopes(request.Context); ok {
+		for _, action := range request.Actions {
+			if !scopesAllow(scopes, resourceName, action) {
+				explain(request, 0, "", action, "the token scopes %v don't allow %s:%s", scopes, resourceName, action)
+				return errors.ErrorForbidden
+			}
+		}
+	}
+
+	if !impersonationAllows(request.Context, request.Actions) {
+		explain(request, 0, "", "", "the actions %v can't be done while impersonating", request.Actions)
+		return errorImpersonationForbidden
+	}
+
 	// system role has all permissions
 	if role == RoleSystem {
+		explain(request, 0, role, "", "role %s has all permissions", role)
 		return nil
 	}
 
@@ -24,7 +41,8 @@ func (s *realAuthService) Authorize(request *config.AuthRequest) error {
 		return newRequestMalformedError(request)
 	}
 
-	isAuthozized, err := s.authorize(request, role, resourceName, []string{})
+	// the policy can be reloaded meanwhile, the whole request is checked against one
+	isAuthozized, err := s.authorize(policy.Load(), request, role, resourceName, []string{})
 	if err != nil {
 		return err
 	}
@@ -36,8 +54,8 @@ func (s *realAuthService) Authorize(request *config.AuthRequest) error {
 	return errors.ErrorForbidden
 }
 
-func (s *realAuthService) authorize(request *config.AuthRequest, roleName, resourceName string, checkedRoles []string) (bool, error) {
-	role, ok := policy.Roles[roleName]
+func (s *realAuthService) authorize(current *config.PolicyConfiguration, request *config.AuthRequest, roleName, resourceName string, checkedRoles []string) (bool, error) {
+	role, ok := current.Roles[roleName]
 	if !ok {
 		return false, newRoleNotFoundError(roleName)
 	}
@@ -57,12 +75,14 @@ func (s *realAuthService) authorize(request *config.AuthRequest, roleName, resou
 			return false, newRequestMalformedError(request)
 		}
 
-		isAuthozized, err := s.validateAction(permissions, action, request)
+		explain(request, len(checkedRoles), roleName, action, "checking the %d permissions of role %s on %s", len(permissions), roleName, resourceName)
+		isAuthozized, err := s.validateAction(current, permissions, roleName, action, request, len(checkedRoles))
 		if err != nil {
 			return false, err
 		}
 
 		if !isAuthozized && len(parents) > 0 {
+			explain(request, len(checkedRoles), roleName, action, "role %s does not grant %s, checking its parents %v", roleName, action, parents)
 			checkedRoles = append(checkedRoles, roleName)
 
 			for _, parent := range parents {
@@ -77,7 +97,7 @@ func (s *realAuthService) authorize(request *config.AuthRequest, roleName, resou
 					return false, newRoleInheritanceCycleError(checkedRoles, parent)
 				}
 
-				isAuthozized, err := s.authorize(parentRequest, parent, resourceName, checkedRoles)
+				isAuthozized, err = s.authorize(current, parentRequest, parent, resourceName, checkedRoles)
 				if err != nil {
 					return false, err
 				}
@@ -89,6 +109,7 @@ func (s *realAuthService) authorize(request *config.AuthRequest, roleName, resou
 		}
 
 		if !isAuthozized {
+			explain(request, len(checkedRoles), roleName, action, "role %s does not grant %s", roleName, action)
 			return false, nil
 		}
 	}
@@ -96,11 +117,29 @@ func (s *realAuthService) authorize(request *config.AuthRequest, roleName, resou
 	return true, nil
 }
 
-func (s *realAuthService) validateAction(permissions []*config.Permission, action string, request *config.AuthRequest) (bool, error) {
+// depth is how many parents away from the role of the user roleName is, it
+// is only used to explain the decision
+func (s *realAuthService) validateAction(current *config.PolicyConfiguration, permissions []*config.Permission, roleName, action string, request *config.AuthRequest, depth int) (bool, error) {
 	for _, permission := range permissions {
 
 		if permission.Preset != "" {
-			permission = policy.Presets[permission.Preset]
+			preset, ok := current.ResolvedPresets[permission.Preset]
+			if !ok {
+				explain(request, depth, roleName, action, "preset %s does not exist", permission.Preset)
+				return false, newPresetNotFoundError(permission.Preset)
+			}
+
+			if preset.Action != action {
+				continue
+			}
+
+			// the conditions of the role narrow down the ones of the preset
+			explain(request, depth, roleName, action, "preset %s resolved through %v", permission.Preset, preset.Presets)
+			permission = &config.Permission{
+				Action:         preset.Action,
+				Conditions:     append(slices.Clone(preset.Conditions), permission.Conditions...),
+				ConditionNames: append(slices.Clone(preset.ConditionNames), permission.ConditionNames...),
+			}
 		}
 
 		if permission.Action != action {
@@ -108,10 +147,12 @@ func (s *realAuthService) validateAction(permissions []*config.Permission, actio
 		}
 
 		if len(permission.Conditions) == 0 {
+			explain(request, depth, roleName, action, "permission %s matched without conditions", action)
 			return true, nil
 		}
 
-		isAuthozized, err := s.checkPermission(permission, request)
+		explain(request, depth, roleName, action, "permission %s matched, checking its %d conditions", action, len(permission.Conditions))
+		isAuthozized, err := s.checkPermission(permission, roleName, request, depth)
 		if err != nil {
 			return false, err
 		}
@@ -124,17 +165,24 @@ func (s *realAuthService) validateAction(permissions []*config.Permission, actio
 	return false, nil
 }
 
-func (s *realAuthService) checkPermission(permission *config.Permission, request *config.AuthRequest) (bool, error) {
+func (s *realAuthService) checkPermission(permission *config.Permission, roleName string, request *config.AuthRequest, depth int) (bool, error) {
 	if permission.Conditions == nil {
 		return true, nil
 	}
 
 	// all conditions must pass
-	for _, condition := range permission.Conditions {
+	for i, condition := range permission.Conditions {
+		name := strconv.Itoa(i)
+		if i < len(permission.ConditionNames) {
+			name = permission.ConditionNames[i]
+		}
+
 		err := condition(request)
 		if err != nil {
+			explain(request, depth, roleName, permission.Action, "condition %s failed: %s", name, err.Error())
 			return false, err
 		}
+		explain(request, depth, roleName, permission.Action, "condition %s passed", name)
 	}
 
 	return true, nil
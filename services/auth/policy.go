@@ -2,6 +2,7 @@ package auth
 
 import (
 	"slices"
+	"sync/atomic"
 
 	"github.com/piquel-fr/api/config"
 	"github.com/piquel-fr/api/database/repository"
@@ -26,16 +27,53 @@ const (
 
 	// admin stuff
 	ActionUpdateAdmin = "update_admin"
+	ActionImpersonate = "impersonate"
+	ActionExplain     = "explain_authorization"
+
+	// service accounts
+	ActionManageServiceAccounts = "manage_service_accounts"
 
 	// sessions
 	ActionViewUserSessions   = "view_user_sessions"
 	ActionDeleteUserSessions = "delete_user_sessions"
 
+	// identities
+	ActionViewUserIdentities   = "view_user_identities"
+	ActionLinkUserIdentities   = "link_user_identities"
+	ActionUnlinkUserIdentities = "unlink_user_identities"
+
+	// personal access tokens
+	ActionViewUserTokens   = "view_user_tokens"
+	ActionCreateUserTokens = "create_user_tokens"
+	ActionDeleteUserTokens = "delete_user_tokens"
+
+	// OAuth apps, and the grants users give them
+	ActionViewOAuthClients      = "view_oauth_clients"
+	ActionCreateOAuthClients    = "create_oauth_clients"
+	ActionDeleteOAuthClients    = "delete_oauth_clients"
+	ActionAuthorizeOAuthClients = "authorize_oauth_clients"
+	ActionViewAuthorizations    = "view_authorizations"
+	ActionRevokeAuthorizations  = "revoke_authorizations"
+
+	// two factor authentication
+	ActionViewTwoFactor    = "view_two_factor"
+	ActionEnrollTwoFactor  = "enroll_two_factor"
+	ActionDisableTwoFactor = "disable_two_factor"
+
+	// passkeys
+	ActionViewPasskeys   = "view_passkeys"
+	ActionManagePasskeys = "manage_passkeys"
+
 	// email
-	ActionViewEmail         = "view_email"
-	ActionListEmailAccounts = "list_email_accounts"
+	ActionViewEmail              = "view_email"
+	ActionListEmailAccounts      = "list_email_accounts"
+	ActionSendEmail              = "send_email"
+	ActionViewEmailInvitations   = "view_email_invitations"
+	ActionAnswerEmailInvitations = "answer_email_invitations"
 )
 
+// these conditions can be named in policy files, see policyConditions
+
 func own(request *config.AuthRequest) error {
 	if request.Ressource.GetOwner() == request.User.ID {
 		return nil
@@ -43,14 +81,49 @@ func own(request *config.AuthRequest) error {
 	return errors.ErrorForbidden
 }
 
+// sharedWith lets the owner of a mail account and the users it is shared with
+func sharedWith(request *config.AuthRequest) error {
+	if request.Ressource.GetOwner() == request.User.ID {
+		return nil
+	}
+
+	info, ok := request.Ressource.(*email.AccountInfo)
+	if !ok {
+		return newRequestMalformedError(request)
+	}
+
+	if slices.Contains(info.Shares, request.User.Username) {
+		return nil
+	}
+	return errors.ErrorNotFound
+}
+
+// sameRole only lets users act on users that have their role
+func sameRole(request *config.AuthRequest) error {
+	user, ok := request.Ressource.(*repository.User)
+	if !ok {
+		return newRequestMalformedError(request)
+	}
+
+	if user.Role == request.User.Role {
+		return nil
+	}
+	return errors.ErrorForbidden
+}
+
 func makeOwn(action string) *config.Permission {
 	return &config.Permission{
-		Action:     action,
-		Conditions: config.Conditions{own},
+		Action:         action,
+		Conditions:     config.Conditions{own},
+		ConditionNames: []string{"own"},
 	}
 }
 
-var policy = config.PolicyConfiguration{
+// policy is the one authorization is checked against, the built-in one
+// unless a file is configured, see loadPolicy. It is swapped when reloaded
+var policy atomic.Pointer[config.PolicyConfiguration]
+
+var defaultPolicy = config.PolicyConfiguration{
 	Presets: map[string]*config.Permission{},
 	Roles: map[string]*config.Role{
 		RoleSystem: {
@@ -68,8 +141,58 @@ var policy = config.PolicyConfiguration{
 					{Action: ActionDelete},
 					{Action: ActionViewEmail},
 					{Action: ActionUpdateAdmin},
+					{Action: ActionExplain},
 					{Action: ActionViewUserSessions},
 					{Action: ActionDeleteUserSessions},
+					{Action: ActionViewUserIdentities},
+					{Action: ActionUnlinkUserIdentities},
+					{Action: ActionViewUserTokens},
+					{Action: ActionDeleteUserTokens},
+					{Action: ActionViewOAuthClients},
+					{Action: ActionDeleteOAuthClients},
+					{Action: ActionViewAuthorizations},
+					{Action: ActionRevokeAuthorizations},
+					{Action: ActionViewTwoFactor},
+					{Action: ActionDisableTwoFactor},
+					{Action: ActionViewPasskeys},
+					{Action: ActionManagePasskeys},
+					{
+						Action: ActionImpersonate,
+						Conditions: config.Conditions{
+							// impersonating an admin would not show anything new
+							// and impersonating the system would be an escalation
+							func(request *config.AuthRequest) error {
+								user, ok := request.Ressource.(*repository.User)
+								if !ok {
+									return newRequestMalformedError(request)
+								}
+
+								if user.Role == RoleAdmin || user.Role == RoleSystem {
+									return errors.ErrorForbidden
+								}
+								return nil
+							},
+						},
+						ConditionNames: []string{"resource.role not_in [admin system]"},
+					},
+					{
+						Action: ActionManageServiceAccounts,
+						Conditions: config.Conditions{
+							// a system service account would be an escalation
+							func(request *config.AuthRequest) error {
+								user, ok := request.Ressource.(*repository.User)
+								if !ok {
+									return newRequestMalformedError(request)
+								}
+
+								if user.Role == RoleSystem {
+									return errors.ErrorForbidden
+								}
+								return nil
+							},
+						},
+						ConditionNames: []string{"resource.role not_equals system"},
+					},
 				},
 				repository.ResourceMailAccount: {
 					{Action: ActionView},
@@ -78,6 +201,12 @@ var policy = config.PolicyConfiguration{
 					{Action: ActionListEmailAccounts},
 					{Action: ActionShare},
 				},
+				repository.ResourceRole: {
+					{Action: ActionView},
+					{Action: ActionCreate},
+					{Action: ActionUpdate},
+					{Action: ActionDelete},
+				},
 			},
 			Parents: []string{RoleDefault, RoleDeveloper},
 		},
@@ -87,26 +216,13 @@ var policy = config.PolicyConfiguration{
 			Permissions: map[string][]*config.Permission{
 				repository.ResourceMailAccount: {
 					{
-						Action: ActionView,
-						Conditions: config.Conditions{
-							func(request *config.AuthRequest) error {
-								if request.Ressource.GetOwner() == request.User.ID {
-									return nil
-								}
-
-								info, ok := request.Ressource.(*email.AccountInfo)
-								if !ok {
-									return newRequestMalformedError(request)
-								}
-
-								if slices.Contains(info.Shares, request.User.Username) {
-									return nil
-								}
-								return errors.ErrorNotFound
-							},
-						},
+						Action:         ActionView,
+						Conditions:     config.Conditions{sharedWith},
+						ConditionNames: []string{"shared_with"},
 					},
+					makeOwn(ActionUpdate),
 					makeOwn(ActionDelete),
+					makeOwn(ActionSendEmail),
 				},
 				repository.ResourceUser: {
 					makeOwn(ActionShare),
@@ -125,6 +241,28 @@ var policy = config.PolicyConfiguration{
 					makeOwn(ActionViewEmail),
 					makeOwn(ActionViewUserSessions),
 					makeOwn(ActionDeleteUserSessions),
+					makeOwn(ActionViewUserIdentities),
+					makeOwn(ActionLinkUserIdentities),
+					makeOwn(ActionUnlinkUserIdentities),
+					makeOwn(ActionViewUserTokens),
+					makeOwn(ActionCreateUserTokens),
+					makeOwn(ActionDeleteUserTokens),
+					makeOwn(ActionViewOAuthClients),
+					makeOwn(ActionCreateOAuthClients),
+					makeOwn(ActionDeleteOAuthClients),
+					makeOwn(ActionAuthorizeOAuthClients),
+					makeOwn(ActionViewAuthorizations),
+					makeOwn(ActionRevokeAuthorizations),
+					makeOwn(ActionViewTwoFactor),
+					makeOwn(ActionEnrollTwoFactor),
+					makeOwn(ActionDisableTwoFactor),
+					makeOwn(ActionViewPasskeys),
+					makeOwn(ActionManagePasskeys),
+					makeOwn(ActionViewEmailInvitations),
+					makeOwn(ActionAnswerEmailInvitations),
+				},
+				repository.ResourceMailAccount: {
+					makeOwn(ActionCreate),
 				},
 			},
 		},
@@ -0,0 +1,318 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// A policy file mirrors config.PolicyConfiguration. As JSON is valid YAML,
+// both are read the same way. Conditions are either the name of one of
+// policyConditions or a comparison of an attribute of the request. Presets
+// can be composed of another preset, adding their own conditions, and so can
+// the permissions using them:
+//
+//	presets:
+//	  update_own:
+//	    action: update
+//	    conditions: [own]
+//	  update_own_service:
+//	    preset: update_own
+//	    conditions:
+//	      - attribute: resource.kind
+//	        equals: service
+//	roles:
+//	  moderator:
+//	    name: Moderator
+//	    color: green
+//	    parents: [default]
+//	    permissions:
+//	      user:
+//	        - action: update
+//	          conditions:
+//	            - attribute: resource.role
+//	              not_in: [admin, system]
+type policyFile struct {
+	Presets map[string]*policyFilePermission `yaml:"presets"`
+	Roles   map[string]*policyFileRole       `yaml:"roles"`
+}
+
+type policyFileRole struct {
+	Name        string                             `yaml:"name"`
+	Color       string                             `yaml:"color"`
+	Permissions map[string][]*policyFilePermission `yaml:"permissions"`
+	Parents     []string                           `yaml:"parents"`
+}
+
+type policyFilePermission struct {
+	Action     string                 `yaml:"action"`
+	Preset     string                 `yaml:"preset"`
+	Conditions []*policyFileCondition `yaml:"conditions"`
+}
+
+// only one comparison can be set on a condition
+type policyFileCondition struct {
+	Name      string   `yaml:"-"`
+	Attribute string   `yaml:"attribute"`
+	Equals    *string  `yaml:"equals"`
+	NotEquals *string  `yaml:"not_equals"`
+	In        []string `yaml:"in"`
+	NotIn     []string `yaml:"not_in"`
+}
+
+func (c *policyFileCondition) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&c.Name)
+	}
+
+	type plain policyFileCondition
+	return node.Decode((*plain)(c))
+}
+
+// policyConditions and policyAttributes only apply to resource when it is
+// set, using them on another resource makes the policy invalid
+type policyCondition struct {
+	resource string
+	check    func(request *config.AuthRequest) error
+}
+
+type policyAttribute struct {
+	resource string
+	value    func(request *config.AuthRequest) (string, bool)
+}
+
+var policyConditions = map[string]policyCondition{
+	"own":         {check: own},
+	"shared_with": {resource: repository.ResourceMailAccount, check: sharedWith},
+	"same_role":   {resource: repository.ResourceUser, check: sameRole},
+}
+
+// the resource attributes other than its owner only exist on users
+var policyAttributes = map[string]policyAttribute{
+	"user.id":       {value: func(request *config.AuthRequest) (string, bool) { return strconv.Itoa(int(request.User.ID)), true }},
+	"user.username": {value: func(request *config.AuthRequest) (string, bool) { return request.User.Username, true }},
+	"user.role":     {value: func(request *config.AuthRequest) (string, bool) { return request.User.Role, true }},
+	"user.kind":     {value: func(request *config.AuthRequest) (string, bool) { return request.User.Kind, true }},
+	"resource.owner": {value: func(request *config.AuthRequest) (string, bool) {
+		return strconv.Itoa(int(request.Ressource.GetOwner())), true
+	}},
+	"resource.id": {repository.ResourceUser, func(request *config.AuthRequest) (string, bool) {
+		user, ok := request.Ressource.(*repository.User)
+		if !ok {
+			return "", false
+		}
+		return strconv.Itoa(int(user.ID)), true
+	}},
+	"resource.username": {repository.ResourceUser, func(request *config.AuthRequest) (string, bool) {
+		user, ok := request.Ressource.(*repository.User)
+		if !ok {
+			return "", false
+		}
+		return user.Username, true
+	}},
+	"resource.role": {repository.ResourceUser, func(request *config.AuthRequest) (string, bool) {
+		user, ok := request.Ressource.(*repository.User)
+		if !ok {
+			return "", false
+		}
+		return user.Role, true
+	}},
+	"resource.kind": {repository.ResourceUser, func(request *config.AuthRequest) (string, bool) {
+		user, ok := request.Ressource.(*repository.User)
+		if !ok {
+			return "", false
+		}
+		return user.Kind, true
+	}},
+}
+
+// loadPolicy replaces the built-in policy with the configured file, if any,
+// and stops the API if the policy is not valid
+func loadPolicy() {
+	loaded := &defaultPolicy
+	if config.Envs.PolicyFile != "" {
+		var err error
+		loaded, err = readPolicyFile(config.Envs.PolicyFile)
+		if err != nil {
+			log.Fatalf("[Auth] Failed to load the policy: %s", err.Error())
+		}
+		log.Printf("[Auth] Loaded the policy from %s\n", config.Envs.PolicyFile)
+	}
+
+	if err := loaded.Validate(); err != nil {
+		log.Fatalf("[Auth] %s", err.Error())
+	}
+	basePolicy.Store(loaded)
+	policy.Store(loaded)
+}
+
+func readPolicyFile(path string) (*config.PolicyConfiguration, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var parsed policyFile
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	compiled, err := parsed.compile()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return compiled, nil
+}
+
+func (f *policyFile) compile() (*config.PolicyConfiguration, error) {
+	compiled := &config.PolicyConfiguration{
+		Presets: map[string]*config.Permission{},
+		Roles:   map[string]*config.Role{},
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(f.Presets)) {
+		permission, err := f.Presets[name].compile()
+		if err != nil {
+			return nil, fmt.Errorf("preset %s: %w", name, err)
+		}
+		compiled.Presets[name] = permission
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(f.Roles)) {
+		role := f.Roles[name]
+		if role == nil {
+			return nil, fmt.Errorf("role %s is empty", name)
+		}
+
+		permissions := map[string][]*config.Permission{}
+		for _, resource := range slices.Sorted(maps.Keys(role.Permissions)) {
+			for i, permission := range role.Permissions[resource] {
+				compiledPermission, err := permission.compile()
+				if err != nil {
+					return nil, fmt.Errorf("role %s: permission %d on %s: %w", name, i, resource, err)
+				}
+				permissions[resource] = append(permissions[resource], compiledPermission)
+			}
+		}
+
+		compiled.Roles[name] = &config.Role{
+			Name:        role.Name,
+			Color:       role.Color,
+			Permissions: permissions,
+			Parents:     role.Parents,
+		}
+	}
+
+	return compiled, nil
+}
+
+func (p *policyFilePermission) compile() (*config.Permission, error) {
+	if p == nil {
+		return nil, fmt.Errorf("permission is empty")
+	}
+	if p.Preset != "" && p.Action != "" {
+		return nil, fmt.Errorf("a permission using preset %s can't set its own action", p.Preset)
+	}
+
+	permission := &config.Permission{Action: p.Action, Preset: p.Preset}
+	for i, condition := range p.Conditions {
+		compiled, resource, err := condition.compile()
+		if err != nil {
+			return nil, fmt.Errorf("condition %d: %w", i, err)
+		}
+
+		if resource != "" && permission.Resource != "" && resource != permission.Resource {
+			return nil, fmt.Errorf("condition %d only applies to %s, the others to %s", i, resource, permission.Resource)
+		}
+		if resource != "" {
+			permission.Resource = resource
+		}
+
+		permission.Conditions = append(permission.Conditions, compiled)
+		permission.ConditionNames = append(permission.ConditionNames, condition.describe())
+	}
+
+	return permission, nil
+}
+
+// describe is how the condition is written in a policy file
+func (c *policyFileCondition) describe() string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case c.Equals != nil:
+		return fmt.Sprintf("%s equals %s", c.Attribute, *c.Equals)
+	case c.NotEquals != nil:
+		return fmt.Sprintf("%s not_equals %s", c.Attribute, *c.NotEquals)
+	case c.In != nil:
+		return fmt.Sprintf("%s in %v", c.Attribute, c.In)
+	default:
+		return fmt.Sprintf("%s not_in %v", c.Attribute, c.NotIn)
+	}
+}
+
+// compile also returns the only resource the condition applies to, if any
+func (c *policyFileCondition) compile() (func(request *config.AuthRequest) error, string, error) {
+	if c == nil {
+		return nil, "", fmt.Errorf("condition is empty")
+	}
+
+	if c.Name != "" {
+		condition, ok := policyConditions[c.Name]
+		if !ok {
+			return nil, "", fmt.Errorf("unknown condition %s, expected one of %v", c.Name, slices.Sorted(maps.Keys(policyConditions)))
+		}
+		return condition.check, condition.resource, nil
+	}
+
+	attribute, ok := policyAttributes[c.Attribute]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown attribute %q, expected one of %v", c.Attribute, slices.Sorted(maps.Keys(policyAttributes)))
+	}
+
+	var matches func(value string) bool
+	comparisons := 0
+	if c.Equals != nil {
+		comparisons++
+		matches = func(value string) bool { return value == *c.Equals }
+	}
+	if c.NotEquals != nil {
+		comparisons++
+		matches = func(value string) bool { return value != *c.NotEquals }
+	}
+	if c.In != nil {
+		comparisons++
+		matches = func(value string) bool { return slices.Contains(c.In, value) }
+	}
+	if c.NotIn != nil {
+		comparisons++
+		matches = func(value string) bool { return !slices.Contains(c.NotIn, value) }
+	}
+	if comparisons != 1 {
+		return nil, "", fmt.Errorf("attribute %s needs exactly one of equals, not_equals, in or not_in", c.Attribute)
+	}
+
+	return func(request *config.AuthRequest) error {
+		// the resource is checked when loading, a resource of another type
+		// just doesn't match
+		value, ok := attribute.value(request)
+		if !ok {
+			return errors.ErrorForbidden
+		}
+		if matches(value) {
+			return nil
+		}
+		return errors.ErrorForbidden
+	}, attribute.resource, nil
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/piquel-fr/api/config"
+)
+
+var (
+	// basePolicy is the policy file or the built-in policy, the custom roles
+	// are merged into it to make policy
+	basePolicy  atomic.Pointer[config.PolicyConfiguration]
+	policyMutex sync.Mutex // reloads are applied one at a time
+)
+
+// StartPolicyReload merges the custom roles into the policy, then watches
+// the policy file and the roles in the background until ctx is done. A
+// changed policy only replaces the current one if it is valid and keeps the
+// roles users have
+func (s *realAuthService) StartPolicyReload(ctx context.Context) {
+	if err := s.reloadPolicy(ctx, false); err != nil {
+		log.Fatalf("[Auth] Failed to load the custom roles: %s", err.Error())
+	}
+
+	if config.Envs.PolicyFile != "" {
+		log.Printf("[Auth] Watching %s for policy changes...\n", config.Envs.PolicyFile)
+	}
+
+	lastModified := policyFileModified()
+	lastRoles, err := s.customRolesVersion(ctx)
+	if err != nil {
+		log.Fatalf("[Auth] Failed to load the custom roles: %s", err.Error())
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.Envs.PolicyReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				modified := policyFileModified()
+				roles, err := s.customRolesVersion(ctx)
+				if err != nil {
+					log.Printf("[Auth] Failed to check the custom roles: %s\n", err.Error())
+					continue
+				}
+
+				fileChanged := !modified.Equal(lastModified)
+				if !fileChanged && roles == lastRoles {
+					continue
+				}
+				lastModified, lastRoles = modified, roles
+
+				if err := s.reloadPolicy(ctx, fileChanged); err != nil {
+					log.Printf("[Auth] Kept the current policy, the new one is not valid: %s\n", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// policyFileModified is zero if the file can't be read or there is none,
+// reading it then reports why
+func policyFileModified() time.Time {
+	if config.Envs.PolicyFile == "" {
+		return time.Time{}
+	}
+
+	info, err := os.Stat(config.Envs.PolicyFile)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadPolicy merges the custom roles into the base policy, reading the
+// policy file again first if readFile is set
+func (s *realAuthService) reloadPolicy(ctx context.Context, readFile bool) error {
+	policyMutex.Lock()
+	defer policyMutex.Unlock()
+
+	base := basePolicy.Load()
+	if readFile {
+		var err error
+		base, err = readPolicyFile(config.Envs.PolicyFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	roles, err := loadCustomRoles(ctx, s.storageService)
+	if err != nil {
+		return err
+	}
+
+	loaded, err := mergeCustomRoles(base, roles)
+	if err != nil {
+		return err
+	}
+
+	if err := loaded.Validate(); err != nil {
+		return err
+	}
+
+	if err := s.checkRolesInUse(ctx, loaded); err != nil {
+		return err
+	}
+
+	basePolicy.Store(base)
+	previous := policy.Swap(loaded)
+	config.Policy.Store(loaded)
+
+	changes := diffPolicies(previous, loaded)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	log.Printf("[Auth] Reloaded the policy, %d changes\n", len(changes))
+	for _, change := range changes {
+		log.Printf("[Auth]   %s\n", change)
+	}
+	return nil
+}
+
+// checkRolesInUse makes sure the policy keeps the roles the API gives and the
+// ones users still have, they could not do anything otherwise
+func (s *realAuthService) checkRolesInUse(ctx context.Context, loaded *config.PolicyConfiguration) error {
+	assigned, err := s.storageService.ListAssignedRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, role := range slices.Concat([]string{RoleDefault, RoleAdmin}, assigned) {
+		// the system role has all permissions without being in the policy
+		if _, ok := loaded.Roles[role]; !ok && role != RoleSystem && !slices.Contains(missing, role) {
+			missing = append(missing, role)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("the policy is missing the roles %v, they are required or still given to users", missing)
+	}
+	return nil
+}
+
+// diffPolicies describes what changed between two policies. Conditions are
+// compared by their names
+func diffPolicies(previous, current *config.PolicyConfiguration) []string {
+	var changes []string
+
+	for _, name := range sortedUnion(previous.Presets, current.Presets) {
+		before, after := describePermissions(previous.Presets[name]), describePermissions(current.Presets[name])
+		switch {
+		case len(before) == 0:
+			changes = append(changes, fmt.Sprintf("+ preset %s: %s", name, after[0]))
+		case len(after) == 0:
+			changes = append(changes, fmt.Sprintf("- preset %s", name))
+		case before[0] != after[0]:
+			changes = append(changes, fmt.Sprintf("~ preset %s: %s -> %s", name, before[0], after[0]))
+		}
+	}
+
+	for _, name := range sortedUnion(previous.Roles, current.Roles) {
+		before, after := previous.Roles[name], current.Roles[name]
+		switch {
+		case before == nil:
+			changes = append(changes, fmt.Sprintf("+ role %s", name))
+			before = &config.Role{}
+		case after == nil:
+			changes = append(changes, fmt.Sprintf("- role %s", name))
+			continue
+		}
+
+		if before.Name != after.Name || before.Color != after.Color {
+			changes = append(changes, fmt.Sprintf("~ role %s: displayed as %q in %s", name, after.Name, after.Color))
+		}
+		if !slices.Equal(before.Parents, after.Parents) {
+			changes = append(changes, fmt.Sprintf("~ role %s: parents %v -> %v", name, before.Parents, after.Parents))
+		}
+
+		for _, resource := range sortedUnion(before.Permissions, after.Permissions) {
+			beforePermissions := describePermissions(before.Permissions[resource]...)
+			afterPermissions := describePermissions(after.Permissions[resource]...)
+			for _, permission := range afterPermissions {
+				if !slices.Contains(beforePermissions, permission) {
+					changes = append(changes, fmt.Sprintf("+ role %s: %s %s", name, resource, permission))
+				}
+			}
+			for _, permission := range beforePermissions {
+				if !slices.Contains(afterPermissions, permission) {
+					changes = append(changes, fmt.Sprintf("- role %s: %s %s", name, resource, permission))
+				}
+			}
+		}
+	}
+
+	return changes
+}
+
+func describePermissions(permissions ...*config.Permission) []string {
+	var descriptions []string
+	for _, permission := range permissions {
+		if permission == nil {
+			continue
+		}
+
+		description := permission.Action
+		if permission.Preset != "" {
+			description = "preset " + permission.Preset
+		}
+		if len(permission.Conditions) > 0 {
+			description += fmt.Sprintf(" if %v", permission.ConditionNames)
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions
+}
+
+func sortedUnion[V any](a, b map[string]V) []string {
+	keys := slices.Collect(maps.Keys(a))
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
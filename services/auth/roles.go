@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils/errors"
+)
+
+var roleIdRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+
+// RoleParams describes a custom role. Permissions are grouped by resource and
+// use the presets and named conditions of the policy
+type RoleParams struct {
+	Name        string                             `json:"name"`
+	Color       string                             `json:"color"`
+	Parents     []string                           `json:"parents"`
+	Permissions map[string][]*RolePermissionParams `json:"permissions"`
+}
+
+type RolePermissionParams struct {
+	Action     string   `json:"action,omitempty"`
+	Preset     string   `json:"preset,omitempty"`
+	Conditions []string `json:"conditions,omitempty"`
+}
+
+type CustomRole struct {
+	*repository.Role
+	Permissions map[string][]*RolePermissionParams `json:"permissions"`
+}
+
+func (s *realAuthService) GetCustomRoles(ctx context.Context) ([]*CustomRole, error) {
+	roles, err := s.storageService.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.storageService.ListRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	customRoles := make([]*CustomRole, 0, len(roles))
+	for _, role := range roles {
+		customRoles = append(customRoles, &CustomRole{role, groupRolePermissions(role.ID, permissions)})
+	}
+
+	return customRoles, nil
+}
+
+func (s *realAuthService) CreateCustomRole(ctx context.Context, id string, params RoleParams) error {
+	if !roleIdRegex.MatchString(id) {
+		return errors.NewError(fmt.Sprintf("role %s is not valid, use lowercase letters, digits, - and _", id), http.StatusBadRequest)
+	}
+
+	roles, err := s.storageService.ListRoles(ctx)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(roles, func(role *repository.Role) bool { return role.ID == id }) {
+		return errors.NewError(fmt.Sprintf("role %s already exists", id), http.StatusConflict)
+	}
+
+	if err := s.validateCustomRoles(ctx, id, &params); err != nil {
+		return err
+	}
+
+	err = s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		err := queries.AddRole(ctx, repository.AddRoleParams{
+			ID:      id,
+			Name:    params.Name,
+			Color:   params.Color,
+			Parents: orEmpty(params.Parents),
+		})
+		if err != nil {
+			return err
+		}
+
+		return addRolePermissions(ctx, queries, id, params.Permissions)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.applyCustomRoles(ctx)
+	return nil
+}
+
+func (s *realAuthService) UpdateCustomRole(ctx context.Context, id string, params RoleParams) error {
+	if err := s.validateCustomRoles(ctx, id, &params); err != nil {
+		return err
+	}
+
+	err := s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		updated, err := queries.UpdateRole(ctx, repository.UpdateRoleParams{
+			ID:      id,
+			Name:    params.Name,
+			Color:   params.Color,
+			Parents: orEmpty(params.Parents),
+		})
+		if err != nil {
+			return err
+		}
+		if updated == 0 {
+			return errors.ErrorNotFound
+		}
+
+		if err := queries.DeleteRolePermissions(ctx, id); err != nil {
+			return err
+		}
+		return addRolePermissions(ctx, queries, id, params.Permissions)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.applyCustomRoles(ctx)
+	return nil
+}
+
+// DeleteCustomRole holds the row of the role while counting its users, users
+// are given custom roles while holding it too, see users.withRole
+func (s *realAuthService) DeleteCustomRole(ctx context.Context, id string) error {
+	if err := s.validateCustomRoles(ctx, id, nil); err != nil {
+		return err
+	}
+
+	err := s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		if _, err := queries.LockRole(ctx, id); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.ErrorNotFound
+			}
+			return err
+		}
+
+		users, err := queries.CountRoleUsers(ctx, id)
+		if err != nil {
+			return err
+		}
+		if users > 0 {
+			return errors.NewError(fmt.Sprintf("role %s is given to %d users, give them another role first", id, users), http.StatusConflict)
+		}
+
+		if err := queries.DeleteRolePermissions(ctx, id); err != nil {
+			return err
+		}
+
+		_, err = queries.DeleteRole(ctx, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.applyCustomRoles(ctx)
+	return nil
+}
+
+// applyCustomRoles reloads the policy right away instead of waiting for the
+// next check. The change is already saved, so failing here is only logged
+func (s *realAuthService) applyCustomRoles(ctx context.Context) {
+	if err := s.reloadPolicy(ctx, false); err != nil {
+		log.Printf("[Auth] Failed to apply the custom roles: %s\n", err.Error())
+	}
+}
+
+// validateCustomRoles checks the policy the custom roles would make once role
+// id is replaced by params, or deleted if params is nil
+func (s *realAuthService) validateCustomRoles(ctx context.Context, id string, params *RoleParams) error {
+	base := basePolicy.Load()
+	if _, ok := base.Roles[id]; ok || id == RoleSystem {
+		return errors.NewError(fmt.Sprintf("role %s is defined by the policy, it can't be changed", id), http.StatusConflict)
+	}
+
+	roles, err := loadCustomRoles(ctx, s.storageService)
+	if err != nil {
+		return err
+	}
+
+	delete(roles, id)
+	if params != nil {
+		role, err := compileCustomRole(params.Name, params.Color, params.Parents, params.Permissions)
+		if err != nil {
+			return errors.NewError(fmt.Sprintf("role %s: %s", id, err.Error()), http.StatusBadRequest)
+		}
+		roles[id] = role
+	}
+
+	merged, err := mergeCustomRoles(base, roles)
+	if err != nil {
+		return errors.NewError(err.Error(), http.StatusConflict)
+	}
+
+	if err := merged.Validate(); err != nil {
+		return errors.NewError(err.Error(), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// customRolesVersion changes whenever a custom role is created, updated or
+// deleted, permissions are only changed along with their role
+func (s *realAuthService) customRolesVersion(ctx context.Context) (string, error) {
+	roles, err := s.storageService.ListRoles(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var updatedAt time.Time
+	for _, role := range roles {
+		if role.UpdatedAt.After(updatedAt) {
+			updatedAt = role.UpdatedAt
+		}
+	}
+	return fmt.Sprintf("%d/%d", len(roles), updatedAt.UnixNano()), nil
+}
+
+func loadCustomRoles(ctx context.Context, queries repository.Querier) (map[string]*config.Role, error) {
+	roles, err := queries.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := queries.ListRolePermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := map[string]*config.Role{}
+	for _, role := range roles {
+		compiled[role.ID], err = compileCustomRole(role.Name, role.Color, role.Parents, groupRolePermissions(role.ID, permissions))
+		if err != nil {
+			return nil, fmt.Errorf("custom role %s: %w", role.ID, err)
+		}
+	}
+
+	return compiled, nil
+}
+
+func groupRolePermissions(role string, permissions []*repository.RolePermission) map[string][]*RolePermissionParams {
+	grouped := map[string][]*RolePermissionParams{}
+	for _, permission := range permissions {
+		if permission.Role == role {
+			grouped[permission.Resource] = append(grouped[permission.Resource], &RolePermissionParams{
+				Action:     permission.Action,
+				Preset:     permission.Preset,
+				Conditions: permission.Conditions,
+			})
+		}
+	}
+	return grouped
+}
+
+// compileCustomRole reads the permissions like the ones of a policy file, with
+// named conditions only
+func compileCustomRole(name, color string, parents []string, permissions map[string][]*RolePermissionParams) (*config.Role, error) {
+	role := &config.Role{
+		Name:        name,
+		Color:       color,
+		Permissions: map[string][]*config.Permission{},
+		Parents:     parents,
+		Custom:      true,
+	}
+
+	for _, resource := range slices.Sorted(maps.Keys(permissions)) {
+		for i, params := range permissions[resource] {
+			if params == nil {
+				return nil, fmt.Errorf("permission %d on %s is empty", i, resource)
+			}
+
+			permission := &policyFilePermission{Action: params.Action, Preset: params.Preset}
+			for _, condition := range params.Conditions {
+				permission.Conditions = append(permission.Conditions, &policyFileCondition{Name: condition})
+			}
+
+			compiled, err := permission.compile()
+			if err != nil {
+				return nil, fmt.Errorf("permission %d on %s: %w", i, resource, err)
+			}
+			role.Permissions[resource] = append(role.Permissions[resource], compiled)
+		}
+	}
+
+	return role, nil
+}
+
+// mergeCustomRoles adds the custom roles to the roles of base, which stays
+// untouched. The presets are shared
+func mergeCustomRoles(base *config.PolicyConfiguration, roles map[string]*config.Role) (*config.PolicyConfiguration, error) {
+	merged := &config.PolicyConfiguration{
+		Presets: base.Presets,
+		Roles:   map[string]*config.Role{},
+	}
+	maps.Copy(merged.Roles, base.Roles)
+
+	for _, id := range slices.Sorted(maps.Keys(roles)) {
+		if _, ok := merged.Roles[id]; ok || id == RoleSystem {
+			return nil, fmt.Errorf("custom role %s is also defined by the policy", id)
+		}
+		merged.Roles[id] = roles[id]
+	}
+
+	return merged, nil
+}
+
+func addRolePermissions(ctx context.Context, queries repository.Querier, role string, permissions map[string][]*RolePermissionParams) error {
+	for _, resource := range slices.Sorted(maps.Keys(permissions)) {
+		for _, permission := range permissions[resource] {
+			err := queries.AddRolePermission(ctx, repository.AddRolePermissionParams{
+				Role:       role,
+				Resource:   resource,
+				Action:     permission.Action,
+				Preset:     permission.Preset,
+				Conditions: orEmpty(permission.Conditions),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// the array columns are not nullable
+func orEmpty(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
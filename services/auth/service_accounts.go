@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/services/users"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+)
+
+const (
+	clientIdPrefix     = "svc_"
+	clientSecretPrefix = "svcs_"
+	serviceTokenExpiry = time.Minute * 15
+
+	GrantClientCredentials = "client_credentials"
+)
+
+// OAuthError is an error response of the token endpoint, as described in
+// RFC 6749 section 5.2
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	status      int
+}
+
+func (e *OAuthError) Error() string { return e.Description }
+func (e *OAuthError) Status() int   { return e.status }
+
+func NewOAuthError(code, description string, status int) *OAuthError {
+	return &OAuthError{code, description, status}
+}
+
+var (
+	errorInvalidClient       = NewOAuthError("invalid_client", "the client credentials are invalid", http.StatusUnauthorized)
+	errorServiceAccountLogin = errors.NewError("service accounts can't log in, use the client credentials grant", http.StatusForbidden)
+)
+
+// TokenResponse is a successful response of the token endpoint
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type CreatedServiceCredential struct {
+	ClientSecret string `json:"clientSecret"` // only returned when the credential is created
+	*repository.ServiceCredential
+}
+
+func (s *realAuthService) CreateServiceCredential(ctx context.Context, user *repository.User) (*CreatedServiceCredential, error) {
+	if user.Kind != users.KindService {
+		return nil, errors.NewError(fmt.Sprintf("%s is not a service account", user.Username), http.StatusBadRequest)
+	}
+
+	secret := clientSecretPrefix + utils.GenerateSecureToken(32)
+	credential, err := s.storageService.AddServiceCredential(ctx, repository.AddServiceCredentialParams{
+		UserId:     user.ID,
+		ClientId:   clientIdPrefix + utils.GenerateSecureToken(16),
+		SecretHash: hashToken(secret),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreatedServiceCredential{secret, credential}, nil
+}
+
+func (s *realAuthService) GetServiceCredentials(ctx context.Context, userId int32) ([]*repository.ServiceCredential, error) {
+	return s.storageService.ListServiceCredentials(ctx, userId)
+}
+
+func (s *realAuthService) DeleteServiceCredential(ctx context.Context, userId, id int32) error {
+	deleted, err := s.storageService.DeleteServiceCredential(ctx, userId, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.ErrorNotFound
+	}
+	return nil
+}
+
+// clientCredentialsGrant issues an access token to a service account. The
+// token can be limited to some scopes, written like the ones of personal
+// access tokens and separated by spaces
+func (s *realAuthService) clientCredentialsGrant(ctx context.Context, clientId, clientSecret, scope string) (*TokenResponse, error) {
+	if clientId == "" || clientSecret == "" {
+		return nil, errorInvalidClient
+	}
+
+	credential, err := s.storageService.GetServiceCredential(ctx, clientId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errorInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(clientSecret)), []byte(credential.SecretHash)) != 1 {
+		return nil, errorInvalidClient
+	}
+
+	user, err := s.userService.GetUserById(ctx, credential.UserId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errorInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Kind != users.KindService {
+		return nil, errorInvalidClient
+	}
+
+	scopes := strings.Fields(scope)
+	for _, scope := range scopes {
+		resourceName, action, ok := strings.Cut(scope, ":")
+		if !ok || !roleHasAction(user.Role, resourceName, action, []string{}) {
+			return nil, NewOAuthError("invalid_scope", fmt.Sprintf("scope %s is not allowed for role %s", scope, user.Role), http.StatusBadRequest)
+		}
+	}
+
+	if err := s.storageService.TouchServiceCredential(ctx, credential.ID); err != nil {
+		return nil, err
+	}
+
+	claims := s.generateAccessToken(user, nil, 0, time.Now().Add(serviceTokenExpiry)).(JwtClaims)
+	claims.Scope = strings.Join(scopes, " ")
+
+	accessToken, err := s.signToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(serviceTokenExpiry.Seconds()),
+		Scope:       claims.Scope,
+	}, nil
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+	"golang.org/x/oauth2"
+)
+
+const (
+	stateKey    = "oauth_state" // binds the state to the browser that started the flow
+	stateExpiry = time.Minute * 10
+)
+
+var errorInvalidState = errors.NewError("the OAuth state is invalid, expired or has already been used", http.StatusBadRequest)
+
+// OAuthFlow is what has to be carried from the login redirect to the callback
+type OAuthFlow struct {
+	State      string // sent to the provider and returned to the callback
+	Nonce      string // single use, also sent as the OIDC nonce
+	Verifier   string // PKCE code_verifier, never leaves the server
+	RedirectTo string
+	LinkUserId int32 // set when an identity is being linked to an existing user
+}
+
+// the nonce is stored in the ID claim, consuming it makes the state single use
+type stateClaims struct {
+	Provider   string `json:"provider"`
+	RedirectTo string `json:"redirectTo"`
+	LinkUserId int32  `json:"linkUserId,omitempty"`
+	Binding    string `json:"binding"` // hash of the value of the state cookie
+	jwt.RegisteredClaims
+}
+
+func (s *realAuthService) CreateOAuthState(ctx context.Context, w http.ResponseWriter, provider, redirectTo string, linkUserId int32) (*OAuthFlow, error) {
+	flow := &OAuthFlow{
+		Nonce:      utils.GenerateSecureToken(32),
+		Verifier:   oauth2.GenerateVerifier(),
+		RedirectTo: redirectTo,
+		LinkUserId: linkUserId,
+	}
+	binding := utils.GenerateSecureToken(32)
+	expiresAt := time.Now().Add(stateExpiry)
+
+	// states of flows that were never finished are dropped here
+	if err := s.storageService.DeleteExpiredOAuthStates(ctx); err != nil {
+		return nil, err
+	}
+
+	params := repository.AddOAuthStateParams{
+		Nonce:     flow.Nonce,
+		Verifier:  flow.Verifier,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.storageService.AddOAuthState(ctx, params); err != nil {
+		return nil, err
+	}
+
+	token := jwt.NewWithClaims(config.JWTSigningMethod, stateClaims{
+		Provider:   provider,
+		RedirectTo: redirectTo,
+		LinkUserId: linkUserId,
+		Binding:    hashStateBinding(binding),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        flow.Nonce,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+
+	var err error
+	flow.State, err = token.SignedString(stateSigningKey())
+	if err != nil {
+		return nil, err
+	}
+
+	// Lax so that the cookie is sent back when the provider redirects to the callback
+	w.Header().Add("Set-Cookie", utils.GenerateSetCookie(stateKey, binding, config.Envs.Domain, "/auth", "Lax", stateExpiry))
+	return flow, nil
+}
+
+// ConsumeOAuthState verifies the state returned to the callback and returns
+// the flow it was created for
+func (s *realAuthService) ConsumeOAuthState(w http.ResponseWriter, r *http.Request, provider string) (*OAuthFlow, error) {
+	cookies := utils.GetCookiesFromStr(r.Header.Get("Cookie"))
+	w.Header().Add("Set-Cookie", utils.GenerateClearCookie(stateKey, config.Envs.Domain, "/auth"))
+
+	state := r.URL.Query().Get("state")
+	claims := &stateClaims{}
+	_, err := jwt.ParseWithClaims(state, claims, func(t *jwt.Token) (any, error) {
+		return stateSigningKey(), nil
+	}, jwt.WithValidMethods([]string{config.JWTSigningMethod.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, errorInvalidState
+	}
+
+	if claims.Provider != provider || claims.ID == "" {
+		return nil, errorInvalidState
+	}
+
+	binding := hashStateBinding(cookies[stateKey])
+	if cookies[stateKey] == "" || subtle.ConstantTimeCompare([]byte(binding), []byte(claims.Binding)) != 1 {
+		return nil, errorInvalidState
+	}
+
+	verifier, err := s.storageService.ConsumeOAuthState(r.Context(), claims.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errorInvalidState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuthFlow{
+		State:      state,
+		Nonce:      claims.ID,
+		Verifier:   verifier,
+		RedirectTo: claims.RedirectTo,
+		LinkUserId: claims.LinkUserId,
+	}, nil
+}
+
+func hashStateBinding(binding string) string {
+	hash := sha256.Sum256([]byte(binding))
+	return base64.URLEncoding.EncodeToString(hash[:])
+}
+
+// states are signed with a key derived from the JWT secret so that they can
+// never be mistaken for access tokens
+func stateSigningKey() []byte {
+	mac := hmac.New(sha256.New, config.Envs.JWTSigningSecret)
+	mac.Write([]byte("oauth_state"))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+)
+
+const (
+	tokenPrefix    = "pat_"
+	maxTokenExpiry = time.Hour * 24 * 365 // one year
+)
+
+// scopes are written resource:action, an action of * allows every action on
+// the resource. A token can never do more than the role of its owner, nor
+// than the token it was created with
+type CreateTokenParams struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type CreatedToken struct {
+	Token string `json:"token"` // only returned when the token is created
+	*repository.UserToken
+}
+
+func (s *realAuthService) CreateUserToken(ctx context.Context, user *repository.User, params CreateTokenParams) (*CreatedToken, error) {
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > 255 {
+		return nil, errors.NewError("the token name must be between 1 and 255 characters", http.StatusBadRequest)
+	}
+
+	if len(params.Scopes) == 0 {
+		return nil, errors.NewError("a token needs at least one scope", http.StatusBadRequest)
+	}
+
+	for _, scope := range params.Scopes {
+		resourceName, action, ok := strings.Cut(scope, ":")
+		if !ok || resourceName == "" || action == "" {
+			return nil, errors.NewError(fmt.Sprintf("scope %s is not of the form resource:action", scope), http.StatusBadRequest)
+		}
+
+		if !roleHasAction(user.Role, resourceName, action, []string{}) {
+			return nil, errors.NewError(fmt.Sprintf("scope %s is not allowed for role %s", scope, user.Role), http.StatusForbidden)
+		}
+
+		// a token can't create another one that can do more than itself
+		if scopes, ok := tokenScopes(ctx); ok && !scopesAllow(scopes, resourceName, action) {
+			return nil, errors.NewError(fmt.Sprintf("scope %s is not allowed for the token creating it", scope), http.StatusForbidden)
+		}
+	}
+
+	if !params.ExpiresAt.After(time.Now()) || params.ExpiresAt.After(time.Now().Add(maxTokenExpiry)) {
+		return nil, errors.NewError("the token must expire in the future and within a year", http.StatusBadRequest)
+	}
+
+	token := tokenPrefix + utils.GenerateSecureToken(32)
+	userToken, err := s.storageService.AddUserToken(ctx, repository.AddUserTokenParams{
+		UserId:    user.ID,
+		Name:      params.Name,
+		TokenHash: hashToken(token),
+		Scopes:    params.Scopes,
+		ExpiresAt: params.ExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreatedToken{token, userToken}, nil
+}
+
+func (s *realAuthService) GetUserTokens(ctx context.Context, userId int32) ([]*repository.UserToken, error) {
+	return s.storageService.ListUserTokens(ctx, userId)
+}
+
+func (s *realAuthService) DeleteUserToken(ctx context.Context, userId, id int32) error {
+	deleted, err := s.storageService.DeleteUserToken(ctx, userId, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.ErrorNotFound
+	}
+	return nil
+}
+
+// returns the owner of the token and the scopes the request is limited to
+func (s *realAuthService) authenticateUserToken(ctx context.Context, token string) (*repository.User, []string, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return nil, nil, errors.ErrorNotAuthenticated
+	}
+
+	userToken, err := s.storageService.GetUserTokenByHash(ctx, hashToken(token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, errors.ErrorNotAuthenticated
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if time.Now().After(userToken.ExpiresAt) {
+		return nil, nil, errors.ErrorNotAuthenticated
+	}
+
+	user, err := s.userService.GetUserById(ctx, userToken.UserId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, errors.ErrorNotAuthenticated
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.storageService.TouchUserToken(ctx, userToken.ID); err != nil {
+		return nil, nil, err
+	}
+
+	return user, userToken.Scopes, nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return base64.URLEncoding.EncodeToString(hash[:])
+}
+
+// returns the scopes the request is limited to, if it was made with a token
+func tokenScopes(ctx context.Context) ([]string, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	scopes, ok := ctx.Value(config.TokenScopesContextKey).([]string)
+	return scopes, ok
+}
+
+func scopesAllow(scopes []string, resourceName, action string) bool {
+	return slices.Contains(scopes, resourceName+":"+action) || slices.Contains(scopes, resourceName+":*")
+}
+
+// conditions are ignored here, they are still checked when the token is used
+func roleHasAction(roleName, resourceName, action string, checkedRoles []string) bool {
+	if roleName == RoleSystem {
+		return true
+	}
+
+	current := policy.Load()
+	role, ok := current.Roles[roleName]
+	if !ok || slices.Contains(checkedRoles, roleName) {
+		return false
+	}
+
+	for _, permission := range role.Permissions[resourceName] {
+		permissionAction := permission.Action
+		if permission.Preset != "" {
+			preset, ok := current.ResolvedPresets[permission.Preset]
+			if !ok {
+				continue
+			}
+			permissionAction = preset.Action
+		}
+
+		if action == "*" || permissionAction == action {
+			return true
+		}
+	}
+
+	checkedRoles = append(checkedRoles, roleName)
+	for _, parent := range role.Parents {
+		if roleHasAction(parent, resourceName, action, checkedRoles) {
+			return true
+		}
+	}
+
+	return false
+}
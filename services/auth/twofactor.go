@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	pendingKey           = "pending_2fa"
+	pendingExpiry        = time.Minute * 5
+	maxTwoFactorAttempts = 5
+	maxTwoFactorFailures = 10 // across pending logins, before the user is locked out
+	twoFactorLockout     = time.Minute * 15
+	recoveryCodeCount    = 10
+	totpPeriod           = 30 // seconds
+)
+
+var (
+	errorInvalidTwoFactorCode = errors.NewError("the two factor code is invalid", http.StatusUnauthorized)
+	errorTooManyAttempts      = errors.NewError("too many invalid codes, please sign in again", http.StatusTooManyRequests)
+	errorTwoFactorLocked      = errors.NewError("too many invalid codes, please try again later", http.StatusTooManyRequests)
+)
+
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`    // otpauth:// URI, the payload of the QR code
+	QRCode string `json:"qrCode"` // the QR code as a PNG data URI
+}
+
+// either a code from the authenticator app or one of the recovery codes
+type TwoFactorCode struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+func (s *realAuthService) GetTwoFactor(ctx context.Context, userId int32) (*TwoFactorStatus, error) {
+	userTotp, err := s.storageService.GetUserTotp(ctx, userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &TwoFactorStatus{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorStatus{userTotp.Enabled, len(userTotp.RecoveryCodes)}, nil
+}
+
+// EnrollTwoFactor generates a new secret, two factor authentication is only
+// enabled once a first code is verified with VerifyTwoFactor
+func (s *realAuthService) EnrollTwoFactor(ctx context.Context, user *repository.User) (*TwoFactorEnrollment, error) {
+	userTotp, err := s.storageService.GetUserTotp(ctx, user.ID)
+	if err == nil && userTotp.Enabled {
+		return nil, errors.NewError("two factor authentication is already enabled", http.StatusConflict)
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      config.Envs.Domain,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.EncryptSecret(key.Secret())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storageService.SetUserTotp(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	image, err := key.Image(256, 256)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.Buffer{}
+	if err := png.Encode(&buffer, image); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{
+		Secret: key.Secret(),
+		URI:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()),
+	}, nil
+}
+
+// VerifyTwoFactor enables two factor authentication and returns the recovery
+// codes. They are only stored hashed, so this is the only time they are shown
+func (s *realAuthService) VerifyTwoFactor(ctx context.Context, userId int32, code string) ([]string, error) {
+	userTotp, err := s.storageService.GetUserTotp(ctx, userId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errors.NewError("two factor authentication is not being set up", http.StatusBadRequest)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if userTotp.Enabled {
+		return nil, errors.NewError("two factor authentication is already enabled", http.StatusConflict)
+	}
+
+	if err := s.validateTotp(ctx, userTotp, code); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code := strings.ToLower(rand.Text())
+		codes[i] = code[:5] + "-" + code[5:10]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	if err := s.storageService.EnableUserTotp(ctx, userId, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor checks code first when it is set, it is only left out by
+// admins resetting the two factor authentication of another user
+func (s *realAuthService) DisableTwoFactor(ctx context.Context, userId int32, code *TwoFactorCode) error {
+	if code != nil {
+		userTotp, err := s.storageService.GetUserTotp(ctx, userId)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// an enrollment that was never verified can be dropped without a code
+		if userTotp.Enabled {
+			if err := s.checkTwoFactorCode(ctx, userTotp, *code); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		if err := queries.DeleteUserPendingLogins(ctx, userId); err != nil {
+			return err
+		}
+		return queries.DeleteUserTotp(ctx, userId)
+	})
+}
+
+// RequireTwoFactor starts a pending login if the user has two factor
+// authentication enabled. The login is then finished by CompleteTwoFactor
+func (s *realAuthService) RequireTwoFactor(ctx context.Context, w http.ResponseWriter, user *repository.User, redirectTo string) (bool, error) {
+	userTotp, err := s.storageService.GetUserTotp(ctx, user.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !userTotp.Enabled {
+		return false, nil
+	}
+
+	// pending logins that were never finished are dropped here
+	if err := s.storageService.DeleteExpiredPendingLogins(ctx); err != nil {
+		return false, err
+	}
+
+	token := utils.GenerateSecureToken(32)
+	params := repository.AddPendingLoginParams{
+		TokenHash:  hashToken(token),
+		UserId:     user.ID,
+		RedirectTo: redirectTo,
+		ExpiresAt:  time.Now().Add(pendingExpiry),
+	}
+	if err := s.storageService.AddPendingLogin(ctx, params); err != nil {
+		return false, err
+	}
+
+	w.Header().Add("Set-Cookie", utils.GenerateSetCookie(pendingKey, token, config.Envs.Domain, "/auth", "Strict", pendingExpiry))
+	return true, nil
+}
+
+// CompleteTwoFactor checks the code of a pending login and finishes it,
+// returning where the user wanted to be redirected
+func (s *realAuthService) CompleteTwoFactor(w http.ResponseWriter, r *http.Request, code TwoFactorCode) (string, error) {
+	cookies := utils.GetCookiesFromStr(r.Header.Get("Cookie"))
+	if cookies[pendingKey] == "" {
+		return "", errors.ErrorNotAuthenticated
+	}
+	hash := hashToken(cookies[pendingKey])
+
+	pending, err := s.storageService.AttemptPendingLogin(r.Context(), hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errors.ErrorNotAuthenticated
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if pending.Attempts > maxTwoFactorAttempts {
+		w.Header().Add("Set-Cookie", utils.GenerateClearCookie(pendingKey, config.Envs.Domain, "/auth"))
+		if err := s.storageService.DeletePendingLogin(r.Context(), hash); err != nil {
+			return "", err
+		}
+		return "", errorTooManyAttempts
+	}
+
+	userTotp, err := s.storageService.GetUserTotp(r.Context(), pending.UserId)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.checkTwoFactorCode(r.Context(), userTotp, code); err != nil {
+		return "", err
+	}
+
+	w.Header().Add("Set-Cookie", utils.GenerateClearCookie(pendingKey, config.Envs.Domain, "/auth"))
+	if err := s.storageService.DeletePendingLogin(r.Context(), hash); err != nil {
+		return "", err
+	}
+
+	user, err := s.userService.GetUserById(r.Context(), pending.UserId)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.FinishAuth(user, r, w); err != nil {
+		return "", err
+	}
+	return pending.RedirectTo, nil
+}
+
+// checkTwoFactorCode checks a code from the authenticator app or a recovery
+// code. Failures are counted on the user rather than the pending login, so
+// starting new logins gives no more guesses: after maxTwoFactorFailures the
+// user is locked out for twoFactorLockout
+func (s *realAuthService) checkTwoFactorCode(ctx context.Context, userTotp *repository.UserTotp, code TwoFactorCode) error {
+	if userTotp.LockedUntil.After(time.Now()) {
+		return errorTwoFactorLocked
+	}
+
+	var err error
+	if code.RecoveryCode != "" {
+		var used int64
+		used, err = s.storageService.UseRecoveryCode(ctx, hashRecoveryCode(code.RecoveryCode), userTotp.UserId)
+		if err == nil && used == 0 {
+			err = errorInvalidTwoFactorCode
+		}
+	} else {
+		err = s.validateTotp(ctx, userTotp, code.Code)
+	}
+
+	if errors.Is(err, errorInvalidTwoFactorCode) {
+		failErr := s.storageService.FailUserTotp(ctx, repository.FailUserTotpParams{
+			MaxFailures: maxTwoFactorFailures,
+			LockedUntil: time.Now().Add(twoFactorLockout),
+			UserId:      userTotp.UserId,
+		})
+		if failErr != nil {
+			return failErr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if userTotp.FailedAttempts == 0 {
+		return nil
+	}
+	return s.storageService.ResetUserTotpFailures(ctx, userTotp.UserId)
+}
+
+// codes are accepted one period before and after the current one, a code
+// can't be used twice
+func (s *realAuthService) validateTotp(ctx context.Context, userTotp *repository.UserTotp, code string) error {
+	secret, err := utils.DecryptSecret(userTotp.Secret)
+	if err != nil {
+		return err
+	}
+
+	code = strings.TrimSpace(code)
+	now := time.Now()
+	for skew := -1; skew <= 1; skew++ {
+		at := now.Add(time.Duration(skew*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, at, totp.ValidateOpts{
+			Period:    totpPeriod,
+			Digits:    otp.DigitsSix,
+			Algorithm: otp.AlgorithmSHA1,
+		})
+		if err != nil {
+			return err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) != 1 {
+			continue
+		}
+
+		used, err := s.storageService.UseTotpCounter(ctx, userTotp.UserId, at.Unix()/totpPeriod)
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return errorInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	return errorInvalidTwoFactorCode
+}
+
+func hashRecoveryCode(code string) string {
+	return hashToken(strings.ToLower(strings.TrimSpace(code)))
+}
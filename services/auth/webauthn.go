@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+)
+
+const (
+	webauthnKey    = "webauthn_session" // binds a ceremony to the browser that started it
+	webauthnExpiry = time.Minute * 5
+)
+
+var errorInvalidPasskeySession = errors.NewError("the passkey ceremony is invalid, expired or has already been finished", http.StatusBadRequest)
+
+// webauthnUser is a user as seen by go-webauthn, the user handle being its ID
+type webauthnUser struct {
+	user        *repository.User
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte                         { return userHandle(u.user.ID) }
+func (u *webauthnUser) WebAuthnName() string                       { return u.user.Username }
+func (u *webauthnUser) WebAuthnDisplayName() string                { return u.user.Name }
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+func newWebauthn() *webauthn.WebAuthn {
+	instance, err := webauthn.New(&webauthn.Config{
+		RPID:          config.Envs.WebauthnRPID,
+		RPDisplayName: config.Envs.WebauthnRPName,
+		RPOrigins:     config.Envs.WebauthnOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: webauthnExpiry},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: webauthnExpiry},
+		},
+	})
+	if err != nil {
+		log.Fatalf("[Auth] Failed to configure passkeys: %s", err.Error())
+	}
+	return instance
+}
+
+func (s *realAuthService) BeginPasskeyRegistration(ctx context.Context, w http.ResponseWriter, user *repository.User) (*protocol.CredentialCreation, error) {
+	wUser, err := s.loadWebauthnUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := s.webauthn.BeginRegistration(wUser,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(wUser.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.saveWebauthnSession(ctx, w, session); err != nil {
+		return nil, err
+	}
+	return creation, nil
+}
+
+func (s *realAuthService) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request, user *repository.User, name string) (*repository.WebauthnCredential, error) {
+	session, err := s.consumeWebauthnSession(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	wUser, err := s.loadWebauthnUser(r.Context(), user)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webauthn.FinishRegistration(wUser, *session, r)
+	if err != nil {
+		return nil, errors.NewError(fmt.Sprintf("the passkey could not be registered: %s", err.Error()), http.StatusBadRequest)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 {
+		name = "Passkey"
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, transport := range credential.Transport {
+		transports[i] = string(transport)
+	}
+
+	return s.storageService.AddWebauthnCredential(r.Context(), repository.AddWebauthnCredentialParams{
+		UserId:          user.ID,
+		Name:            name,
+		CredentialId:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		Aaguid:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	})
+}
+
+// BeginPasskeyLogin starts a discoverable login, the user is only known from
+// the passkey the browser picks
+func (s *realAuthService) BeginPasskeyLogin(ctx context.Context, w http.ResponseWriter) (*protocol.CredentialAssertion, error) {
+	assertion, session, err := s.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.saveWebauthnSession(ctx, w, session); err != nil {
+		return nil, err
+	}
+	return assertion, nil
+}
+
+// FinishPasskeyLogin verifies the assertion and signs the user in. Passkeys
+// require user verification, so no second factor is asked for
+func (s *realAuthService) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) error {
+	session, err := s.consumeWebauthnSession(w, r)
+	if err != nil {
+		return err
+	}
+
+	wUser, credential, err := s.webauthn.FinishPasskeyLogin(func(rawID, handle []byte) (webauthn.User, error) {
+		id, err := strconv.ParseInt(string(handle), 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		user, err := s.userService.GetUserById(r.Context(), int32(id))
+		if err != nil {
+			return nil, err
+		}
+		return s.loadWebauthnUser(r.Context(), user)
+	}, *session, r)
+	if err != nil {
+		return errors.NewError(fmt.Sprintf("the passkey could not be verified: %s", err.Error()), http.StatusUnauthorized)
+	}
+
+	// the sign count did not increase, the authenticator may have been cloned
+	if credential.Authenticator.CloneWarning {
+		return errors.NewError("the passkey sign count is invalid, the authenticator may have been cloned", http.StatusUnauthorized)
+	}
+
+	if err := s.storageService.UpdateWebauthnCredential(r.Context(), repository.UpdateWebauthnCredentialParams{
+		CredentialId: credential.ID,
+		SignCount:    int64(credential.Authenticator.SignCount),
+		BackupState:  credential.Flags.BackupState,
+	}); err != nil {
+		return err
+	}
+
+	return s.FinishAuth(wUser.(*webauthnUser).user, r, w)
+}
+
+func (s *realAuthService) GetPasskeys(ctx context.Context, userId int32) ([]*repository.WebauthnCredential, error) {
+	return s.storageService.ListWebauthnCredentials(ctx, userId)
+}
+
+func (s *realAuthService) DeletePasskey(ctx context.Context, userId, id int32) error {
+	deleted, err := s.storageService.DeleteWebauthnCredential(ctx, userId, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.ErrorNotFound
+	}
+	return nil
+}
+
+func (s *realAuthService) loadWebauthnUser(ctx context.Context, user *repository.User) (*webauthnUser, error) {
+	stored, err := s.storageService.ListWebauthnCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, len(stored))
+	for i, credential := range stored {
+		transports := make([]protocol.AuthenticatorTransport, len(credential.Transports))
+		for j, transport := range credential.Transports {
+			transports[j] = protocol.AuthenticatorTransport(transport)
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              credential.CredentialId,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    true,
+				UserVerified:   true,
+				BackupEligible: credential.BackupEligible,
+				BackupState:    credential.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    credential.Aaguid,
+				SignCount: uint32(credential.SignCount),
+			},
+		}
+	}
+
+	return &webauthnUser{user, credentials}, nil
+}
+
+func (s *realAuthService) saveWebauthnSession(ctx context.Context, w http.ResponseWriter, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	// ceremonies that were never finished are dropped here
+	if err := s.storageService.DeleteExpiredWebauthnSessions(ctx); err != nil {
+		return err
+	}
+
+	token := utils.GenerateSecureToken(32)
+	params := repository.AddWebauthnSessionParams{
+		TokenHash: hashToken(token),
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(webauthnExpiry),
+	}
+	if err := s.storageService.AddWebauthnSession(ctx, params); err != nil {
+		return err
+	}
+
+	w.Header().Add("Set-Cookie", utils.GenerateSetCookie(webauthnKey, token, config.Envs.Domain, "/auth/webauthn", "Strict", webauthnExpiry))
+	return nil
+}
+
+// sessions are single use, they are deleted as soon as they are read
+func (s *realAuthService) consumeWebauthnSession(w http.ResponseWriter, r *http.Request) (*webauthn.SessionData, error) {
+	cookies := utils.GetCookiesFromStr(r.Header.Get("Cookie"))
+	w.Header().Add("Set-Cookie", utils.GenerateClearCookie(webauthnKey, config.Envs.Domain, "/auth/webauthn"))
+
+	if cookies[webauthnKey] == "" {
+		return nil, errorInvalidPasskeySession
+	}
+
+	data, err := s.storageService.ConsumeWebauthnSession(r.Context(), hashToken(cookies[webauthnKey]))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errorInvalidPasskeySession
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &webauthn.SessionData{}
+	if err := json.Unmarshal([]byte(data), session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func userHandle(id int32) []byte {
+	return []byte(strconv.Itoa(int(id)))
+}
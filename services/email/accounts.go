@@ -2,11 +2,20 @@ package email
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
 
 	"github.com/emersion/go-imap/v2/imapclient"
 	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/services/storage"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
 )
 
+const shareInviteExpiry = time.Hour * 24 * 7 // 7 days
+
 type Mailbox struct {
 	Name        string `json:"name"`
 	NumMessages int    `json:"num_messages"`
@@ -15,8 +24,14 @@ type Mailbox struct {
 
 type AccountInfo struct {
 	*repository.MailAccount
-	Mailboxes []Mailbox `json:"mailboxes"`
-	Shares    []string  `json:"shares"`
+	Mailboxes     []Mailbox `json:"mailboxes"`
+	Shares        []string  `json:"shares"`
+	PendingShares []string  `json:"pending_shares"`
+}
+
+type InvitationAnswer struct {
+	ID     int32 `json:"id"`
+	Accept bool  `json:"accept"` // declines the invitation if false
 }
 
 func (s *realEmailService) GetAccountByEmail(ctx context.Context, email string) (*repository.MailAccount, error) {
@@ -32,22 +47,34 @@ func (s *realEmailService) CountAccounts(ctx context.Context, userId int32) (int
 }
 
 func (s *realEmailService) AddAccount(ctx context.Context, params repository.AddEmailAccountParams) (int32, error) {
+	password, err := utils.EncryptSecret(params.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	params.Password = password
 	return s.storageService.AddEmailAccount(ctx, params)
 }
 
 func (s *realEmailService) RemoveAccount(ctx context.Context, accountId int32) error {
-	// TODO: remove the shares as well
-	return s.storageService.DeleteMailAccount(ctx, accountId)
+	return s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		return storage.RemoveMailAccount(ctx, queries, accountId)
+	})
 }
 
 func (s *realEmailService) GetAccountInfo(ctx context.Context, account *repository.MailAccount) (AccountInfo, error) {
+	password, err := utils.DecryptSecret(account.Password)
+	if err != nil {
+		return AccountInfo{}, err
+	}
+
 	client, err := imapclient.DialTLS(s.imapAddr, nil)
 	if err != nil {
 		return AccountInfo{}, err
 	}
 	defer client.Logout()
 
-	if err := client.Login(account.Username, account.Password).Wait(); err != nil {
+	if err := client.Login(account.Username, password).Wait(); err != nil {
 		return AccountInfo{}, nil
 	}
 
@@ -85,17 +112,105 @@ func (s *realEmailService) GetAccountInfo(ctx context.Context, account *reposito
 		accountInfo.Shares = append(accountInfo.Shares, user.Username)
 	}
 
+	// get pending invitations
+	invites, err := s.storageService.ListAccountShareInvites(ctx, account.ID)
+	if err != nil {
+		return AccountInfo{}, err
+	}
+
+	for _, invite := range invites {
+		user, err := s.storageService.GetUserById(ctx, invite)
+		if err != nil {
+			return AccountInfo{}, err
+		}
+		accountInfo.PendingShares = append(accountInfo.PendingShares, user.Username)
+	}
+
 	return accountInfo, nil
 }
 
-func (s *realEmailService) AddShare(ctx context.Context, params repository.AddShareParams) error {
-	return s.storageService.AddShare(ctx, params)
+// GetAccountShareInfo only resolves the shares of the account, without
+// connecting to the mail server
+func (s *realEmailService) GetAccountShareInfo(ctx context.Context, account *repository.MailAccount) (AccountInfo, error) {
+	accountInfo := AccountInfo{
+		MailAccount: account,
+	}
+
+	shares, err := s.GetAccountShares(ctx, account.ID)
+	if err != nil {
+		return AccountInfo{}, err
+	}
+
+	for _, share := range shares {
+		user, err := s.storageService.GetUserById(ctx, share)
+		if err != nil {
+			return AccountInfo{}, err
+		}
+		accountInfo.Shares = append(accountInfo.Shares, user.Username)
+	}
+
+	return accountInfo, nil
+}
+
+func (s *realEmailService) InviteShare(ctx context.Context, params repository.AddShareInviteParams) error {
+	account, err := s.storageService.GetMailAccountById(ctx, params.Account)
+	if err != nil {
+		return err
+	}
+
+	if account.OwnerId == params.UserId {
+		return errors.NewError("you cannot share an account with its owner", http.StatusBadRequest)
+	}
+
+	shares, err := s.GetAccountShares(ctx, account.ID)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(shares, params.UserId) {
+		return errors.NewError(fmt.Sprintf("account %s is already shared with this user", account.Email), http.StatusConflict)
+	}
+
+	params.ExpiresAt = time.Now().Add(shareInviteExpiry)
+	_, err = s.storageService.AddShareInvite(ctx, params)
+	return err
 }
 
 func (s *realEmailService) RemoveShare(ctx context.Context, userId, accountId int32) error {
+	if err := s.storageService.DeleteShareInvite(ctx, userId, accountId); err != nil {
+		return err
+	}
 	return s.storageService.DeleteShare(ctx, userId, accountId)
 }
 
 func (s *realEmailService) GetAccountShares(ctx context.Context, account int32) ([]int32, error) {
 	return s.storageService.ListAccountShares(ctx, account)
 }
+
+func (s *realEmailService) ListInvitations(ctx context.Context, userId int32) ([]*repository.ListUserShareInvitesRow, error) {
+	return s.storageService.ListUserShareInvites(ctx, userId)
+}
+
+func (s *realEmailService) AcceptInvitation(ctx context.Context, userId, id int32) error {
+	accepted, err := s.storageService.AcceptShareInvite(ctx, id, userId)
+	if err != nil {
+		return err
+	}
+
+	if accepted == 0 {
+		return errors.ErrorNotFound
+	}
+	return nil
+}
+
+func (s *realEmailService) DeclineInvitation(ctx context.Context, userId, id int32) error {
+	declined, err := s.storageService.DeclineShareInvite(ctx, id, userId)
+	if err != nil {
+		return err
+	}
+
+	if declined == 0 {
+		return errors.ErrorNotFound
+	}
+	return nil
+}
@@ -2,11 +2,14 @@ package email
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
+	"log"
 
 	"github.com/piquel-fr/api/config"
 	"github.com/piquel-fr/api/database/repository"
 	"github.com/piquel-fr/api/services/storage"
+	"github.com/smallstep/pkcs7"
 )
 
 type EmailService interface {
@@ -17,22 +20,63 @@ type EmailService interface {
 	AddAccount(ctx context.Context, params repository.AddEmailAccountParams) (int32, error)
 	RemoveAccount(ctx context.Context, accountId int32) error
 	GetAccountInfo(ctx context.Context, account *repository.MailAccount) (AccountInfo, error)
+	GetAccountShareInfo(ctx context.Context, account *repository.MailAccount) (AccountInfo, error)
+
+	// messages
+	FetchMessage(ctx context.Context, account *repository.MailAccount, mailbox string, uid uint32) (*Message, error)
 
 	// sharing
-	AddShare(ctx context.Context, params repository.AddShareParams) error
+	InviteShare(ctx context.Context, params repository.AddShareInviteParams) error
 	RemoveShare(ctx context.Context, userId, accountId int32) error
 	GetAccountShares(ctx context.Context, account int32) ([]int32, error)
+
+	// invitations
+	ListInvitations(ctx context.Context, userId int32) ([]*repository.ListUserShareInvitesRow, error)
+	AcceptInvitation(ctx context.Context, userId, id int32) error
+	DeclineInvitation(ctx context.Context, userId, id int32) error
+
+	// outbox
+	ScheduleMessage(ctx context.Context, account *repository.MailAccount, senderId int32, message OutgoingMessage) (*repository.MailOutbox, error)
+	CancelMessage(ctx context.Context, accountId, id int32) error
+	ListOutbox(ctx context.Context, accountId int32) ([]*repository.MailOutbox, error)
+
+	// pgp
+	SetPgpKey(ctx context.Context, account *repository.MailAccount, upload PgpKeyUpload) (*PgpKey, error)
+	GetPgpKey(ctx context.Context, accountId int32) (*PgpKey, error)
+	RemovePgpKey(ctx context.Context, accountId int32) error
+	TrustPgpKey(ctx context.Context, accountId int32, upload PgpTrustedKeyUpload) (*PgpKey, error)
+	ListTrustedPgpKeys(ctx context.Context, accountId int32) ([]*PgpKey, error)
+	UntrustPgpKey(ctx context.Context, accountId int32, fingerprint string) error
+
+	// smime
+	SetSmimeCert(ctx context.Context, account *repository.MailAccount, upload SmimeCertificateUpload) (*CertificateInfo, error)
+	GetSmimeCert(ctx context.Context, accountId int32) (*CertificateInfo, error)
+	RemoveSmimeCert(ctx context.Context, accountId int32) error
+
+	// notifications sent to users from the system account
+	SendSystemEmail(to, subject, body string) error
 }
 
 type realEmailService struct {
-	imapAddr       string
-	storageService storage.StorageService
+	imapAddr        string
+	smtpAddr        string
+	smimeTrustStore *x509.CertPool
+	storageService  storage.StorageService
 }
 
 func NewRealEmailService(storageService storage.StorageService) *realEmailService {
-	addr := fmt.Sprintf("%s:%s", config.Envs.ImapHost, config.Envs.ImapPort)
+	trustStore, err := loadTrustStore(config.Envs.SmimeTrustStore)
+	if err != nil {
+		log.Fatalf("[Email] Failed to load the S/MIME trust store: %s", err.Error())
+	}
+
+	// the default is DES, which no mail client should accept anymore
+	pkcs7.ContentEncryptionAlgorithm = pkcs7.EncryptionAlgorithmAES256CBC
+
 	return &realEmailService{
-		imapAddr:       addr,
-		storageService: storageService,
+		imapAddr:        fmt.Sprintf("%s:%s", config.Envs.ImapHost, config.Envs.ImapPort),
+		smtpAddr:        fmt.Sprintf("%s:%s", config.Envs.SmtpHost, config.Envs.SmtpPort),
+		smimeTrustStore: trustStore,
+		storageService:  storageService,
 	}
 }
@@ -0,0 +1,462 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgpErrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-message"
+	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+	"github.com/smallstep/pkcs7"
+)
+
+const (
+	SignatureStatusValid      = "valid"
+	SignatureStatusInvalid    = "invalid"
+	SignatureStatusUnknownKey = "unknown_key"
+	SignatureStatusUntrusted  = "untrusted" // correct, but the signer is not trusted by the account
+	SignatureStatusMismatch   = "mismatch"  // correct, but the signer is not the sender
+)
+
+// limits how deep nested multiparts are followed
+const maxEntityDepth = 8
+
+type Signature struct {
+	Protocol    string           `json:"protocol"`
+	Status      string           `json:"status"`
+	Signer      string           `json:"signer"`
+	Certificate *CertificateInfo `json:"certificate,omitempty"` // only set for S/MIME
+}
+
+type Message struct {
+	UID       uint32     `json:"uid"`
+	From      []string   `json:"from"`
+	To        []string   `json:"to"`
+	Cc        []string   `json:"cc"`
+	Subject   string     `json:"subject"`
+	Date      time.Time  `json:"date"`
+	Text      string     `json:"text"`
+	HTML      string     `json:"html"`
+	Encrypted bool       `json:"encrypted"`
+	Decrypted bool       `json:"decrypted"`
+	Signature *Signature `json:"signature"`
+}
+
+func (s *realEmailService) FetchMessage(ctx context.Context, account *repository.MailAccount, mailbox string, uid uint32) (*Message, error) {
+	password, err := utils.DecryptSecret(account.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := imapclient.DialTLS(s.imapAddr, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Logout()
+
+	if err := client.Login(account.Username, password).Wait(); err != nil {
+		return nil, err
+	}
+
+	if _, err := client.Select(mailbox, &imap.SelectOptions{ReadOnly: true}).Wait(); err != nil {
+		return nil, errors.ErrorNotFound
+	}
+
+	section := &imap.FetchItemBodySection{Peek: true}
+	messages, err := client.Fetch(imap.UIDSetNum(imap.UID(uid)), &imap.FetchOptions{
+		UID:         true,
+		BodySection: []*imap.FetchItemBodySection{section},
+	}).Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(messages) == 0 {
+		return nil, errors.ErrorNotFound
+	}
+
+	reader, err := s.newMessageReader(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return reader.parseMessage(uid, messages[0].FindBodySection(section))
+}
+
+// messageReader holds what is needed to decrypt and verify a message
+type messageReader struct {
+	msg        *Message
+	keyring    openpgp.EntityList // the key of the account and the ones it trusts
+	autocrypt  openpgp.EntityList // the keys the message came with, never trusted
+	smime      *smimeIdentity
+	trustStore *x509.CertPool
+}
+
+// newMessageReader loads the keys of the account, if it has any
+func (s *realEmailService) newMessageReader(ctx context.Context, accountId int32) (*messageReader, error) {
+	reader := &messageReader{trustStore: s.smimeTrustStore}
+
+	trusted, err := s.loadTrustedPgpKeys(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	entity, err := s.loadPgpEntity(ctx, accountId)
+	if err == nil {
+		reader.keyring = append(openpgp.EntityList{entity}, trusted...)
+	} else if errors.Is(err, pgx.ErrNoRows) {
+		reader.keyring = trusted
+	} else {
+		return nil, err
+	}
+
+	reader.smime, err = s.loadSmimeIdentity(ctx, accountId)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+func (r *messageReader) parseMessage(uid uint32, raw []byte) (*Message, error) {
+	header, body, err := splitEntity(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	mailHeader := mail.Header{Header: message.Header{Header: header}}
+	r.msg = &Message{UID: uid}
+	r.msg.Subject, _ = mailHeader.Subject()
+	r.msg.Date, _ = mailHeader.Date()
+	r.msg.From = readAddresses(mailHeader, "From")
+	r.msg.To = readAddresses(mailHeader, "To")
+	r.msg.Cc = readAddresses(mailHeader, "Cc")
+
+	// senders may attach their public key through Autocrypt, anyone can
+	// attach one so it only tells whether the signature is correct
+	if len(r.msg.From) == 1 {
+		r.autocrypt = readAutocryptKeys(header, r.msg.From[0])
+	}
+
+	if err := r.readEntity(header, body, 0); err != nil {
+		return nil, err
+	}
+	return r.msg, nil
+}
+
+func (r *messageReader) readEntity(header textproto.Header, body []byte, depth int) error {
+	if depth > maxEntityDepth {
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	switch {
+	case mediaType == "multipart/encrypted" && params["protocol"] == "application/pgp-encrypted":
+		return r.readPgpEncrypted(body, params["boundary"], depth)
+	case mediaType == "multipart/signed" && params["protocol"] == "application/pgp-signature":
+		return r.readPgpSigned(body, params["boundary"], depth)
+	case mediaType == "multipart/signed" && isPkcs7Type(params["protocol"], "signature"):
+		return r.readSmimeSigned(body, params["boundary"], depth)
+	case isPkcs7Type(mediaType, "mime"):
+		return r.readSmime(header, body, depth)
+	case strings.HasPrefix(mediaType, "multipart/"):
+		for _, part := range splitMultipart(body, params["boundary"]) {
+			partHeader, partBody, err := splitEntity(part)
+			if err != nil {
+				return err
+			}
+
+			if err := r.readEntity(partHeader, partBody, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case mediaType == "text/plain" || mediaType == "text/html":
+		disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+		if disposition == "attachment" {
+			return nil
+		}
+
+		text, err := decodeBody(header, body)
+		if err != nil {
+			return err
+		}
+
+		if mediaType == "text/plain" && r.msg.Text == "" {
+			r.msg.Text = string(text)
+		} else if mediaType == "text/html" && r.msg.HTML == "" {
+			r.msg.HTML = string(text)
+		}
+	}
+
+	return nil
+}
+
+// readInner continues reading with a decrypted or verified entity
+func (r *messageReader) readInner(entity []byte, depth int) error {
+	header, body, err := splitEntity(entity)
+	if err != nil {
+		return nil
+	}
+	return r.readEntity(header, body, depth+1)
+}
+
+func (r *messageReader) readPgpEncrypted(body []byte, boundary string, depth int) error {
+	r.msg.Encrypted = true
+
+	parts := splitMultipart(body, boundary)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	_, data, err := splitEntity(parts[1])
+	if err != nil {
+		return err
+	}
+
+	block, err := armor.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+
+	// messages that can't be decrypted with our key are returned as is
+	details, err := openpgp.ReadMessage(block.Body, r.verificationKeys(), nil, pgpConfig)
+	if err != nil {
+		return nil
+	}
+
+	// signature problems are reported in SignatureError, an error here means
+	// the ciphertext was tampered with
+	decrypted, err := io.ReadAll(details.UnverifiedBody)
+	if err != nil {
+		return nil
+	}
+	r.msg.Decrypted = true
+
+	if details.IsSigned {
+		r.msg.Signature = &Signature{Protocol: SchemePgp, Signer: fmt.Sprintf("%016X", details.SignedByKeyId)}
+		switch {
+		case details.SignedBy == nil:
+			r.msg.Signature.Status = SignatureStatusUnknownKey
+		case details.SignatureError != nil:
+			r.msg.Signature.Status = SignatureStatusInvalid
+		default:
+			r.msg.Signature.Status = r.pgpSignerStatus(details.SignedBy.Entity)
+			r.msg.Signature.Signer = describeSigner(details.SignedBy.Entity)
+		}
+	}
+
+	return r.readInner(decrypted, depth)
+}
+
+func (r *messageReader) readPgpSigned(body []byte, boundary string, depth int) error {
+	parts := splitMultipart(body, boundary)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	_, signature, err := splitEntity(parts[1])
+	if err != nil {
+		return err
+	}
+
+	// the signature covers the first part exactly, with CRLF line endings
+	signer, err := openpgp.CheckArmoredDetachedSignature(r.verificationKeys(), bytes.NewReader(canonicalizeLineEndings(parts[0])), bytes.NewReader(signature), pgpConfig)
+
+	// a signature inside an encrypted message is already reported
+	if r.msg.Signature == nil {
+		r.msg.Signature = &Signature{Protocol: SchemePgp}
+		switch {
+		case errors.Is(err, pgpErrors.ErrUnknownIssuer):
+			r.msg.Signature.Status = SignatureStatusUnknownKey
+		case err != nil:
+			r.msg.Signature.Status = SignatureStatusInvalid
+		default:
+			r.msg.Signature.Status = r.pgpSignerStatus(signer)
+			r.msg.Signature.Signer = describeSigner(signer)
+		}
+	}
+
+	return r.readInner(parts[0], depth)
+}
+
+// verificationKeys are the trusted keys then the Autocrypt ones, which can
+// only verify a signature as untrusted, see pgpSignerStatus
+func (r *messageReader) verificationKeys() openpgp.EntityList {
+	return append(slices.Clone(r.keyring), r.autocrypt...)
+}
+
+// pgpSignerStatus is the status of a correct signature, only valid if the
+// account trusts the key and one of its user IDs is the sender
+func (r *messageReader) pgpSignerStatus(signer *openpgp.Entity) string {
+	if !slices.Contains(r.keyring, signer) {
+		return SignatureStatusUntrusted
+	}
+	if len(r.msg.From) != 1 {
+		return SignatureStatusMismatch
+	}
+
+	for _, identity := range signer.Identities {
+		if identity.UserId != nil && strings.EqualFold(identity.UserId.Email, r.msg.From[0]) {
+			return SignatureStatusValid
+		}
+	}
+	return SignatureStatusMismatch
+}
+
+// readSmime handles application/pkcs7-mime, which is either signed-data
+// holding the signed entity or enveloped-data holding the encrypted one
+func (r *messageReader) readSmime(header textproto.Header, body []byte, depth int) error {
+	data, err := decodeBody(header, body)
+	if err != nil {
+		return nil
+	}
+
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil
+	}
+
+	if len(p7.Signers) > 0 {
+		if r.msg.Signature == nil {
+			r.msg.Signature = verifySmime(p7, r.trustStore, r.msg.From)
+		}
+		return r.readInner(p7.Content, depth)
+	}
+
+	r.msg.Encrypted = true
+	if r.smime == nil {
+		return nil
+	}
+
+	// messages that can't be decrypted with our certificate are returned as is
+	decrypted, err := p7.Decrypt(r.smime.chain[0], r.smime.key)
+	if err != nil {
+		return nil
+	}
+	r.msg.Decrypted = true
+
+	return r.readInner(decrypted, depth)
+}
+
+func (r *messageReader) readSmimeSigned(body []byte, boundary string, depth int) error {
+	parts := splitMultipart(body, boundary)
+	if len(parts) != 2 {
+		return nil
+	}
+
+	signatureHeader, signatureBody, err := splitEntity(parts[1])
+	if err != nil {
+		return err
+	}
+
+	data, err := decodeBody(signatureHeader, signatureBody)
+	if err != nil {
+		return nil
+	}
+
+	if r.msg.Signature == nil {
+		p7, err := pkcs7.Parse(data)
+		if err != nil {
+			r.msg.Signature = &Signature{Protocol: SchemeSmime, Status: SignatureStatusInvalid}
+		} else {
+			// the signature covers the first part exactly, with CRLF line endings
+			p7.Content = canonicalizeLineEndings(parts[0])
+			r.msg.Signature = verifySmime(p7, r.trustStore, r.msg.From)
+		}
+	}
+
+	return r.readInner(parts[0], depth)
+}
+
+// decodeBody undoes the transfer encoding and charset of a body
+func decodeBody(header textproto.Header, body []byte) ([]byte, error) {
+	entity, err := message.New(message.Header{Header: header}, bytes.NewReader(body))
+	if err != nil && !message.IsUnknownCharset(err) {
+		return nil, err
+	}
+	return io.ReadAll(entity.Body)
+}
+
+// isPkcs7Type matches both the registered application/pkcs7-* and the
+// legacy application/x-pkcs7-* media types
+func isPkcs7Type(mediaType, subtype string) bool {
+	return mediaType == "application/pkcs7-"+subtype || mediaType == "application/x-pkcs7-"+subtype
+}
+
+func readAddresses(header mail.Header, key string) []string {
+	list, err := header.AddressList(key)
+	if err != nil {
+		return nil
+	}
+
+	addresses := make([]string, 0, len(list))
+	for _, address := range list {
+		addresses = append(addresses, address.Address)
+	}
+	return addresses
+}
+
+// readAutocryptKeys returns the keys from the Autocrypt header if it
+// belongs to the sender
+func readAutocryptKeys(header textproto.Header, sender string) openpgp.EntityList {
+	value := header.Get("Autocrypt")
+	if value == "" {
+		return nil
+	}
+
+	var addr, keydata string
+	for attribute := range strings.SplitSeq(value, ";") {
+		key, val, _ := strings.Cut(strings.TrimSpace(attribute), "=")
+		switch key {
+		case "addr":
+			addr = val
+		case "keydata":
+			keydata = val
+		}
+	}
+
+	if !strings.EqualFold(addr, sender) {
+		return nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(keydata), ""))
+	if err != nil {
+		return nil
+	}
+
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	return entities
+}
+
+func describeSigner(entity *openpgp.Entity) string {
+	if identity := entity.PrimaryIdentity(); identity != nil {
+		return identity.Name
+	}
+	return fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+}
@@ -0,0 +1,139 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"mime"
+
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+)
+
+// MIME entities are handled as raw bytes (header fields, blank line, body)
+// because signatures are computed over the exact bytes of a part.
+
+func buildTextPart(body string) ([]byte, error) {
+	var header message.Header
+	header.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	var buffer bytes.Buffer
+	writer, err := message.CreateWriter(&buffer, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func buildMultipart(contentType string, params map[string]string, parts ...[]byte) []byte {
+	boundary := rand.Text()
+	params["boundary"] = boundary
+
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "Content-Type: %s\r\n\r\n", mime.FormatMediaType(contentType, params))
+	for _, part := range parts {
+		fmt.Fprintf(&buffer, "--%s\r\n", boundary)
+		buffer.Write(part)
+		buffer.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buffer, "--%s--\r\n", boundary)
+
+	return buffer.Bytes()
+}
+
+// writeMessage merges the header fields of entity into the message header
+// and appends its body untouched
+func writeMessage(header mail.Header, entity []byte) ([]byte, error) {
+	entityHeader, body, err := splitEntity(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := entityHeader.Fields()
+	for fields.Next() {
+		raw, err := fields.Raw()
+		if err != nil {
+			return nil, err
+		}
+		header.AddRaw(raw)
+	}
+
+	var buffer bytes.Buffer
+	if err := textproto.WriteHeader(&buffer, header.Header.Header); err != nil {
+		return nil, err
+	}
+	buffer.Write(body)
+
+	return buffer.Bytes(), nil
+}
+
+func splitEntity(entity []byte) (textproto.Header, []byte, error) {
+	reader := bufio.NewReader(bytes.NewReader(entity))
+	header, err := textproto.ReadHeader(reader)
+	if err != nil {
+		return textproto.Header{}, nil, err
+	}
+
+	body, err := io.ReadAll(reader)
+	return header, body, err
+}
+
+// splitMultipart returns the raw parts of a multipart body, without the line
+// break preceding each delimiter as it belongs to the delimiter
+func splitMultipart(body []byte, boundary string) [][]byte {
+	delimiter := []byte("--" + boundary)
+
+	var parts [][]byte
+	start, position := -1, 0
+	for {
+		index := bytes.Index(body[position:], delimiter)
+		if index < 0 {
+			break
+		}
+		index += position
+
+		// delimiters have to be at the start of a line
+		if index != 0 && body[index-1] != '\n' {
+			position = index + len(delimiter)
+			continue
+		}
+
+		if start >= 0 {
+			part := body[start:index]
+			part = bytes.TrimSuffix(part, []byte("\n"))
+			part = bytes.TrimSuffix(part, []byte("\r"))
+			parts = append(parts, part)
+		}
+
+		rest := body[index+len(delimiter):]
+		if bytes.HasPrefix(rest, []byte("--")) {
+			break
+		}
+
+		lineEnd := bytes.IndexByte(rest, '\n')
+		if lineEnd < 0 {
+			break
+		}
+		start = index + len(delimiter) + lineEnd + 1
+		position = start
+	}
+
+	return parts
+}
+
+func canonicalizeLineEndings(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
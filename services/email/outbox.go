@@ -0,0 +1,342 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message/mail"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+)
+
+const (
+	OutboxStatusScheduled = "scheduled"
+	OutboxStatusSending   = "sending"
+	OutboxStatusSent      = "sent"
+	OutboxStatusFailed    = "failed"
+	OutboxStatusCancelled = "cancelled"
+)
+
+const (
+	outboxPollInterval = time.Second * 5
+	outboxBatchSize    = 10
+	outboxMaxAttempts  = 8
+	outboxStaleAfter   = time.Minute * 10 // a message stuck in sending this long is assumed lost by its worker
+	outboxBaseBackoff  = time.Second * 30
+	outboxMaxBackoff   = time.Hour
+
+	// a whole delivery has to end well before outboxStaleAfter so that a message
+	// is not released to another worker while it is still being sent
+	smtpDialTimeout = time.Second * 30
+	smtpSendTimeout = time.Minute * 2
+)
+
+// schemes used to sign and encrypt messages
+const (
+	SchemePgp   = "pgp"
+	SchemeSmime = "smime"
+)
+
+type OutgoingMessage struct {
+	To         []string          `json:"to"`
+	Subject    string            `json:"subject"`
+	Body       string            `json:"body"`
+	SendAt     time.Time         `json:"sendAt"`     // optional, the message is sent after the undo window if unset
+	Sign       bool              `json:"sign"`       // sign with the key of the account
+	Encrypt    bool              `json:"encrypt"`    // encrypt to every recipient, requires PublicKeys
+	Scheme     string            `json:"scheme"`     // SchemePgp if unset
+	PublicKeys map[string]string `json:"publicKeys"` // armored PGP key or PEM certificate of each recipient
+}
+
+func (s *realEmailService) ScheduleMessage(ctx context.Context, account *repository.MailAccount, senderId int32, message OutgoingMessage) (*repository.MailOutbox, error) {
+	if len(message.To) == 0 {
+		return nil, errors.NewError("a message needs at least one recipient", http.StatusBadRequest)
+	}
+
+	recipients := make([]string, 0, len(message.To))
+	for _, to := range message.To {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, errors.NewError(fmt.Sprintf("recipient %s is not a valid email address", to), http.StatusBadRequest)
+		}
+		recipients = append(recipients, address.Address)
+	}
+
+	if message.Scheme == "" {
+		message.Scheme = SchemePgp
+	}
+
+	var recipientKeys []string
+	if message.Sign || message.Encrypt {
+		var err error
+		switch message.Scheme {
+		case SchemePgp:
+			recipientKeys, err = s.checkPgpMessage(ctx, account, recipients, message)
+		case SchemeSmime:
+			recipientKeys, err = s.checkSmimeMessage(ctx, account, recipients, message)
+		default:
+			return nil, errors.NewError(fmt.Sprintf("%s is not a supported scheme", message.Scheme), http.StatusBadRequest)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// every message is held back for at least the undo window
+	sendAt := time.Now().Add(config.Envs.MailUndoWindow)
+	if message.SendAt.After(sendAt) {
+		sendAt = message.SendAt
+	}
+
+	return s.storageService.AddOutboxMessage(ctx, repository.AddOutboxMessageParams{
+		Account:       account.ID,
+		SenderId:      senderId,
+		Recipients:    recipients,
+		Subject:       message.Subject,
+		Body:          message.Body,
+		Sign:          message.Sign,
+		Encrypt:       message.Encrypt,
+		Scheme:        message.Scheme,
+		RecipientKeys: recipientKeys,
+		SendAt:        sendAt,
+	})
+}
+
+func (s *realEmailService) CancelMessage(ctx context.Context, accountId, id int32) error {
+	message, err := s.storageService.GetOutboxMessage(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if message.Account != accountId {
+		return errors.ErrorNotFound
+	}
+
+	cancelled, err := s.storageService.CancelOutboxMessage(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if cancelled == 0 {
+		return errors.NewError(fmt.Sprintf("message %d can no longer be cancelled", id), http.StatusConflict)
+	}
+	return nil
+}
+
+func (s *realEmailService) ListOutbox(ctx context.Context, accountId int32) ([]*repository.MailOutbox, error) {
+	return s.storageService.ListAccountOutbox(ctx, accountId)
+}
+
+// StartOutboxWorker delivers due messages in the background until ctx is done
+func (s *realEmailService) StartOutboxWorker(ctx context.Context) {
+	log.Printf("[Outbox] Starting outbox worker...\n")
+
+	go func() {
+		ticker := time.NewTicker(outboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.processOutbox(ctx)
+			}
+		}
+	}()
+}
+
+func (s *realEmailService) processOutbox(ctx context.Context) {
+	if err := s.storageService.ReleaseStaleOutboxMessages(ctx, time.Now().Add(-outboxStaleAfter)); err != nil {
+		log.Printf("[Outbox] Failed to release stale messages: %s\n", err.Error())
+	}
+
+	messages, err := s.storageService.ClaimDueOutboxMessages(ctx, outboxBatchSize)
+	if err != nil {
+		log.Printf("[Outbox] Failed to claim due messages: %s\n", err.Error())
+		return
+	}
+
+	for _, message := range messages {
+		s.handleDelivery(ctx, message)
+	}
+}
+
+// delivery is at least once: a worker that loses its claim after the message
+// was accepted by the server cannot take it back, so the message may be sent
+// twice. Updates only apply while the worker still holds the claim.
+func (s *realEmailService) handleDelivery(ctx context.Context, message *repository.MailOutbox) {
+	err := s.deliver(ctx, message)
+	if err == nil {
+		updated, err := s.storageService.MarkOutboxMessageSent(ctx, message.ID, message.Attempts)
+		if err != nil {
+			log.Printf("[Outbox] Message %d was sent but could not be marked as such: %s\n", message.ID, err.Error())
+		} else if updated == 0 {
+			log.Printf("[Outbox] Message %d was sent after its claim was lost, it may be sent again\n", message.ID)
+		}
+		return
+	}
+
+	if !isTransientError(err) || message.Attempts >= outboxMaxAttempts {
+		log.Printf("[Outbox] Giving up on message %d after %d attempts: %s\n", message.ID, message.Attempts, err.Error())
+		params := repository.MarkOutboxMessageFailedParams{
+			ID:        message.ID,
+			LastError: err.Error(),
+			Attempts:  message.Attempts,
+		}
+		if _, err := s.storageService.MarkOutboxMessageFailed(ctx, params); err != nil {
+			log.Printf("[Outbox] Failed to mark message %d as failed: %s\n", message.ID, err.Error())
+		}
+		return
+	}
+
+	backoff := min(outboxBaseBackoff<<(message.Attempts-1), outboxMaxBackoff)
+	params := repository.RetryOutboxMessageParams{
+		ID:            message.ID,
+		LastError:     err.Error(),
+		NextAttemptAt: time.Now().Add(backoff),
+		Attempts:      message.Attempts,
+	}
+	if _, err := s.storageService.RetryOutboxMessage(ctx, params); err != nil {
+		log.Printf("[Outbox] Failed to reschedule message %d: %s\n", message.ID, err.Error())
+	}
+}
+
+func (s *realEmailService) deliver(ctx context.Context, message *repository.MailOutbox) error {
+	account, err := s.storageService.GetMailAccountById(ctx, message.Account)
+	if err != nil {
+		return err
+	}
+
+	data, err := s.buildMessage(ctx, account, message)
+	if err != nil {
+		return err
+	}
+
+	password, err := utils.DecryptSecret(account.Password)
+	if err != nil {
+		return err
+	}
+
+	auth := smtp.PlainAuth("", account.Username, password, config.Envs.SmtpHost)
+	return sendMail(s.smtpAddr, auth, account.Email, message.Recipients, data)
+}
+
+// sendMail works like smtp.SendMail but gives up once the send timeout is over
+func sendMail(addr string, auth smtp.Auth, from string, to []string, data []byte) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, smtpDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(smtpSendTimeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if ok, _ := client.Extension("AUTH"); ok && auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (s *realEmailService) buildMessage(ctx context.Context, account *repository.MailAccount, message *repository.MailOutbox) ([]byte, error) {
+	to := make([]*mail.Address, 0, len(message.Recipients))
+	for _, recipient := range message.Recipients {
+		to = append(to, &mail.Address{Address: recipient})
+	}
+
+	header := mail.Header{}
+	header.SetAddressList("From", []*mail.Address{{Name: account.Name, Address: account.Email}})
+	header.SetAddressList("To", to)
+	header.SetSubject(message.Subject)
+	header.SetDate(time.Now())
+	header.Set("MIME-Version", "1.0")
+
+	hostname := account.Email[strings.LastIndex(account.Email, "@")+1:]
+	if err := header.GenerateMessageIDWithHostname(hostname); err != nil {
+		return nil, err
+	}
+
+	entity, err := buildTextPart(message.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Sign || message.Encrypt {
+		switch message.Scheme {
+		case SchemeSmime:
+			entity, err = s.smimeProtect(ctx, account.ID, message, entity)
+		default:
+			entity, err = s.pgpProtect(ctx, account.ID, message, entity)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return writeMessage(header, entity)
+}
+
+// 4xx replies and network failures are worth retrying, anything else is final
+func isTransientError(err error) bool {
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
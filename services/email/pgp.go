@@ -0,0 +1,373 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+)
+
+// PGP/MIME as described in RFC 3156
+
+var pgpConfig = &packet.Config{DefaultHash: crypto.SHA256}
+
+type PgpKeyUpload struct {
+	PrivateKey string `json:"privateKey"` // armored secret key
+	Passphrase string `json:"passphrase"`
+}
+
+type PgpTrustedKeyUpload struct {
+	PublicKey string `json:"publicKey"` // armored public key
+}
+
+type PgpKey struct {
+	Fingerprint string   `json:"fingerprint"`
+	PublicKey   string   `json:"publicKey"`
+	Identities  []string `json:"identities"`
+}
+
+func (s *realEmailService) SetPgpKey(ctx context.Context, account *repository.MailAccount, upload PgpKeyUpload) (*PgpKey, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(upload.PrivateKey))
+	if err != nil {
+		return nil, errors.NewError("the private key could not be read", http.StatusBadRequest)
+	}
+
+	if len(entities) != 1 {
+		return nil, errors.NewError("exactly one key must be provided", http.StatusBadRequest)
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey == nil {
+		return nil, errors.NewError("the provided key is not a private key", http.StatusBadRequest)
+	}
+
+	if err := entity.DecryptPrivateKeys([]byte(upload.Passphrase)); err != nil {
+		return nil, errors.NewError("the passphrase does not unlock the private key", http.StatusBadRequest)
+	}
+
+	if _, ok := entity.SigningKey(time.Now()); !ok {
+		return nil, errors.NewError("the provided key cannot be used for signing", http.StatusBadRequest)
+	}
+
+	key, err := describePgpKey(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := utils.EncryptSecret(upload.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := utils.EncryptSecret(upload.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storageService.SetPgpKey(ctx, repository.SetPgpKeyParams{
+		Account:     account.ID,
+		Fingerprint: key.Fingerprint,
+		PublicKey:   key.PublicKey,
+		PrivateKey:  privateKey,
+		Passphrase:  passphrase,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *realEmailService) GetPgpKey(ctx context.Context, accountId int32) (*PgpKey, error) {
+	stored, err := s.storageService.GetPgpKey(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(stored.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	return describePgpKey(entities[0])
+}
+
+func (s *realEmailService) RemovePgpKey(ctx context.Context, accountId int32) error {
+	return s.storageService.DeletePgpKey(ctx, accountId)
+}
+
+// TrustPgpKey adds a public key whose signatures are reported as valid on
+// messages received by the account, when they come from one of its identities
+func (s *realEmailService) TrustPgpKey(ctx context.Context, accountId int32, upload PgpTrustedKeyUpload) (*PgpKey, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(upload.PublicKey))
+	if err != nil {
+		return nil, errors.NewError("the public key could not be read", http.StatusBadRequest)
+	}
+
+	if len(entities) != 1 {
+		return nil, errors.NewError("exactly one key must be provided", http.StatusBadRequest)
+	}
+
+	// only the public part is kept if a private key was sent
+	key, err := describePgpKey(entities[0])
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storageService.AddPgpTrustedKey(ctx, repository.AddPgpTrustedKeyParams{
+		Account:     accountId,
+		Fingerprint: key.Fingerprint,
+		PublicKey:   key.PublicKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *realEmailService) ListTrustedPgpKeys(ctx context.Context, accountId int32) ([]*PgpKey, error) {
+	stored, err := s.storageService.ListPgpTrustedKeys(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*PgpKey, 0, len(stored))
+	for _, trusted := range stored {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(trusted.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := describePgpKey(entities[0])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *realEmailService) UntrustPgpKey(ctx context.Context, accountId int32, fingerprint string) error {
+	deleted, err := s.storageService.DeletePgpTrustedKey(ctx, accountId, strings.ToUpper(fingerprint))
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return errors.ErrorNotFound
+	}
+	return nil
+}
+
+// loadTrustedPgpKeys returns the public keys the account trusts, its own
+// excepted
+func (s *realEmailService) loadTrustedPgpKeys(ctx context.Context, accountId int32) (openpgp.EntityList, error) {
+	stored, err := s.storageService.ListPgpTrustedKeys(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	keyring := openpgp.EntityList{}
+	for _, trusted := range stored {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(trusted.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+		keyring = append(keyring, entities...)
+	}
+	return keyring, nil
+}
+
+// loadPgpEntity returns the unlocked key of an account
+func (s *realEmailService) loadPgpEntity(ctx context.Context, accountId int32) (*openpgp.Entity, error) {
+	stored, err := s.storageService.GetPgpKey(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := utils.DecryptSecret(stored.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := utils.DecryptSecret(stored.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(privateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	entity := entities[0]
+	if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func describePgpKey(entity *openpgp.Entity) (*PgpKey, error) {
+	var buffer bytes.Buffer
+	writer, err := armor.Encode(&buffer, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := entity.Serialize(writer); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	key := &PgpKey{
+		Fingerprint: strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint)),
+		PublicKey:   buffer.String(),
+	}
+	for name := range entity.Identities {
+		key.Identities = append(key.Identities, name)
+	}
+	return key, nil
+}
+
+func (s *realEmailService) checkPgpMessage(ctx context.Context, account *repository.MailAccount, recipients []string, message OutgoingMessage) ([]string, error) {
+	if _, err := s.storageService.GetPgpKey(ctx, account.ID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NewError(fmt.Sprintf("account %s has no PGP key", account.Email), http.StatusBadRequest)
+		}
+		return nil, err
+	}
+
+	if !message.Encrypt {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		key, ok := message.PublicKeys[recipient]
+		if !ok {
+			return nil, errors.NewError(fmt.Sprintf("no public key was provided for %s", recipient), http.StatusBadRequest)
+		}
+
+		if _, err := readRecipientKey(key, recipient); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// pgpProtect signs and/or encrypts entity as requested by message
+func (s *realEmailService) pgpProtect(ctx context.Context, accountId int32, message *repository.MailOutbox, entity []byte) ([]byte, error) {
+	signer, err := s.loadPgpEntity(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !message.Encrypt {
+		return pgpSign(entity, signer)
+	}
+
+	// the sender can read its own sent messages
+	to := []*openpgp.Entity{signer}
+	for i, key := range message.RecipientKeys {
+		recipient, err := readRecipientKey(key, message.Recipients[i])
+		if err != nil {
+			return nil, err
+		}
+		to = append(to, recipient)
+	}
+
+	if !message.Sign {
+		signer = nil
+	}
+	return pgpEncrypt(entity, to, signer)
+}
+
+// readRecipientKey parses an armored public key and checks that it can
+// encrypt to the given address
+func readRecipientKey(armored, address string) (*openpgp.Entity, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+	if err != nil || len(entities) == 0 {
+		return nil, errors.NewError(fmt.Sprintf("the key for %s could not be read", address), http.StatusBadRequest)
+	}
+
+	entity := entities[0]
+	if !hasIdentity(entity, address) {
+		return nil, errors.NewError(fmt.Sprintf("the key provided for %s does not belong to that address", address), http.StatusBadRequest)
+	}
+
+	if _, ok := entity.EncryptionKey(time.Now()); !ok {
+		return nil, errors.NewError(fmt.Sprintf("the key for %s cannot be used for encryption", address), http.StatusBadRequest)
+	}
+	return entity, nil
+}
+
+func hasIdentity(entity *openpgp.Entity, address string) bool {
+	for _, identity := range entity.Identities {
+		if identity.UserId != nil && strings.EqualFold(identity.UserId.Email, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// pgpSign wraps entity into a multipart/signed entity with a detached signature
+func pgpSign(entity []byte, signer *openpgp.Entity) ([]byte, error) {
+	entity = canonicalizeLineEndings(entity)
+
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, signer, bytes.NewReader(entity), pgpConfig); err != nil {
+		return nil, err
+	}
+
+	signaturePart := fmt.Appendf(nil, "Content-Type: application/pgp-signature; name=\"signature.asc\"\r\nContent-Description: OpenPGP digital signature\r\n\r\n%s", signature.Bytes())
+
+	params := map[string]string{"micalg": "pgp-sha256", "protocol": "application/pgp-signature"}
+	return buildMultipart("multipart/signed", params, entity, signaturePart), nil
+}
+
+// pgpEncrypt wraps entity into a multipart/encrypted entity readable by the
+// recipients and the sender, signing it in the same pass if signer is set
+func pgpEncrypt(entity []byte, to []*openpgp.Entity, signer *openpgp.Entity) ([]byte, error) {
+	var ciphertext bytes.Buffer
+	armored, err := armor.Encode(&ciphertext, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := openpgp.Encrypt(armored, to, signer, nil, pgpConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := plaintext.Write(canonicalizeLineEndings(entity)); err != nil {
+		return nil, err
+	}
+
+	if err := plaintext.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := armored.Close(); err != nil {
+		return nil, err
+	}
+
+	controlPart := []byte("Content-Type: application/pgp-encrypted\r\nContent-Description: PGP/MIME version identification\r\n\r\nVersion: 1\r\n")
+	dataPart := fmt.Appendf(nil, "Content-Type: application/octet-stream; name=\"encrypted.asc\"\r\nContent-Description: OpenPGP encrypted message\r\nContent-Disposition: inline; filename=\"encrypted.asc\"\r\n\r\n%s\r\n", ciphertext.Bytes())
+
+	params := map[string]string{"protocol": "application/pgp-encrypted"}
+	return buildMultipart("multipart/encrypted", params, controlPart, dataPart), nil
+}
@@ -0,0 +1,424 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils"
+	"github.com/piquel-fr/api/utils/errors"
+	"github.com/smallstep/pkcs7"
+)
+
+// S/MIME as described in RFC 8551
+
+type SmimeCertificateUpload struct {
+	Certificate string `json:"certificate"` // PEM chain, starting with the certificate of the account
+	PrivateKey  string `json:"privateKey"`  // PEM private key, PKCS#1, PKCS#8 or SEC 1
+}
+
+type CertificateInfo struct {
+	Fingerprint  string    `json:"fingerprint"`
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serialNumber"`
+	Emails       []string  `json:"emails"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+}
+
+type smimeIdentity struct {
+	chain []*x509.Certificate
+	key   crypto.PrivateKey
+}
+
+func (s *realEmailService) SetSmimeCert(ctx context.Context, account *repository.MailAccount, upload SmimeCertificateUpload) (*CertificateInfo, error) {
+	chain, err := parseCertificates(upload.Certificate)
+	if err != nil || len(chain) == 0 {
+		return nil, errors.NewError("the certificate could not be read", http.StatusBadRequest)
+	}
+
+	key, err := parsePrivateKey(upload.PrivateKey)
+	if err != nil {
+		return nil, errors.NewError("the private key could not be read", http.StatusBadRequest)
+	}
+
+	certificate := chain[0]
+	publicKey, ok := certificate.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(key.Public()) {
+		return nil, errors.NewError("the private key does not match the certificate", http.StatusBadRequest)
+	}
+
+	if err := s.checkSmimeCertificate(chain, account.Email); err != nil {
+		return nil, err
+	}
+
+	privateKey, err := utils.EncryptSecret(upload.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info := describeCertificate(certificate)
+	err = s.storageService.SetSmimeCert(ctx, repository.SetSmimeCertParams{
+		Account:     account.ID,
+		Fingerprint: info.Fingerprint,
+		Certificate: upload.Certificate,
+		PrivateKey:  privateKey,
+		NotAfter:    certificate.NotAfter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *realEmailService) GetSmimeCert(ctx context.Context, accountId int32) (*CertificateInfo, error) {
+	stored, err := s.storageService.GetSmimeCert(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := parseCertificates(stored.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	return describeCertificate(chain[0]), nil
+}
+
+func (s *realEmailService) RemoveSmimeCert(ctx context.Context, accountId int32) error {
+	return s.storageService.DeleteSmimeCert(ctx, accountId)
+}
+
+func (s *realEmailService) loadSmimeIdentity(ctx context.Context, accountId int32) (*smimeIdentity, error) {
+	stored, err := s.storageService.GetSmimeCert(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := parseCertificates(stored.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := utils.DecryptSecret(stored.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &smimeIdentity{chain, key}, nil
+}
+
+// checkSmimeCertificate makes sure the certificate belongs to address, is
+// currently valid and chains up to the trust store
+func (s *realEmailService) checkSmimeCertificate(chain []*x509.Certificate, address string) error {
+	certificate := chain[0]
+	if !slices.ContainsFunc(certificate.EmailAddresses, func(email string) bool { return strings.EqualFold(email, address) }) {
+		return errors.NewError(fmt.Sprintf("the certificate is not issued for %s", address), http.StatusBadRequest)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, parent := range chain[1:] {
+		intermediates.AddCert(parent)
+	}
+
+	_, err := certificate.Verify(x509.VerifyOptions{
+		Roots:         s.smimeTrustStore,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	})
+	if err != nil {
+		return errors.NewError(fmt.Sprintf("the certificate for %s is not trusted: %s", address, err.Error()), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// readRecipientCertificate parses a PEM certificate and checks that it can be
+// used to encrypt to the given address
+func (s *realEmailService) readRecipientCertificate(data, address string) (*x509.Certificate, error) {
+	chain, err := parseCertificates(data)
+	if err != nil || len(chain) == 0 {
+		return nil, errors.NewError(fmt.Sprintf("the certificate for %s could not be read", address), http.StatusBadRequest)
+	}
+
+	// the pkcs7 package can only wrap content keys with RSA
+	if _, ok := chain[0].PublicKey.(*rsa.PublicKey); !ok {
+		return nil, errors.NewError(fmt.Sprintf("the certificate for %s does not hold an RSA key", address), http.StatusBadRequest)
+	}
+
+	if err := s.checkSmimeCertificate(chain, address); err != nil {
+		return nil, err
+	}
+	return chain[0], nil
+}
+
+func (s *realEmailService) checkSmimeMessage(ctx context.Context, account *repository.MailAccount, recipients []string, message OutgoingMessage) ([]string, error) {
+	if _, err := s.storageService.GetSmimeCert(ctx, account.ID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.NewError(fmt.Sprintf("account %s has no S/MIME certificate", account.Email), http.StatusBadRequest)
+		}
+		return nil, err
+	}
+
+	if !message.Encrypt {
+		return nil, nil
+	}
+
+	certificates := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		certificate, ok := message.PublicKeys[recipient]
+		if !ok {
+			return nil, errors.NewError(fmt.Sprintf("no certificate was provided for %s", recipient), http.StatusBadRequest)
+		}
+
+		if _, err := s.readRecipientCertificate(certificate, recipient); err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+// smimeProtect signs and/or encrypts entity as requested by message. Signed
+// messages are signed first so that the signature is hidden once encrypted
+func (s *realEmailService) smimeProtect(ctx context.Context, accountId int32, message *repository.MailOutbox, entity []byte) ([]byte, error) {
+	identity, err := s.loadSmimeIdentity(ctx, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Sign {
+		if entity, err = smimeSign(entity, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	if !message.Encrypt {
+		return entity, nil
+	}
+
+	// the sender can read its own sent messages, if its key allows it
+	var recipients []*x509.Certificate
+	if _, ok := identity.chain[0].PublicKey.(*rsa.PublicKey); ok {
+		recipients = append(recipients, identity.chain[0])
+	}
+
+	for i, data := range message.RecipientKeys {
+		certificate, err := s.readRecipientCertificate(data, message.Recipients[i])
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, certificate)
+	}
+	return smimeEncrypt(entity, recipients)
+}
+
+// smimeSign wraps entity into opaque signed-data so that it survives
+// transports that rewrite multipart bodies
+func smimeSign(entity []byte, identity *smimeIdentity) ([]byte, error) {
+	signedData, err := pkcs7.NewSignedData(canonicalizeLineEndings(entity))
+	if err != nil {
+		return nil, err
+	}
+
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := signedData.AddSignerChain(identity.chain[0], identity.key, identity.chain[1:], pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+
+	der, err := signedData.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return buildPkcs7Part("signed-data", der), nil
+}
+
+func smimeEncrypt(entity []byte, recipients []*x509.Certificate) ([]byte, error) {
+	der, err := pkcs7.Encrypt(canonicalizeLineEndings(entity), recipients)
+	if err != nil {
+		return nil, err
+	}
+	return buildPkcs7Part("enveloped-data", der), nil
+}
+
+func buildPkcs7Part(smimeType string, der []byte) []byte {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "Content-Type: application/pkcs7-mime; smime-type=%s; name=\"smime.p7m\"\r\n", smimeType)
+	buffer.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buffer.WriteString("Content-Disposition: attachment; filename=\"smime.p7m\"\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString(der)
+	for len(encoded) > 76 {
+		buffer.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buffer.WriteString(encoded + "\r\n")
+
+	return buffer.Bytes()
+}
+
+// verifySmime reports whether the signature is correct, whether its signer
+// chains up to the trust store and whether its certificate is the sender's
+func verifySmime(p7 *pkcs7.PKCS7, trustStore *x509.CertPool, from []string) *Signature {
+	signature := &Signature{Protocol: SchemeSmime}
+	signer := p7.GetOnlySigner()
+	if signer != nil {
+		signature.Signer = describeSubject(signer)
+		signature.Certificate = describeCertificate(signer)
+	}
+
+	switch {
+	case len(p7.Signers) == 0 || p7.Verify() != nil:
+		signature.Status = SignatureStatusInvalid
+	case p7.VerifyWithChain(trustStore) != nil || (signer != nil && !canSignEmails(p7, signer, trustStore)):
+		signature.Status = SignatureStatusUntrusted
+	case signer == nil || !certificateMatchesSender(signer, from):
+		signature.Status = SignatureStatusMismatch
+	default:
+		signature.Status = SignatureStatusValid
+	}
+	return signature
+}
+
+// canSignEmails checks that the chain of the signer allows email protection,
+// pkcs7 accepts any extended key usage. Like pkcs7, the chain is checked at
+// the signing time when the signature has one
+func canSignEmails(p7 *pkcs7.PKCS7, signer *x509.Certificate, trustStore *x509.CertPool) bool {
+	signingTime := time.Now()
+	p7.UnmarshalSignedAttribute(pkcs7.OIDAttributeSigningTime, &signingTime)
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range p7.Certificates {
+		intermediates.AddCert(certificate)
+	}
+
+	_, err := signer.Verify(x509.VerifyOptions{
+		Roots:         trustStore,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		CurrentTime:   signingTime,
+	})
+	return err == nil
+}
+
+// oidEmailAddress is the legacy emailAddress attribute of the subject, older
+// certificates only have it instead of a SAN
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+// certificateMatchesSender checks the emails of the SAN and of the subject
+func certificateMatchesSender(certificate *x509.Certificate, from []string) bool {
+	if len(from) != 1 {
+		return false
+	}
+
+	emails := slices.Clone(certificate.EmailAddresses)
+	for _, name := range certificate.Subject.Names {
+		if email, ok := name.Value.(string); ok && name.Type.Equal(oidEmailAddress) {
+			emails = append(emails, email)
+		}
+	}
+
+	return slices.ContainsFunc(emails, func(email string) bool { return strings.EqualFold(email, from[0]) })
+}
+
+func loadTrustStore(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return x509.SystemCertPool()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+func parseCertificates(data string) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+func parsePrivateKey(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type")
+		}
+		return signer, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func describeCertificate(certificate *x509.Certificate) *CertificateInfo {
+	fingerprint := sha256.Sum256(certificate.Raw)
+	return &CertificateInfo{
+		Fingerprint:  strings.ToUpper(hex.EncodeToString(fingerprint[:])),
+		Subject:      certificate.Subject.String(),
+		Issuer:       certificate.Issuer.String(),
+		SerialNumber: certificate.SerialNumber.String(),
+		Emails:       certificate.EmailAddresses,
+		NotBefore:    certificate.NotBefore,
+		NotAfter:     certificate.NotAfter,
+	}
+}
+
+func describeSubject(certificate *x509.Certificate) string {
+	if len(certificate.EmailAddresses) > 0 && certificate.Subject.CommonName != "" {
+		return fmt.Sprintf("%s <%s>", certificate.Subject.CommonName, certificate.EmailAddresses[0])
+	}
+
+	if len(certificate.EmailAddresses) > 0 {
+		return certificate.EmailAddresses[0]
+	}
+	return certificate.Subject.String()
+}
@@ -0,0 +1,46 @@
+package email
+
+import (
+	"log"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-message/mail"
+	"github.com/piquel-fr/api/config"
+)
+
+// SendSystemEmail sends a plain text message from the system account. Without
+// a system account configured the message is only logged
+func (s *realEmailService) SendSystemEmail(to, subject, body string) error {
+	address := config.Envs.SystemMailAddress
+	if address == "" {
+		log.Printf("[Email] No system account configured, not sending \"%s\" to %s\n", subject, to)
+		return nil
+	}
+
+	header := mail.Header{}
+	header.SetAddressList("From", []*mail.Address{{Address: address}})
+	header.SetAddressList("To", []*mail.Address{{Address: to}})
+	header.SetSubject(subject)
+	header.SetDate(time.Now())
+	header.Set("MIME-Version", "1.0")
+
+	hostname := address[strings.LastIndex(address, "@")+1:]
+	if err := header.GenerateMessageIDWithHostname(hostname); err != nil {
+		return err
+	}
+
+	entity, err := buildTextPart(body)
+	if err != nil {
+		return err
+	}
+
+	data, err := writeMessage(header, entity)
+	if err != nil {
+		return err
+	}
+
+	auth := smtp.PlainAuth("", config.Envs.SystemMailUsername, config.Envs.SystemMailPassword, config.Envs.SmtpHost)
+	return sendMail(s.smtpAddr, auth, address, []string{to}, data)
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/piquel-fr/api/database/repository"
+)
+
+// The schema does not cascade deletions, so everything referencing a row
+// has to be removed before it. These are meant to run inside WithTransaction.
+
+func RemoveMailAccount(ctx context.Context, queries repository.Querier, accountId int32) error {
+	if err := queries.DeleteAccountShares(ctx, accountId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteAccountShareInvites(ctx, accountId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteAccountOutbox(ctx, accountId); err != nil {
+		return err
+	}
+
+	if err := queries.DeletePgpKey(ctx, accountId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteAccountPgpTrustedKeys(ctx, accountId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteSmimeCert(ctx, accountId); err != nil {
+		return err
+	}
+
+	return queries.DeleteMailAccount(ctx, accountId)
+}
+
+func RemoveOAuthClient(ctx context.Context, queries repository.Querier, clientId string) error {
+	if err := queries.DeleteClientOAuthCodes(ctx, clientId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteClientOAuthTokens(ctx, clientId); err != nil {
+		return err
+	}
+
+	return queries.DeleteOAuthClient(ctx, clientId)
+}
+
+func RemoveUser(ctx context.Context, queries repository.Querier, userId int32) error {
+	accounts, err := queries.ListOwnedMailAccountIds(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		if err := RemoveMailAccount(ctx, queries, account); err != nil {
+			return err
+		}
+	}
+
+	if err := queries.DeleteUserShares(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteUserShareInvites(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteUserOutbox(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteUserConsumedTokens(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.ClearActorSessions(ctx, pgtype.Int4{Int32: userId, Valid: true}); err != nil {
+		return err
+	}
+
+	if err := queries.ClearUserSessions(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteUserDevices(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteUserIdentities(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteUserTokens(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteServiceCredentials(ctx, userId); err != nil {
+		return err
+	}
+
+	clients, err := queries.ListOwnedOAuthClientIds(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	for _, client := range clients {
+		if err := RemoveOAuthClient(ctx, queries, client); err != nil {
+			return err
+		}
+	}
+
+	if err := queries.DeleteUserOAuthCodes(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteUserOAuthTokens(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteUserTotp(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteUserPendingLogins(ctx, userId); err != nil {
+		return err
+	}
+
+	if err := queries.DeleteWebauthnCredentials(ctx, userId); err != nil {
+		return err
+	}
+
+	return queries.DeleteUser(ctx, userId)
+}
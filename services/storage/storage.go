@@ -11,6 +11,9 @@ import (
 
 type StorageService interface {
 	repository.Querier
+
+	// runs fn inside a transaction, which is rolled back if fn returns an error
+	WithTransaction(ctx context.Context, fn func(queries repository.Querier) error) error
 	Close()
 }
 
@@ -40,6 +43,20 @@ func NewDatabaseStorageService() StorageService {
 	}
 }
 
+func (s *databaseStorageService) WithTransaction(ctx context.Context, fn func(queries repository.Querier) error) error {
+	tx, err := s.connection.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // no-op once committed
+
+	if err := fn(s.Queries.WithTx(tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
 func (s *databaseStorageService) Close() {
 	s.connection.Close()
 }
@@ -0,0 +1,93 @@
+package users
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/piquel-fr/api/database/repository"
+)
+
+const (
+	// other instances don't see invalidations, this bounds how stale they get
+	userCacheTTL  = time.Minute
+	userCacheSize = 10000
+)
+
+type cachedUser struct {
+	user      *repository.User
+	expiresAt time.Time
+}
+
+// userCache keeps recently authenticated users in memory so that the auth
+// middleware does not hit the database on every request
+type userCache struct {
+	mutex   sync.Mutex
+	entries map[int32]cachedUser
+}
+
+func newUserCache() *userCache {
+	return &userCache{entries: map[int32]cachedUser{}}
+}
+
+func (c *userCache) get(id int32) (*repository.User, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+
+	// handlers are free to modify the user they are given
+	user := *entry.user
+	return &user, true
+}
+
+func (c *userCache) set(user *repository.User) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= userCacheSize {
+		for id, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+	}
+
+	// still full of live entries, start over rather than tracking usage
+	if len(c.entries) >= userCacheSize {
+		clear(c.entries)
+	}
+
+	cached := *user
+	c.entries[user.ID] = cachedUser{&cached, now.Add(userCacheTTL)}
+}
+
+func (c *userCache) remove(id int32) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, id)
+}
+
+// GetCachedUser is GetUserById for the hot path, the user may be up to
+// userCacheTTL old if it was changed through another instance
+func (s *realUserService) GetCachedUser(ctx context.Context, id int32) (*repository.User, error) {
+	if user, ok := s.cache.get(id); ok {
+		return user, nil
+	}
+
+	user, err := s.storageService.GetUserById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.set(user)
+	return user, nil
+}
+
+func (s *realUserService) InvalidateUser(id int32) {
+	s.cache.remove(id)
+}
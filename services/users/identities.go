@@ -0,0 +1,145 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/piquel-fr/api/database/repository"
+	"github.com/piquel-fr/api/utils/errors"
+	"github.com/piquel-fr/api/utils/oauth"
+)
+
+var (
+	errorIdentityTaken = errors.NewError("this identity is already linked to another user", http.StatusConflict)
+	errorLastIdentity  = errors.NewError("the last identity of a user can't be unlinked", http.StatusConflict)
+)
+
+// ResolveOAuthUser returns the user the identity belongs to. Unknown identities
+// are only attached to an existing user with the same email if that user has no
+// identity yet (accounts created before identities were tracked) and the
+// provider verified the email. Otherwise the identity has to be linked by the
+// user themselves
+func (s *realUserService) ResolveOAuthUser(ctx context.Context, provider string, oauthUser *oauth.User, role string) (*repository.User, error) {
+	if oauthUser.Subject == "" {
+		return nil, errors.NewError(fmt.Sprintf("%s did not return an account identifier", provider), http.StatusBadRequest)
+	}
+
+	identity, err := s.storageService.GetUserIdentity(ctx, provider, oauthUser.Subject)
+	if err == nil {
+		if err := s.updateIdentity(ctx, identity, oauthUser); err != nil {
+			return nil, err
+		}
+		return s.storageService.GetUserById(ctx, identity.UserId)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	// service accounts have no email of their own, they never match
+	user, err := s.storageService.GetUserByEmail(ctx, oauthUser.Email)
+	if err == nil && user.Kind == KindUser {
+		count, err := s.storageService.CountUserIdentities(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if count > 0 || !oauthUser.EmailVerified {
+			return nil, errors.NewError(fmt.Sprintf("a user with the email %s already exists, sign in and link this identity from your account", oauthUser.Email), http.StatusConflict)
+		}
+
+		if _, err := s.storageService.AddUserIdentity(ctx, newIdentityParams(user.ID, provider, oauthUser)); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	params, err := s.newUserParams(ctx, oauthUser.Username, oauthUser.Email, oauthUser.Name, oauthUser.Image, role)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		user, err = queries.AddUser(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		_, err = queries.AddUserIdentity(ctx, newIdentityParams(user.ID, provider, oauthUser))
+		return err
+	})
+	return user, err
+}
+
+func (s *realUserService) LinkIdentity(ctx context.Context, userId int32, provider string, oauthUser *oauth.User) error {
+	if oauthUser.Subject == "" {
+		return errors.NewError(fmt.Sprintf("%s did not return an account identifier", provider), http.StatusBadRequest)
+	}
+
+	identity, err := s.storageService.GetUserIdentity(ctx, provider, oauthUser.Subject)
+	if err == nil {
+		if identity.UserId != userId {
+			return errorIdentityTaken
+		}
+		return s.updateIdentity(ctx, identity, oauthUser)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	_, err = s.storageService.AddUserIdentity(ctx, newIdentityParams(userId, provider, oauthUser))
+	return err
+}
+
+func (s *realUserService) ListIdentities(ctx context.Context, userId int32) ([]*repository.UserIdentity, error) {
+	return s.storageService.ListUserIdentities(ctx, userId)
+}
+
+// the identities are locked so that concurrent unlinks can't remove the last
+// ones together
+func (s *realUserService) UnlinkIdentity(ctx context.Context, userId, id int32) error {
+	return s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		identities, err := queries.LockUserIdentities(ctx, userId)
+		if err != nil {
+			return err
+		}
+
+		if !slices.ContainsFunc(identities, func(identity *repository.UserIdentity) bool { return identity.ID == id }) {
+			return errors.ErrorNotFound
+		}
+		if len(identities) == 1 {
+			return errorLastIdentity
+		}
+
+		_, err = queries.DeleteUserIdentity(ctx, userId, id)
+		return err
+	})
+}
+
+// the email of an identity is informative, it follows what the provider returns
+func (s *realUserService) updateIdentity(ctx context.Context, identity *repository.UserIdentity, oauthUser *oauth.User) error {
+	if identity.Email == oauthUser.Email && identity.Verified == oauthUser.EmailVerified {
+		return nil
+	}
+
+	return s.storageService.UpdateUserIdentity(ctx, repository.UpdateUserIdentityParams{
+		ID:       identity.ID,
+		Email:    oauthUser.Email,
+		Verified: oauthUser.EmailVerified,
+	})
+}
+
+func newIdentityParams(userId int32, provider string, oauthUser *oauth.User) repository.AddUserIdentityParams {
+	return repository.AddUserIdentityParams{
+		UserId:   userId,
+		Provider: provider,
+		Subject:  oauthUser.Subject,
+		Email:    oauthUser.Email,
+		Verified: oauthUser.EmailVerified,
+	}
+}
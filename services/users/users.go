@@ -9,10 +9,17 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/piquel-fr/api/config"
 	"github.com/piquel-fr/api/database/repository"
 	"github.com/piquel-fr/api/services/storage"
 	"github.com/piquel-fr/api/utils/errors"
+	"github.com/piquel-fr/api/utils/oauth"
+)
+
+const (
+	KindUser    = "user"
+	KindService = "service" // authenticates with client credentials, never through a browser
 )
 
 type UserService interface {
@@ -23,6 +30,8 @@ type UserService interface {
 	GetUserByUsername(ctx context.Context, username string) (*repository.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*repository.User, error)
 	GetUserFromContext(ctx context.Context) (*repository.User, error)
+	GetCachedUser(ctx context.Context, id int32) (*repository.User, error)
+	InvalidateUser(id int32) // drops the user from the cache after a change
 
 	// managing users
 	UpdateUser(ctx context.Context, params repository.UpdateUserParams) error
@@ -30,16 +39,27 @@ type UserService interface {
 	RegisterUser(ctx context.Context, username, email, name, image, role string) (*repository.User, error)
 	DeleteUser(ctx context.Context, user *repository.User) error
 
+	// service accounts
+	RegisterServiceAccount(ctx context.Context, username, name, role string) (*repository.User, error)
+	ListServiceAccounts(ctx context.Context) ([]*repository.User, error)
+
+	// identities
+	ResolveOAuthUser(ctx context.Context, provider string, oauthUser *oauth.User, role string) (*repository.User, error) // role is given to the user if one is registered
+	LinkIdentity(ctx context.Context, userId int32, provider string, oauthUser *oauth.User) error
+	ListIdentities(ctx context.Context, userId int32) ([]*repository.UserIdentity, error)
+	UnlinkIdentity(ctx context.Context, userId, id int32) error
+
 	// other
 	ListUsers(ctx context.Context, offset, limit int32) ([]*repository.User, error)
 }
 
 type realUserService struct {
 	storageService storage.StorageService
+	cache          *userCache
 }
 
 func NewRealUserService(storageService storage.StorageService) UserService {
-	return &realUserService{storageService}
+	return &realUserService{storageService, newUserCache()}
 }
 
 func (s *realUserService) GetUserById(ctx context.Context, id int32) (*repository.User, error) {
@@ -69,6 +89,7 @@ func (s *realUserService) UpdateUser(ctx context.Context, params repository.Upda
 	}
 	params.Username = username
 
+	defer s.InvalidateUser(params.ID)
 	return s.storageService.UpdateUser(ctx, params)
 }
 
@@ -79,48 +100,106 @@ func (s *realUserService) UpdateUserAdmin(ctx context.Context, params repository
 	}
 	params.Username = username
 
-	if err := config.Policy.ValidateRole(params.Role); err != nil {
-		return err
+	defer s.InvalidateUser(params.ID)
+	return s.withRole(ctx, params.Role, func(queries repository.Querier) error {
+		return queries.UpdateUserAdmin(ctx, params)
+	})
+}
+
+func (s *realUserService) RegisterUser(ctx context.Context, username, email, name, image, role string) (*repository.User, error) {
+	params, err := s.newUserParams(ctx, username, email, name, image, role)
+	if err != nil {
+		return nil, err
 	}
 
-	return s.storageService.UpdateUserAdmin(ctx, params)
+	return s.storageService.AddUser(ctx, params)
 }
 
-func (s *realUserService) RegisterUser(ctx context.Context, username, email, name, image, role string) (*repository.User, error) {
+func (s *realUserService) newUserParams(ctx context.Context, username, email, name, image, role string) (repository.AddUserParams, error) {
 	username, err := s.formatAndValidateUsername(ctx, username, true)
 	if err != nil {
-		return nil, err
+		return repository.AddUserParams{}, err
 	}
 
-	if err := config.Policy.ValidateRole(role); err != nil {
-		return nil, err
+	if err := config.Policy.Load().ValidateRole(role); err != nil {
+		return repository.AddUserParams{}, err
 	}
 
-	params := repository.AddUserParams{
+	return repository.AddUserParams{
 		Username: username,
 		Email:    email,
 		Name:     name,
 		Image:    image,
 		Role:     role,
+		Kind:     KindUser,
+	}, nil
+}
+
+// RegisterServiceAccount creates a service account, it has no email and can
+// only authenticate with the credentials issued for it
+func (s *realUserService) RegisterServiceAccount(ctx context.Context, username, name, role string) (*repository.User, error) {
+	// unlike users signing up, the name was chosen and is not replaced if invalid
+	username, err := s.formatAndValidateUsername(ctx, username, false)
+	if err != nil {
+		return nil, err
 	}
 
-	return s.storageService.AddUser(ctx, params)
+	// the validation skips the username of the requester
+	if _, err := s.storageService.GetUserByUsername(ctx, username); err == nil {
+		return nil, errors.NewError(fmt.Sprintf("username %s is already taken", username), http.StatusBadRequest)
+	}
+
+	var user *repository.User
+	err = s.withRole(ctx, role, func(queries repository.Querier) error {
+		user, err = queries.AddUser(ctx, repository.AddUserParams{
+			Username: username,
+			Name:     name,
+			Role:     role,
+			Kind:     KindService,
+		})
+		return err
+	})
+	return user, err
+}
+
+func (s *realUserService) ListServiceAccounts(ctx context.Context) ([]*repository.User, error) {
+	return s.storageService.ListServiceAccounts(ctx)
 }
 
 func (s *realUserService) DeleteUser(ctx context.Context, user *repository.User) error {
-	// TODO: delete user
-	return nil
+	defer s.InvalidateUser(user.ID)
+	return s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		return storage.RemoveUser(ctx, queries, user.ID)
+	})
 }
 
-// @param force: if the validation can fail. When creating a new user through OAuth, user creation cannot fail. We will thus create a random one
-func (s *realUserService) formatAndValidateUsername(ctx context.Context, username string, force bool) (string, error) {
-	// check if username actually changing
-	user, err := s.GetUserFromContext(ctx)
-	if err != nil {
-		return "", err
+// withRole checks that role exists and runs assign with its row held if it is
+// a custom one. Custom roles can be deleted at any time, DeleteCustomRole then
+// either waits and sees the user or deletes the role before assign can run
+func (s *realUserService) withRole(ctx context.Context, role string, assign func(queries repository.Querier) error) error {
+	policy := config.Policy.Load()
+	if err := policy.ValidateRole(role); err != nil {
+		return err
 	}
 
-	if user.Username == username {
+	return s.storageService.WithTransaction(ctx, func(queries repository.Querier) error {
+		if policy.Roles[role].Custom {
+			_, err := queries.LockRoleShared(ctx, role)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return errors.NewError(fmt.Sprintf("role %s does not exist anymore", role), http.StatusBadRequest)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return assign(queries)
+	})
+}
+
+// @param force: if the validation can fail. When creating a new user through OAuth, user creation cannot fail. We will thus create a random one
+func (s *realUserService) formatAndValidateUsername(ctx context.Context, username string, force bool) (string, error) {
+	// check if username actually changing, there is no user in context while registering
+	if user, err := s.GetUserFromContext(ctx); err == nil && user.Username == username {
 		return username, nil
 	}
 
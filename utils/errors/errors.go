@@ -33,6 +33,10 @@ func Is(err, target error) bool {
 	return errors.Is(err, target)
 }
 
+func As(err error, target any) bool {
+	return errors.As(err, target)
+}
+
 func getError(err error) *Error {
 	if err == nil {
 		panic("nil error being handled")
@@ -51,7 +55,10 @@ func getError(err error) *Error {
 		return ErrorNotFound
 	}
 
-	if errors.Is(err, jwt.ErrTokenMalformed) {
+	if errors.Is(err, jwt.ErrTokenMalformed) ||
+		errors.Is(err, jwt.ErrTokenUnverifiable) ||
+		errors.Is(err, jwt.ErrTokenSignatureInvalid) ||
+		errors.Is(err, jwt.ErrTokenInvalidClaims) {
 		return ErrorNotAuthenticated
 	}
 
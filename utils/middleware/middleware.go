@@ -33,7 +33,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 		w.Header().Set("Access-Control-Max-Age", "43100")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Cookie")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Cookie, Authorization")
 
 		next.ServeHTTP(w, r)
 	})
@@ -3,8 +3,11 @@ package utils
 import (
 	"fmt"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
+
+	"github.com/piquel-fr/api/config"
 )
 
 func GenerateSetCookie(name, value, domain, path, sameSite string, age time.Duration) string {
@@ -35,6 +38,92 @@ func GetCookiesFromStr(cookieStr string) map[string]string {
 	return cookies
 }
 
+// GetIpAddress returns the address of the client. When the request comes
+// from a trusted proxy, the forwarded addresses are walked from the closest
+// hop until one that is not a trusted proxy
 func GetIpAddress(r *http.Request) string {
-	return strings.Split(r.RemoteAddr, ":")[0]
+	addr, ok := parseIpAddress(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+
+	hops := getForwardedHops(r.Header)
+	for i := len(hops) - 1; i >= 0 && isTrustedProxy(addr); i-- {
+		hop, ok := parseIpAddress(hops[i])
+		if !ok {
+			break // obfuscated or unknown, the proxy is the best we know
+		}
+		addr = hop
+	}
+
+	return addr.String()
+}
+
+// SameNetwork reports whether both addresses are in the same /24 for IPv4 or
+// /64 for IPv6, which usually stays the same when a client reconnects
+func SameNetwork(a, b string) bool {
+	addrA, okA := parseIpAddress(a)
+	addrB, okB := parseIpAddress(b)
+	if !okA || !okB || addrA.Is4() != addrB.Is4() {
+		return false
+	}
+
+	bits := 64
+	if addrA.Is4() {
+		bits = 24
+	}
+
+	prefix, err := addrA.Prefix(bits)
+	return err == nil && prefix.Contains(addrB)
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range config.Envs.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// getForwardedHops lists the client addresses of the Forwarded header, see
+// RFC 7239, or of X-Forwarded-For if there is none. The last one is the
+// closest to us
+func getForwardedHops(header http.Header) []string {
+	var hops []string
+	if forwarded := header.Values("Forwarded"); len(forwarded) > 0 {
+		for element := range strings.SplitSeq(strings.Join(forwarded, ","), ",") {
+			hop := ""
+			for pair := range strings.SplitSeq(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					hop = value
+				}
+			}
+			hops = append(hops, hop)
+		}
+		return hops
+	}
+
+	for _, value := range header.Values("X-Forwarded-For") {
+		for hop := range strings.SplitSeq(value, ",") {
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseIpAddress reads an address with or without a port, IPv6 addresses
+// possibly being in brackets and quoted like in the Forwarded header
+func parseIpAddress(value string) (netip.Addr, bool) {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap().WithZone(""), true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/piquel-fr/api/utils/errors"
@@ -20,10 +21,16 @@ type github struct {
 	config oauth2.Config
 }
 
-func (gh *github) GetOAuthConfig() *oauth2.Config  { return &gh.config }
-func (gh *github) AuthCodeURL(state string) string { return gh.config.AuthCodeURL(state) }
+func (gh *github) GetOAuthConfig() *oauth2.Config { return &gh.config }
+func (gh *github) AuthCodeURL(state, nonce, verifier string) string {
+	return gh.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+}
+
+func (gh *github) Exchange(ctx context.Context, code, verifier string) (*oauth2.Token, error) {
+	return gh.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+}
 
-func (gh *github) FetchUser(context context.Context, token *oauth2.Token) (*User, error) {
+func (gh *github) FetchUser(context context.Context, token *oauth2.Token, nonce string) (*User, error) {
 	req, err := http.NewRequest("GET", profileURL, nil)
 	if err != nil {
 		return nil, err
@@ -40,6 +47,7 @@ func (gh *github) FetchUser(context context.Context, token *oauth2.Token) (*User
 	}
 
 	u := struct {
+		ID      int64  `json:"id"`
 		Email   string `json:"email"`
 		Name    string `json:"name"`
 		Login   string `json:"login"`
@@ -50,11 +58,15 @@ func (gh *github) FetchUser(context context.Context, token *oauth2.Token) (*User
 		return nil, err
 	}
 
+	// GitHub only lets verified addresses be public, and getPrivateEmail
+	// only returns a verified one
 	user := &User{
-		Name:     u.Name,
-		Email:    u.Email,
-		Image:    u.Picture,
-		Username: u.Login, // will be formated by user service
+		Subject:       strconv.FormatInt(u.ID, 10),
+		Name:          u.Name,
+		Email:         u.Email,
+		EmailVerified: true,
+		Image:         u.Picture,
+		Username:      u.Login, // will be formated by user service
 	}
 
 	if user.Email == "" {
@@ -16,11 +16,15 @@ type google struct {
 }
 
 func (gg *google) GetOAuthConfig() *oauth2.Config { return &gg.config }
-func (gg *google) AuthCodeURL(state string) string {
-	return gg.config.AuthCodeURL(state, gg.authCodeOptions)
+func (gg *google) AuthCodeURL(state, nonce, verifier string) string {
+	return gg.config.AuthCodeURL(state, gg.authCodeOptions, oauth2.S256ChallengeOption(verifier))
 }
 
-func (gg *google) FetchUser(context context.Context, token *oauth2.Token) (*User, error) {
+func (gg *google) Exchange(ctx context.Context, code, verifier string) (*oauth2.Token, error) {
+	return gg.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+}
+
+func (gg *google) FetchUser(context context.Context, token *oauth2.Token, nonce string) (*User, error) {
 	const endpointProfile = "https://www.googleapis.com/oauth2/v2/userinfo"
 
 	response, err := gg.config.Client(context, token).Get(endpointProfile + "?access_token=" + url.QueryEscape(token.AccessToken))
@@ -34,9 +38,11 @@ func (gg *google) FetchUser(context context.Context, token *oauth2.Token) (*User
 	}
 
 	u := struct {
-		Email   string `json:"email"`
-		Name    string `json:"name"`
-		Picture string `json:"picture"`
+		ID            string `json:"id"`
+		Email         string `json:"email"`
+		VerifiedEmail bool   `json:"verified_email"`
+		Name          string `json:"name"`
+		Picture       string `json:"picture"`
 	}{}
 
 	if err = json.NewDecoder(response.Body).Decode(&u); err != nil {
@@ -44,10 +50,12 @@ func (gg *google) FetchUser(context context.Context, token *oauth2.Token) (*User
 	}
 
 	user := &User{
-		Name:     u.Name,
-		Email:    u.Email,
-		Image:    u.Picture,
-		Username: u.Name, // will be formated by the users service
+		Subject:       u.ID,
+		Name:          u.Name,
+		Email:         u.Email,
+		EmailVerified: u.VerifiedEmail,
+		Image:         u.Picture,
+		Username:      u.Name, // will be formated by the users service
 	}
 
 	return user, nil
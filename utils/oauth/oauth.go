@@ -3,19 +3,34 @@ package oauth
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/piquel-fr/api/config"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/endpoints"
 )
 
+// every flow uses PKCE (RFC 7636) with the S256 method, verifier being the
+// code_verifier generated for the flow. nonce is only checked by providers
+// returning an ID token
 type Provider interface {
 	GetOAuthConfig() *oauth2.Config
-	FetchUser(context.Context, *oauth2.Token) (*User, error)
-	AuthCodeURL(state string) string
+	FetchUser(ctx context.Context, token *oauth2.Token, nonce string) (*User, error)
+	AuthCodeURL(state, nonce, verifier string) string
+	Exchange(ctx context.Context, code, verifier string) (*oauth2.Token, error)
 }
 
-type User struct{ Name, Username, Email, Image string }
+// Subject is the stable identifier of the account at the provider. Emails can
+// change or be reassigned, so they are never used to identify an account on
+// their own
+type User struct {
+	Subject       string
+	Name          string
+	Username      string
+	Email         string
+	EmailVerified bool
+	Image         string
+}
 
 var Providers map[string]Provider
 
@@ -41,6 +56,21 @@ func InitOAuth() {
 			authCodeOptions: oauth2.AccessTypeOffline,
 		},
 	}
+
+	for _, providerConfig := range config.Envs.OidcProviders {
+		if _, ok := Providers[providerConfig.Name]; ok {
+			log.Fatalf("[OAuth] Provider %s is already defined", providerConfig.Name)
+		}
+
+		provider, err := newOpenIDConnect(context.Background(), providerConfig)
+		if err != nil {
+			log.Printf("[OAuth] Failed to discover provider %s, it will not be available: %s\n", providerConfig.Name, err.Error())
+			continue
+		}
+
+		Providers[providerConfig.Name] = provider
+		log.Printf("[OAuth] Registered OpenID Connect provider %s\n", providerConfig.Name)
+	}
 }
 
 func buildCallbackURL(url, provider string) string {
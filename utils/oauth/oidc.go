@@ -0,0 +1,117 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/piquel-fr/api/config"
+	"github.com/piquel-fr/api/utils/errors"
+	"golang.org/x/oauth2"
+)
+
+// openIDConnect is a generic provider whose endpoints and keys are read from
+// the discovery document of its issuer
+type openIDConnect struct {
+	config   oauth2.Config
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+func newOpenIDConnect(ctx context.Context, providerConfig config.OidcProviderConfig) (*openIDConnect, error) {
+	provider, err := oidc.NewProvider(ctx, providerConfig.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &openIDConnect{
+		config: oauth2.Config{
+			ClientID:     providerConfig.ClientID,
+			ClientSecret: providerConfig.ClientSecret,
+			RedirectURL:  buildCallbackURL(config.Envs.Url, providerConfig.Name),
+			Scopes:       providerConfig.Scopes,
+			Endpoint:     provider.Endpoint(),
+		},
+		provider: provider,
+		verifier: provider.Verifier(&oidc.Config{ClientID: providerConfig.ClientID}),
+	}, nil
+}
+
+func (o *openIDConnect) GetOAuthConfig() *oauth2.Config { return &o.config }
+func (o *openIDConnect) AuthCodeURL(state, nonce, verifier string) string {
+	return o.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+func (o *openIDConnect) Exchange(ctx context.Context, code, verifier string) (*oauth2.Token, error) {
+	return o.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+}
+
+func (o *openIDConnect) FetchUser(ctx context.Context, token *oauth2.Token, nonce string) (*User, error) {
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.NewError("the provider did not return an ID token", http.StatusUnauthorized)
+	}
+
+	// checks the signature against the JWKS, the issuer, the audience and the expiry
+	idToken, err := o.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, errors.NewError(fmt.Sprintf("the ID token is invalid: %s", err.Error()), http.StatusUnauthorized)
+	}
+
+	if idToken.Nonce != nonce {
+		return nil, errors.NewError("the ID token nonce does not match", http.StatusUnauthorized)
+	}
+
+	claims := oidcClaims{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	// the email is not always part of the ID token
+	if claims.Email == "" && o.provider.UserInfoEndpoint() != "" {
+		userInfo, err := o.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, err
+		}
+
+		if userInfo.Subject != idToken.Subject {
+			return nil, errors.NewError("the user info does not belong to the ID token subject", http.StatusUnauthorized)
+		}
+
+		if err := userInfo.Claims(&claims); err != nil {
+			return nil, err
+		}
+	}
+
+	if claims.Email == "" {
+		return nil, errors.NewError("the provider did not return an email address", http.StatusBadRequest)
+	}
+
+	// an address the provider says it did not verify can't be trusted for anything
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		return nil, errors.NewError(fmt.Sprintf("the email address %s is not verified", claims.Email), http.StatusForbidden)
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Name
+	}
+
+	return &User{
+		Subject:       idToken.Subject,
+		Name:          claims.Name,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified != nil && *claims.EmailVerified,
+		Image:         claims.Picture,
+		Username:      username, // will be formated by the users service
+	}, nil
+}
+
+type oidcClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     *bool  `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Picture           string `json:"picture"`
+}
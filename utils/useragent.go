@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UserAgent is what could be told about a client from its User-Agent header.
+// Unknown parts are left empty
+type UserAgent struct {
+	Browser string
+	Version string // major version of the browser
+	OS      string
+	Device  string
+}
+
+// the first match wins, so browsers that embed the token of another come first
+var browserTokens = []struct{ token, name string }{
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Version/", "Safari"}, // Safari puts its version there, not after Safari/
+}
+
+var osTokens = []struct{ token, name string }{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"iPod", "iOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+var botTokens = []string{"bot", "crawler", "spider", "curl/", "wget/", "python-requests/", "go-http-client/"}
+
+// ParseUserAgent reads the browser, OS and kind of device from a User-Agent
+// header. It only knows the common browsers, it is meant to help users
+// recognise their sessions, not to be relied on
+func ParseUserAgent(header string) UserAgent {
+	ua := UserAgent{Device: DeviceUnknown}
+	if header == "" {
+		return ua
+	}
+
+	lower := strings.ToLower(header)
+	for _, token := range botTokens {
+		if strings.Contains(lower, token) {
+			ua.Device = DeviceBot
+			return ua
+		}
+	}
+
+	for _, browser := range browserTokens {
+		index := strings.Index(header, browser.token)
+		if index == -1 {
+			continue
+		}
+		if browser.name == "Safari" && !strings.Contains(header, "Safari/") {
+			continue
+		}
+
+		ua.Browser = browser.name
+		version := header[index+len(browser.token):]
+		version, _, _ = strings.Cut(version, " ")
+		ua.Version, _, _ = strings.Cut(version, ".")
+		break
+	}
+
+	for _, os := range osTokens {
+		if strings.Contains(header, os.token) {
+			ua.OS = os.name
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(header, "iPad") || strings.Contains(header, "Tablet"):
+		ua.Device = DeviceTablet
+	case strings.Contains(header, "Mobi") || strings.Contains(header, "iPhone") || strings.Contains(header, "iPod"):
+		ua.Device = DeviceMobile
+	case ua.OS == "Android": // Android tablets don't say Mobile
+		ua.Device = DeviceTablet
+	case ua.OS != "":
+		ua.Device = DeviceDesktop
+	}
+
+	return ua
+}
+
+// Name is the browser with its major version, like "Firefox 128"
+func (ua UserAgent) Name() string {
+	if ua.Version == "" {
+		return ua.Browser
+	}
+	return fmt.Sprintf("%s %s", ua.Browser, ua.Version)
+}
+
+// Fingerprint identifies the device without versions, so that updating the
+// browser or OS does not make it a new device
+func (ua UserAgent) Fingerprint() string {
+	return fmt.Sprintf("%s/%s/%s", ua.Browser, ua.OS, ua.Device)
+}